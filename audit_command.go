@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"local-mcp/tools"
+)
+
+const auditUsage = `usage: local-mcp audit tail [-n N] [-f] [--json] [--file PATH]
+       local-mcp audit search [--tool NAME] [--caller NAME] [--connection PROFILE]
+                              [--since DURATION|TIME] [--errors] [--limit N] [--json] [--file PATH] [TEXT]`
+
+// runAudit implements the audit subcommand, which prints records of the
+// audit log written by the server.
+func runAudit(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(auditUsage)
+	}
+
+	flags := flag.NewFlagSet("audit "+args[0], flag.ContinueOnError)
+	path := flags.String("file", tools.AuditLogPath(), "Audit log to read (default: $LOCAL_MCP_AUDIT_LOG or the local-mcp state directory)")
+	asJSON := flags.Bool("json", false, "Print records as JSON lines")
+
+	switch args[0] {
+	case "tail":
+		lines := flags.Int("n", 20, "Number of records to print")
+		follow := flags.Bool("f", false, "Keep printing records as they are appended")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *path == "" {
+			return errors.New("the audit log is turned off (LOCAL_MCP_AUDIT_LOG=off), pass --file")
+		}
+		return tailAudit(*path, *lines, *follow, *asJSON, out)
+
+	case "search":
+		var filter tools.AuditFilter
+		flags.StringVar(&filter.Tool, "tool", "", "Only records of this tool")
+		flags.StringVar(&filter.Caller, "caller", "", "Only records of this HTTP caller")
+		flags.StringVar(&filter.Connection, "connection", "", "Only records that used this connection profile")
+		flags.BoolVar(&filter.ErrorsOnly, "errors", false, "Only failed tool calls")
+		since := flags.String("since", "", "Only records newer than a duration ago (e.g. 1h) or an RFC 3339 time")
+		limit := flags.Int("limit", 0, "Print at most the last N matching records (default: all)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *path == "" {
+			return errors.New("the audit log is turned off (LOCAL_MCP_AUDIT_LOG=off), pass --file")
+		}
+		if *since != "" {
+			t, err := parseSince(*since, time.Now())
+			if err != nil {
+				return err
+			}
+			filter.Since = t
+		}
+		filter.Text = strings.Join(flags.Args(), " ")
+		return searchAudit(*path, filter, *limit, *asJSON, out)
+
+	default:
+		return fmt.Errorf("unknown audit command %q\n%s", args[0], auditUsage)
+	}
+}
+
+func tailAudit(path string, lines int, follow, asJSON bool, out io.Writer) error {
+	// Remember where the log ends before reading it, so that following
+	// neither repeats nor misses records.
+	offset := tools.AuditLogSize(path)
+	if lines > 0 {
+		if err := searchAudit(path, tools.AuditFilter{}, lines, asJSON, out); err != nil && !follow {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return tools.FollowAuditLog(ctx, path, offset, tools.AuditFilter{}, func(record tools.AuditRecord) {
+		printAuditRecord(out, record, asJSON)
+	})
+}
+
+// searchAudit prints the records matching filter, only the last limit of
+// them if limit is positive.
+func searchAudit(path string, filter tools.AuditFilter, limit int, asJSON bool, out io.Writer) error {
+	var records []tools.AuditRecord
+	err := tools.ReadAuditLog(path, filter, func(record tools.AuditRecord) {
+		records = append(records, record)
+		if limit > 0 && len(records) > limit {
+			records = records[1:]
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		printAuditRecord(out, record, asJSON)
+	}
+	return nil
+}
+
+// parseSince accepts a duration before now or an RFC 3339 time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration like 1h or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+func printAuditRecord(out io.Writer, record tools.AuditRecord, asJSON bool) {
+	if asJSON {
+		data, _ := json.Marshal(record)
+		fmt.Fprintln(out, string(data))
+		return
+	}
+	fmt.Fprintln(out, formatAuditRecord(record))
+}
+
+// formatAuditRecord renders a record on one line: time, tool, caller,
+// connections, outcome and arguments.
+func formatAuditRecord(record tools.AuditRecord) string {
+	fields := []string{record.Time.Local().Format("2006-01-02 15:04:05"), record.Tool}
+	if record.Caller != "" {
+		fields = append(fields, "caller="+record.Caller)
+	}
+	if len(record.Connections) > 0 {
+		fields = append(fields, "connection="+strings.Join(record.Connections, ","))
+	}
+	fields = append(fields, fmt.Sprintf("%dms", record.DurationMS))
+	if record.Rows != nil {
+		fields = append(fields, fmt.Sprintf("rows=%d", *record.Rows))
+	}
+	if len(record.QueryIDs) > 0 {
+		fields = append(fields, "query_id="+strings.Join(record.QueryIDs, ","))
+	}
+	if len(record.Arguments) > 0 {
+		args, _ := json.Marshal(record.Arguments)
+		fields = append(fields, string(args))
+	}
+	if record.Error != "" {
+		fields = append(fields, "error: "+strings.ReplaceAll(record.Error, "\n", " "))
+	}
+	return strings.Join(fields, "  ")
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
 	"local-mcp/tools"
 
 	"github.com/strowk/foxy-contexts/pkg/app"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/sse"
 	"github.com/strowk/foxy-contexts/pkg/stdio"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
@@ -16,30 +27,150 @@ import (
 const (
 	appName    = "local-mcp"
 	appVersion = "1.0.0"
+
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+
+	defaultListenAddress = "127.0.0.1:8080"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := runAudit(os.Args[2:], os.Stdout); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(2)
+		}
+		return
+	}
+
+	transportKind := flag.String("transport", transportStdio, "Transport to serve MCP over: stdio, http (Streamable HTTP) or sse")
+	var httpConfig tools.HTTPTransportConfig
+	flag.StringVar(&httpConfig.Address, "listen", defaultListenAddress, "Address to listen on for the http and sse transports")
+	flag.StringVar(&httpConfig.AuthFile, "auth-file", "", "JSON file listing the callers of the http transport with their tokens and scopes")
+	flag.StringVar(&httpConfig.TLSCertFile, "tls-cert", "", "TLS certificate for the http transport")
+	flag.StringVar(&httpConfig.TLSKeyFile, "tls-key", "", "TLS private key for the http transport")
+	flag.StringVar(&httpConfig.ClientCAFile, "tls-client-ca", "", "CA that signs the client certificates accepted by the http transport")
+	allowedOrigins := flag.String("allowed-origins", "", "Comma-separated origins of web pages allowed to call the http transport, besides loopback ones")
+	flag.Parse()
+	if *allowedOrigins != "" {
+		httpConfig.AllowedOrigins = strings.Split(*allowedOrigins, ",")
+	}
+
 	logger := createLogger()
 
-	app.
+	// Resource notifications are written to the stdio stream. The HTTP
+	// transports have no channel for messages outside of a request, so there
+	// they are discarded and not advertised.
+	notifierOut := io.Writer(os.Stdout)
+	if *transportKind != transportStdio {
+		notifierOut = io.Discard
+	}
+	notifier := tools.NewNotifier(notifierOut)
+
+	transport, err := newTransport(*transportKind, httpConfig, notifier)
+	if err != nil {
+		log.Fatalf("Invalid transport configuration: %v", err)
+	}
+
+	err = app.
 		NewBuilder().
 		WithTool(tools.NewSearchTool).
+		WithTool(tools.NewFetchURLTool).
 		WithTool(tools.NewClickHouseQueryTool).
 		WithTool(tools.NewClickHouseSchemasTool).
 		WithTool(tools.NewClickHouseTablesTool).
+		WithTool(tools.NewClickHouseDescribeTool).
+		WithTool(tools.NewClickHouseExplainTool).
+		WithTool(tools.NewClickHouseExportTool).
+		WithTool(tools.NewClickHouseConnectionsTool).
+		WithResource(tools.NewSearchResultsSchemaResource).
+		WithResourceProvider(tools.NewClickHouseResourceProvider).
+		WithPrompt(tools.NewExplainTablePrompt).
+		WithPrompt(tools.NewSlowQueriesPrompt).
+		WithPrompt(tools.NewColumnCardinalityPrompt).
+		WithPrompt(tools.NewDraftQueryPrompt).
 		WithName(appName).
 		WithVersion(appVersion).
 		WithServerCapabilities(&mcp.ServerCapabilities{
 			Tools: &mcp.ServerCapabilitiesTools{},
+			Resources: &mcp.ServerCapabilitiesResources{
+				ListChanged: ptr(*transportKind == transportStdio),
+				Subscribe:   ptr(*transportKind == transportStdio),
+			},
+			Prompts: &mcp.ServerCapabilitiesPrompts{},
 		}).
-		WithTransport(stdio.NewTransport()).
+		WithTransport(transport).
 		WithFxOptions(
 			fx.Provide(func() *zap.Logger { return logger }),
+			fx.Provide(tools.NewClickHouseClient),
+			fx.Supply(notifier),
+			fx.Provide(tools.NewResourceWatcher),
+			fx.Provide(tools.NewClickHouseCompleter),
+			fx.Provide(tools.NewAuditLog),
+			fx.Provide(tools.NewResultCache),
+			fx.Decorate(tools.DecorateToolMux),
+			fx.Decorate(tools.DecorateResourceMux),
+			fx.Decorate(tools.DecoratePromptMux),
 			fx.WithLogger(func(logger *zap.Logger) fxevent.Logger {
 				return &fxevent.ZapLogger{Logger: logger}
 			}),
 		).
 		Run()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// newTransport creates the transport selected by the --transport flag. Every
+// transport serves the same tools, resources and prompts; the HTTP transports
+// create a server per client session.
+func newTransport(kind string, httpConfig tools.HTTPTransportConfig, notifier *tools.Notifier) (server.Transport, error) {
+	switch kind {
+	case transportStdio:
+		return stdio.NewTransport(stdio.WithOut(notifier), stdio.WithNewServerFunc(tools.NewRequestServer(notifier))), nil
+	case transportHTTP:
+		host, port, err := parseListenAddress(httpConfig.Address)
+		if err != nil {
+			return nil, err
+		}
+		httpConfig.Address = net.JoinHostPort(host, strconv.Itoa(port))
+		return tools.NewHTTPTransport(httpConfig)
+	case transportSSE:
+		if httpConfig.AuthFile != "" || httpConfig.TLSCertFile != "" || httpConfig.ClientCAFile != "" {
+			return nil, errors.New("the sse transport does not support TLS or authentication, use --transport=http")
+		}
+		host, port, err := parseListenAddress(httpConfig.Address)
+		if err != nil {
+			return nil, err
+		}
+		// The SSE transport always binds to the loopback interface.
+		if host != "127.0.0.1" && host != "localhost" {
+			return nil, fmt.Errorf("the sse transport only listens on 127.0.0.1, got %q", host)
+		}
+		return sse.NewTransport(sse.WithPort(port)), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q, expected %s, %s or %s", kind, transportStdio, transportHTTP, transportSSE)
+	}
+}
+
+// parseListenAddress splits host:port. As with net.Listen, an empty host
+// listens on all interfaces.
+func parseListenAddress(listen string) (string, int, error) {
+	host, portValue, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in listen address %q", listen)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	return host, port, nil
 }
 
 func createLogger() *zap.Logger {
@@ -53,3 +184,7 @@ func createLogger() *zap.Logger {
 
 	return logger
 }
+
+func ptr[T any](v T) *T {
+	return &v
+}
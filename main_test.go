@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"local-mcp/tools"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		listen       string
+		expectedHost string
+		expectedPort int
+		expectError  bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1", 8080, false},
+		{":9000", "0.0.0.0", 9000, false},
+		{"[::1]:8080", "::1", 8080, false},
+		{"localhost", "", 0, true},
+		{"127.0.0.1:http", "", 0, true},
+		{"127.0.0.1:70000", "", 0, true},
+	}
+
+	for _, test := range tests {
+		host, port, err := parseListenAddress(test.listen)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseListenAddress(%q) expected error, got %s:%d", test.listen, host, port)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseListenAddress(%q) returned error: %v", test.listen, err)
+			continue
+		}
+		if host != test.expectedHost || port != test.expectedPort {
+			t.Errorf("parseListenAddress(%q) = %s:%d, want %s:%d", test.listen, host, port, test.expectedHost, test.expectedPort)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	notifier := tools.NewNotifier(nil)
+
+	tests := []struct {
+		kind        string
+		listen      string
+		authFile    string
+		expectError bool
+	}{
+		{transportStdio, defaultListenAddress, "", false},
+		{transportHTTP, defaultListenAddress, "", false},
+		{transportHTTP, "0.0.0.0:8080", "", true},
+		{transportHTTP, "8080", "", true},
+		{transportSSE, defaultListenAddress, "", false},
+		{transportSSE, "0.0.0.0:8080", "", true},
+		{transportSSE, defaultListenAddress, "callers.json", true},
+		{"websocket", defaultListenAddress, "", true},
+	}
+
+	for _, test := range tests {
+		config := tools.HTTPTransportConfig{Address: test.listen, AuthFile: test.authFile}
+		transport, err := newTransport(test.kind, config, notifier)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("newTransport(%q, %q) expected error", test.kind, test.listen)
+			}
+			continue
+		}
+		if err != nil || transport == nil {
+			t.Errorf("newTransport(%q, %q) = %v, %v, want a transport", test.kind, test.listen, transport, err)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value       string
+		expected    time.Time
+		expectError bool
+	}{
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"2026-04-30T08:00:00Z", time.Date(2026, 4, 30, 8, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		result, err := parseSince(test.value, now)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("parseSince(%q) expected error, got %v", test.value, result)
+			}
+			continue
+		}
+		if err != nil || !result.Equal(test.expected) {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", test.value, result, err, test.expected)
+		}
+	}
+}
+
+func TestRunAuditSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	lines := `{"time":"2026-05-01T10:00:00Z","tool":"clickhouse-query","arguments":{"query":"SELECT 1"},"connections":["prod"],"duration_ms":12,"rows":1}
+{"time":"2026-05-01T11:00:00Z","tool":"search","arguments":{"query":"clickhouse"},"duration_ms":300,"error":"search failed"}
+`
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"search", "--file", path, "--errors"}, []string{"search"}},
+		{[]string{"search", "--file", path, "--connection", "prod", "select"}, []string{"clickhouse-query"}},
+		{[]string{"tail", "--file", path, "-n", "1"}, []string{"search"}},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := runAudit(test.args, &out); err != nil {
+			t.Errorf("runAudit(%v) returned error: %v", test.args, err)
+			continue
+		}
+		var tools []string
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if fields := strings.Fields(line); len(fields) > 2 {
+				tools = append(tools, fields[2])
+			}
+		}
+		if !reflect.DeepEqual(tools, test.expected) {
+			t.Errorf("runAudit(%v) printed %q, want records of %v", test.args, out.String(), test.expected)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package tools
+
+import "os"
+
+// lockFile does nothing where flock is not available. Processes sharing the
+// audit log may then rotate it concurrently.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+var errUnauthenticated = errors.New("authentication required")
+
+// Caller is an authenticated client of the HTTP listener, with the tools and
+// connection profiles it may use. An empty scope allows everything.
+type Caller struct {
+	Name        string
+	Tools       []string
+	Connections []string
+}
+
+// AllowsTool reports whether the caller may call the named tool.
+func (c *Caller) AllowsTool(name string) bool {
+	return scopeAllows(c.Tools, name)
+}
+
+// AllowsConnection reports whether the caller may use the connection profile.
+func (c *Caller) AllowsConnection(profile string) bool {
+	return scopeAllows(c.Connections, profile)
+}
+
+func scopeAllows(scope []string, name string) bool {
+	return len(scope) == 0 || slices.Contains(scope, "*") || slices.Contains(scope, name)
+}
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFromContext returns the caller of a request, or nil for stdio, where
+// whoever started the process has full access.
+func callerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+// Authenticator identifies the caller of an HTTP request. It returns nil and
+// no error when the request carries no credential of its kind, so that
+// several authenticators can be chained.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Caller, error)
+}
+
+// authenticators tries each authenticator in turn and rejects requests that
+// none of them identifies.
+type authenticators []Authenticator
+
+func (a authenticators) Authenticate(r *http.Request) (*Caller, error) {
+	for _, authenticator := range a {
+		caller, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if caller != nil {
+			return caller, nil
+		}
+	}
+	return nil, errUnauthenticated
+}
+
+// tokenAuthenticator accepts static bearer tokens.
+type tokenAuthenticator struct {
+	// callers is keyed by the SHA-256 of the token, so that looking a token
+	// up does not leak how much of it matched through timing.
+	callers map[[sha256.Size]byte]*Caller
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*Caller, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, errors.New("unsupported authorization scheme, expected Bearer")
+	}
+	caller, ok := a.callers[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+	if !ok {
+		return nil, errors.New("invalid bearer token")
+	}
+	return caller, nil
+}
+
+// clientCertAuthenticator accepts client certificates verified against the
+// listener's client CA, identifying callers by the certificate's common name.
+type clientCertAuthenticator struct {
+	// callers scopes known common names. When it is empty, every verified
+	// certificate is a caller with full access.
+	callers map[string]*Caller
+}
+
+func (a *clientCertAuthenticator) Authenticate(r *http.Request) (*Caller, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(a.callers) == 0 {
+		return &Caller{Name: name}, nil
+	}
+	caller, ok := a.callers[name]
+	if !ok {
+		return nil, fmt.Errorf("client certificate %q is not allowed", name)
+	}
+	return caller, nil
+}
+
+// callersFile is the format of the file passed with --auth-file.
+type callersFile struct {
+	Callers []callerConfig `json:"callers"`
+}
+
+type callerConfig struct {
+	Name         string   `json:"name"`
+	Token        string   `json:"token"`
+	ClientCertCN string   `json:"client_cert_cn"`
+	Tools        []string `json:"tools"`
+	Connections  []string `json:"connections"`
+}
+
+// loadAuthenticators reads the callers file, if any, and returns the
+// authenticators for the configured credentials. Client certificates are
+// only accepted when clientCerts is set.
+func loadAuthenticators(path string, clientCerts bool) (authenticators, error) {
+	var file callersFile
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth file: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// A misspelled scope key must not silently grant full access.
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("failed to parse auth file %s: %w", path, err)
+		}
+	}
+
+	tokens := &tokenAuthenticator{callers: map[[sha256.Size]byte]*Caller{}}
+	certs := &clientCertAuthenticator{callers: map[string]*Caller{}}
+	for i, config := range file.Callers {
+		if config.Name == "" {
+			return nil, fmt.Errorf("caller %d in %s has no name", i+1, path)
+		}
+		if config.Token == "" && config.ClientCertCN == "" {
+			return nil, fmt.Errorf("caller %s has neither a token nor a client_cert_cn", config.Name)
+		}
+		caller := &Caller{Name: config.Name, Tools: config.Tools, Connections: config.Connections}
+
+		if config.Token != "" {
+			key := sha256.Sum256([]byte(config.Token))
+			if _, ok := tokens.callers[key]; ok {
+				return nil, fmt.Errorf("caller %s reuses the token of another caller", config.Name)
+			}
+			tokens.callers[key] = caller
+		}
+		if config.ClientCertCN != "" {
+			if !clientCerts {
+				return nil, fmt.Errorf("caller %s has a client_cert_cn but no client CA is configured", config.Name)
+			}
+			certs.callers[config.ClientCertCN] = caller
+		}
+	}
+
+	var chain authenticators
+	if clientCerts {
+		chain = append(chain, certs)
+	}
+	if len(tokens.callers) > 0 {
+		chain = append(chain, tokens)
+	}
+	return chain, nil
+}
+
+// toolMux hides and refuses the tools a caller is not allowed to use, and
+// records every tool call in the audit log.
+type toolMux struct {
+	fxctx.ToolMux
+	audit *AuditLog
+}
+
+// DecorateToolMux restricts tools/list and tools/call to the caller's tool
+// scope and audits tools/call.
+func DecorateToolMux(mux fxctx.ToolMux, audit *AuditLog) fxctx.ToolMux {
+	return &toolMux{ToolMux: mux, audit: audit}
+}
+
+func (m *toolMux) CallToolNamed(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	if caller := callerFromContext(ctx); caller != nil && !caller.AllowsTool(name) {
+		return nil, fmt.Errorf("tool %s is not permitted for caller %s", name, caller.Name)
+	}
+	return m.ToolMux.CallToolNamed(ctx, name, args)
+}
+
+func (m *toolMux) RegisterHandlers(s server.Server) {
+	m.ToolMux.RegisterHandlers(s)
+
+	s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		tools := m.GetMcpTools()
+		if caller := callerFromContext(ctx); caller != nil {
+			tools = slices.DeleteFunc(tools, func(tool mcp.Tool) bool { return !caller.AllowsTool(tool.Name) })
+		}
+		return &mcp.ListToolsResult{Tools: tools}, nil
+	})
+
+	s.SetRequestHandler(&mcp.CallToolRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		params := req.(*mcp.CallToolRequest).Params
+		record := &AuditRecord{Time: time.Now().UTC(), Tool: params.Name, Arguments: redactArguments(params.Arguments)}
+		if caller := callerFromContext(ctx); caller != nil {
+			record.Caller = caller.Name
+		}
+
+		result, rpcErr := m.callTool(withAuditRecord(ctx, record), params.Name, params.Arguments)
+
+		record.DurationMS = time.Since(record.Time).Milliseconds()
+		switch {
+		case rpcErr != nil:
+			record.Error = fmt.Sprint(rpcErr.Data)
+			if rpcErr.Data == nil {
+				record.Error = rpcErr.Message
+			}
+		case result.IsError != nil && *result.IsError:
+			record.Error = resultText(result)
+		}
+		m.audit.Record(record)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return result, nil
+	})
+}
+
+func (m *toolMux) callTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, *jsonrpc2.Error) {
+	if caller := callerFromContext(ctx); caller != nil && !caller.AllowsTool(name) {
+		return nil, &jsonrpc2.Error{Code: errCodeInvalidParams, Message: "Invalid params",
+			Data: fmt.Sprintf("tool %s is not permitted for caller %s", name, caller.Name)}
+	}
+
+	res, err := m.ToolMux.CallToolNamed(ctx, name, args)
+	if err != nil {
+		return nil, jsonrpc2.NewServerError(fxctx.ToolNotFound, fmt.Sprintf("tool not found: %s", name))
+	}
+	return &mcp.CallToolResult{Meta: res.Meta, Content: res.Content, IsError: res.IsError}, nil
+}
+
+// resultText returns the text of the first text content of a tool result.
+func resultText(result *mcp.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func writeAuthFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "callers.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAuthenticators_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown field", `{"callers": [{"name": "ci", "token": "t", "tool": ["clickhouse-query"]}]}`},
+		{"missing name", `{"callers": [{"token": "t"}]}`},
+		{"no credential", `{"callers": [{"name": "ci"}]}`},
+		{"duplicate token", `{"callers": [{"name": "a", "token": "t"}, {"name": "b", "token": "t"}]}`},
+		{"cert without CA", `{"callers": [{"name": "a", "client_cert_cn": "alice"}]}`},
+		{"malformed", `{"callers": [`},
+	}
+
+	for _, test := range tests {
+		if _, err := loadAuthenticators(writeAuthFile(t, test.content), false); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestAuthenticators_Authenticate(t *testing.T) {
+	path := writeAuthFile(t, `{"callers": [
+		{"name": "ci", "token": "ci-token", "tools": ["clickhouse-query"], "connections": ["staging"]},
+		{"name": "alice", "client_cert_cn": "alice.example.com"}
+	]}`)
+	chain, err := loadAuthenticators(path, true)
+	if err != nil {
+		t.Fatalf("loadAuthenticators() returned error: %v", err)
+	}
+
+	withCert := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		tls           *tls.ConnectionState
+		expected      string
+	}{
+		{"token", "Bearer ci-token", nil, "ci"},
+		{"client certificate", "", withCert("alice.example.com"), "alice"},
+		{"no credentials", "", nil, ""},
+		{"wrong token", "Bearer nope", nil, ""},
+		{"basic auth", "Basic Y2k6Y2ktdG9rZW4=", nil, ""},
+		{"unknown certificate", "", withCert("mallory"), ""},
+		{"unknown certificate with token", "Bearer ci-token", withCert("mallory"), ""},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "/mcp", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		req.TLS = test.tls
+
+		caller, err := chain.Authenticate(req)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got caller %s", test.name, caller.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Authenticate() returned error: %v", test.name, err)
+			continue
+		}
+		if caller.Name != test.expected {
+			t.Errorf("%s: Authenticate() = %s, want %s", test.name, caller.Name, test.expected)
+		}
+	}
+}
+
+func TestCaller_Scopes(t *testing.T) {
+	caller := &Caller{Name: "ci", Tools: []string{"clickhouse-query"}, Connections: []string{"*"}}
+	if !caller.AllowsTool("clickhouse-query") || caller.AllowsTool("search-web") {
+		t.Error("AllowsTool() does not follow the tool scope")
+	}
+	if !caller.AllowsConnection("prod") {
+		t.Error("AllowsConnection() should allow every profile for *")
+	}
+
+	unrestricted := &Caller{Name: "admin"}
+	if !unrestricted.AllowsTool("search-web") || !unrestricted.AllowsConnection("prod") {
+		t.Error("an empty scope should allow everything")
+	}
+}
+
+func TestClickHouseClient_ConnectionScope(t *testing.T) {
+	client := newClickHouseClient(&clickHouseProfiles{
+		names:          []string{"prod", "staging"},
+		configs:        map[string]*ClickHouseConfig{"prod": {}, "staging": {}},
+		defaultProfile: "prod",
+	})
+	ctx := withCaller(context.Background(), &Caller{Name: "ci", Connections: []string{"staging"}})
+
+	if profiles := client.AllowedProfiles(ctx); len(profiles) != 1 || profiles[0] != "staging" {
+		t.Errorf("AllowedProfiles() = %v, want [staging]", profiles)
+	}
+
+	for _, profile := range []string{"", "prod"} {
+		err := client.Do(ctx, profile, func(conn driver.Conn) error {
+			t.Errorf("Do(%q) ran with a profile outside the caller's scope", profile)
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "not permitted") {
+			t.Errorf("Do(%q) = %v, want a permission error", profile, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"go.uber.org/zap"
+)
+
+const (
+	envCacheDir       = "LOCAL_MCP_CACHE_DIR"
+	envCacheTTL       = "LOCAL_MCP_CACHE_TTL"
+	envCacheMaxSizeMB = "LOCAL_MCP_CACHE_MAX_SIZE_MB"
+
+	defaultCacheTTL       = 24 * time.Hour
+	defaultCacheMaxSizeMB = 100
+
+	cacheEntryExt = ".json"
+)
+
+// cacheStatus tells whether a tool result came from the cache.
+type cacheStatus string
+
+const (
+	cacheHit    cacheStatus = "hit"
+	cacheMiss   cacheStatus = "miss"
+	cacheBypass cacheStatus = "bypass"
+	cacheOff    cacheStatus = "off"
+)
+
+// cacheInfo describes how a tool result was obtained.
+type cacheInfo struct {
+	Status cacheStatus
+	// StoredAt is when a cached result was stored.
+	StoredAt time.Time
+}
+
+// cacheEntry is the content of a cache file.
+type cacheEntry struct {
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"stored_at"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// ResultCache stores the results of search-web and fetch-url on disk, one
+// file per entry named after the hash of its key. Entries expire after the
+// TTL, and once the cache grows past its size limit the least recently used
+// entries are evicted; the modification time of a file records its last use.
+// A nil ResultCache caches nothing.
+type ResultCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	logger  *zap.Logger
+	now     func() time.Time
+
+	// mu serialises eviction.
+	mu sync.Mutex
+}
+
+// NewResultCache opens the cache configured by the environment. It returns
+// nil, caching nothing, when LOCAL_MCP_CACHE_DIR is "off", the TTL is zero or
+// the cache directory cannot be created.
+func NewResultCache(logger *zap.Logger) *ResultCache {
+	dir := resultCacheDir()
+	if dir == "" {
+		return nil
+	}
+	ttl := defaultCacheTTL
+	if value := os.Getenv(envCacheTTL); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			ttl = d
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	maxSize := int64(parseEnvInt(envCacheMaxSizeMB, defaultCacheMaxSizeMB)) << 20
+
+	cache, err := openResultCache(dir, ttl, maxSize, logger)
+	if err != nil {
+		logger.Error("result cache disabled", zap.Error(err))
+		return nil
+	}
+	return cache
+}
+
+// resultCacheDir returns the cache directory set by LOCAL_MCP_CACHE_DIR, by
+// default local-mcp in the user cache directory, or "" if the variable is set
+// to "off".
+func resultCacheDir() string {
+	dir := os.Getenv(envCacheDir)
+	if strings.EqualFold(dir, "off") {
+		return ""
+	}
+	if dir != "" {
+		return dir
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "local-mcp")
+}
+
+func openResultCache(dir string, ttl time.Duration, maxSize int64, logger *zap.Logger) (*ResultCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ResultCache{dir: dir, ttl: ttl, maxSize: maxSize, logger: logger, now: time.Now}, nil
+}
+
+func (c *ResultCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+cacheEntryExt)
+}
+
+// get decodes the entry stored under key into value and returns when it was
+// stored. Expired and unreadable entries are removed.
+func (c *ResultCache) get(key string, value any) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var entry cacheEntry
+	now := c.now()
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key ||
+		now.Sub(entry.StoredAt) >= c.ttl || json.Unmarshal(entry.Value, value) != nil {
+		os.Remove(path)
+		return time.Time{}, false
+	}
+	os.Chtimes(path, now, now)
+	return entry.StoredAt, true
+}
+
+// put stores value under key, then evicts entries if the cache is over its
+// size limit. Failures are logged rather than returned: the cache is only an
+// optimisation.
+func (c *ResultCache) put(key string, value any) {
+	if c == nil {
+		return
+	}
+	if err := c.write(key, value); err != nil {
+		c.logger.Error("failed to write cache entry", zap.Error(err))
+		return
+	}
+	c.evict()
+}
+
+func (c *ResultCache) write(key string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	now := c.now()
+	data, err := json.Marshal(cacheEntry{Key: key, StoredAt: now, Value: encoded})
+	if err != nil {
+		return err
+	}
+
+	// Write next to the entry and rename, so that readers never see a
+	// partial file.
+	file, err := os.CreateTemp(c.dir, ".entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(file.Name(), now, now); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.path(key))
+}
+
+// evict removes the entries unused for longer than the TTL, which have
+// expired, and then the least recently used ones until the cache fits its
+// size limit.
+func (c *ResultCache) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		c.logger.Error("failed to read cache directory", zap.Error(err))
+		return
+	}
+	type file struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+	var files []file
+	var total int64
+	now := c.now()
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != cacheEntryExt {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.dir, dirEntry.Name())
+		if now.Sub(info.ModTime()) >= c.ttl {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, file{path: path, size: info.Size(), lastUse: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].lastUse.Before(files[j].lastUse) })
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(f.path); err == nil || os.IsNotExist(err) {
+			total -= f.size
+		}
+	}
+}
+
+// cachedResult returns the value stored in cache under key, or else calls
+// load and stores its result. With bypass set the cache is not read, but the
+// fresh result still replaces the cached one. Errors are not cached.
+func cachedResult[T any](cache *ResultCache, key string, bypass bool, load func() (T, error)) (T, cacheInfo, error) {
+	var value T
+	if cache == nil {
+		value, err := load()
+		return value, cacheInfo{Status: cacheOff}, err
+	}
+	if !bypass {
+		if storedAt, ok := cache.get(key, &value); ok {
+			return value, cacheInfo{Status: cacheHit, StoredAt: storedAt}, nil
+		}
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, cacheInfo{}, err
+	}
+	cache.put(key, value)
+
+	status := cacheMiss
+	if bypass {
+		status = cacheBypass
+	}
+	return value, cacheInfo{Status: status}, nil
+}
+
+// meta adds the cache status to the _meta of a tool result.
+func (info cacheInfo) meta(meta mcp.CallToolResultMeta) mcp.CallToolResultMeta {
+	if meta == nil {
+		meta = mcp.CallToolResultMeta{}
+	}
+	meta["cache"] = string(info.Status)
+	if info.Status == cacheHit {
+		meta["cached_at"] = info.StoredAt.UTC().Format(time.RFC3339)
+	}
+	return meta
+}
+
+// describe returns a note on a cached result for the text of a tool result,
+// or "" if the result is fresh.
+func (info cacheInfo) describe() string {
+	if info.Status != cacheHit {
+		return ""
+	}
+	return fmt.Sprintf("cached %s ago", time.Since(info.StoredAt).Round(time.Second))
+}
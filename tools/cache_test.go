@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestCache opens a cache in a temporary directory with a clock that the
+// test moves forward.
+func newTestCache(t *testing.T, ttl time.Duration, maxSize int64) (*ResultCache, *time.Time) {
+	t.Helper()
+	cache, err := openResultCache(t.TempDir(), ttl, maxSize, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestResultCache(t *testing.T) {
+	cache, now := newTestCache(t, time.Hour, 1<<20)
+
+	var value []string
+	if _, ok := cache.get("a", &value); ok {
+		t.Fatal("get() on an empty cache found an entry")
+	}
+	cache.put("a", []string{"x", "y"})
+	storedAt, ok := cache.get("a", &value)
+	if !ok || len(value) != 2 || value[1] != "y" || !storedAt.Equal(*now) {
+		t.Errorf("get() = %v, %v, %v, want the stored value", value, storedAt, ok)
+	}
+
+	*now = now.Add(time.Hour)
+	if _, ok := cache.get("a", &value); ok {
+		t.Error("get() returned an expired entry")
+	}
+	if _, err := os.Stat(cache.path("a")); !os.IsNotExist(err) {
+		t.Error("get() kept the expired entry")
+	}
+
+	os.WriteFile(cache.path("b"), []byte("not json"), 0o600)
+	if _, ok := cache.get("b", &value); ok {
+		t.Error("get() returned a corrupt entry")
+	}
+}
+
+func TestResultCache_Evict(t *testing.T) {
+	cache, now := newTestCache(t, time.Hour, 1<<20)
+	value := strings.Repeat("x", 100)
+	cache.put("a", value)
+	info, err := os.Stat(cache.path("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave room for three entries of the same size.
+	cache.maxSize = 3 * info.Size()
+	for _, key := range []string{"b", "c"} {
+		*now = now.Add(time.Minute)
+		cache.put(key, value)
+	}
+	*now = now.Add(time.Minute)
+	var got string
+	if _, ok := cache.get("a", &got); !ok {
+		t.Fatal("get() did not find a")
+	}
+
+	*now = now.Add(time.Minute)
+	cache.put("d", value)
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, err := os.Stat(cache.path(key)); (err == nil) != expected {
+			t.Errorf("after eviction, entry %s exists = %v, want %v", key, err == nil, expected)
+		}
+	}
+
+	*now = now.Add(2 * time.Hour)
+	cache.put("e", value)
+	entries, _ := filepath.Glob(filepath.Join(cache.dir, "*"+cacheEntryExt))
+	if len(entries) != 1 {
+		t.Errorf("after the TTL, the cache has %d entries, want only the new one", len(entries))
+	}
+}
+
+func TestSearchHandler_Cache(t *testing.T) {
+	useFreshSearchClients(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, `{"results": [{"title": "ClickHouse", "url": "https://clickhouse.com/", "content": "Fast OLAP database"}]}`)
+	}))
+	defer server.Close()
+	t.Setenv(envSearchProvider, providerSearXNG)
+	t.Setenv(envSearXNGURL, server.URL)
+
+	cache, _ := newTestCache(t, time.Hour, 1<<20)
+	handler := searchHandler(cache)
+
+	tests := []struct {
+		args     map[string]interface{}
+		status   cacheStatus
+		requests int
+	}{
+		{map[string]interface{}{"query": "ClickHouse  docs"}, cacheMiss, 1},
+		{map[string]interface{}{"query": "clickhouse docs"}, cacheHit, 1},
+		{map[string]interface{}{"query": "clickhouse docs", "limit": float64(5)}, cacheMiss, 2},
+		{map[string]interface{}{"query": "clickhouse docs", "bypass_cache": true}, cacheBypass, 3},
+		{map[string]interface{}{"query": "clickhouse docs"}, cacheHit, 3},
+	}
+
+	for _, tt := range tests {
+		result := handler(context.Background(), tt.args)
+		if result.IsError != nil && *result.IsError {
+			t.Fatalf("searchHandler(%v) = %q, want success", tt.args, resultText(result))
+		}
+		if result.Meta["cache"] != string(tt.status) || requests != tt.requests {
+			t.Errorf("searchHandler(%v) cache = %v after %d requests, want %s after %d", tt.args, result.Meta["cache"], requests, tt.status, tt.requests)
+		}
+		if cached := strings.Contains(resultText(result), "cached"); cached != (tt.status == cacheHit) {
+			t.Errorf("searchHandler(%v) = %q, want a cache note only on a hit", tt.args, resultText(result))
+		}
+		if !strings.Contains(resultText(result), "'"+tt.args["query"].(string)+"'") {
+			t.Errorf("searchHandler(%v) = %q, want the query as asked", tt.args, resultText(result))
+		}
+	}
+}
+
+func TestFetchURLHandler_Cache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "0123456789")
+	}))
+	defer server.Close()
+	t.Setenv(envFetchAllowPrivate, "true")
+
+	cache, _ := newTestCache(t, time.Hour, 1<<20)
+	handler := fetchURLHandler(cache)
+
+	handler(context.Background(), map[string]interface{}{"url": server.URL + "/page", "max_chars": float64(5)})
+	result := handler(context.Background(), map[string]interface{}{"url": server.URL + "/page#part", "start_index": float64(5)})
+	if requests != 1 || result.Meta["cache"] != string(cacheHit) || !strings.Contains(resultText(result), "56789") {
+		t.Errorf("fetchURLHandler() for the next chunk = %q, %v after %d requests, want the cached page", resultText(result), result.Meta, requests)
+	}
+
+	// Failures are not cached.
+	server.Close()
+	result = handler(context.Background(), map[string]interface{}{"url": server.URL + "/other"})
+	if result.IsError == nil || !*result.IsError {
+		t.Fatalf("fetchURLHandler() with the server down = %q, want an error", resultText(result))
+	}
+	if _, ok := cache.get(fetchCacheKey(server.URL+"/other", true), &fetchedPage{}); ok {
+		t.Error("fetchURLHandler() cached a failure")
+	}
+}
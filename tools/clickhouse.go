@@ -3,12 +3,15 @@ package tools
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 )
 
 const (
@@ -22,6 +25,17 @@ const (
 	chTimeout         = 30 * time.Second
 	maxConnections    = 5
 	connLifetime      = 10 * time.Minute
+	killQueryTimeout  = 5 * time.Second
+
+	defaultCHMaxExecutionTime = 60
+)
+
+// ClickHouse server error codes that are reported to the client specifically.
+const (
+	chErrTimeoutExceeded     = 159
+	chErrReadonly            = 164
+	chErrMemoryLimitExceeded = 241
+	chErrTooManyRowsOrBytes  = 396
 )
 
 // ClickHouseConfig holds the connection configuration for ClickHouse.
@@ -32,13 +46,25 @@ type ClickHouseConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Secure   bool   `json:"secure"`
-}
+	// HTTPPort is the port of the HTTP interface, used by clickhouse-export.
+	// Zero means 8123, or 8443 with Secure.
+	HTTPPort int `json:"http_port"`
+
+	// Server-side limits applied to every query. Zero values leave the
+	// server defaults in place.
+	MaxExecutionTime   int    `json:"max_execution_time"`
+	MaxResultRows      int    `json:"max_result_rows"`
+	MaxResultBytes     int    `json:"max_result_bytes"`
+	MaxMemoryUsage     int    `json:"max_memory_usage"`
+	ResultOverflowMode string `json:"result_overflow_mode"`
+	SettingsProfile    string `json:"settings_profile"`
 
-func isQuerySafe(query string) bool {
-	trimmedQuery := strings.TrimSpace(strings.ToUpper(query))
-	return strings.HasPrefix(trimmedQuery, "SELECT") ||
-		strings.HasPrefix(trimmedQuery, "SHOW") ||
-		strings.HasPrefix(trimmedQuery, "DESCRIBE")
+	// Cost guard: clickhouse-query refuses queries whose EXPLAIN ESTIMATE
+	// exceeds these before running them. Zero values disable the check.
+	MaxEstimatedRows  int `json:"max_estimated_rows"`
+	MaxEstimatedBytes int `json:"max_estimated_bytes"`
+	// AllowForce lets the force argument of clickhouse-query skip the guard.
+	AllowForce bool `json:"allow_force"`
 }
 
 func parseClickHouseLimit(limitArg interface{}) int {
@@ -71,9 +97,7 @@ func connectToClickHouse(ctx context.Context, config ClickHouseConfig) (driver.C
 				{Name: "local-mcp", Version: "1.0.0"},
 			},
 		},
-		Settings: clickhouse.Settings{
-			"max_execution_time": 60,
-		},
+		Settings: clickHouseSettings(config),
 		Compression: &clickhouse.Compression{
 			Method: clickhouse.CompressionLZ4,
 		},
@@ -102,143 +126,225 @@ func connectToClickHouse(ctx context.Context, config ClickHouseConfig) (driver.C
 	return conn, nil
 }
 
-func executeQuery(ctx context.Context, conn driver.Conn, query string, limit int) (string, error) {
-	// Add LIMIT clause if not present in SELECT queries
-	if strings.HasPrefix(strings.TrimSpace(strings.ToUpper(query)), "SELECT") &&
-		!strings.Contains(strings.ToUpper(query), "LIMIT") {
-		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+// clickHouseSettings builds the session settings for config. Every connection is
+// read-only on the server side, so writes are refused even if a query slips past
+// validateReadOnlyQuery.
+func clickHouseSettings(config ClickHouseConfig) clickhouse.Settings {
+	settings := clickhouse.Settings{}
+	if config.SettingsProfile != "" {
+		settings["profile"] = config.SettingsProfile
+	}
+	if config.MaxExecutionTime > 0 {
+		settings["max_execution_time"] = config.MaxExecutionTime
+	}
+	if config.MaxResultRows > 0 {
+		settings["max_result_rows"] = config.MaxResultRows
+	}
+	if config.MaxResultBytes > 0 {
+		settings["max_result_bytes"] = config.MaxResultBytes
+	}
+	if config.MaxMemoryUsage > 0 {
+		settings["max_memory_usage"] = config.MaxMemoryUsage
+	}
+	if config.ResultOverflowMode != "" {
+		settings["result_overflow_mode"] = config.ResultOverflowMode
+	}
+
+	// readonly=1 also forbids changing any other setting, and every query
+	// carries at least log_comment, so readonly=2 is needed. It still
+	// forbids writes, and validateReadOnlyQuery keeps queries from lifting
+	// the limits above in their own SETTINGS clause.
+	settings["readonly"] = 2
+	return settings
+}
+
+// describeQueryError turns a query error into a message for the MCP client,
+// distinguishing server-side refusals from ordinary query failures.
+func describeQueryError(err error) string {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		switch exception.Code {
+		case chErrReadonly:
+			return "Query blocked by server read-only mode: " + exception.Message
+		case chErrTooManyRowsOrBytes:
+			return "Query exceeded the configured result limits (max_result_rows/max_result_bytes): " + exception.Message
+		case chErrMemoryLimitExceeded:
+			return "Query exceeded the configured memory limit (max_memory_usage): " + exception.Message
+		case chErrTimeoutExceeded:
+			return "Query exceeded the configured execution time limit (max_execution_time): " + exception.Message
+		}
 	}
+	return "Query execution failed: " + err.Error()
+}
+
+// queryColumn describes a result column.
+type queryColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// queryResult holds the scanned rows of a query together with execution metadata.
+type queryResult struct {
+	Columns   []queryColumn
+	Rows      [][]interface{}
+	Limit     int
+	Truncated bool
+	Elapsed   time.Duration
+	RowsRead  uint64
+	BytesRead uint64
+	// QueryID and LogComment tag the query in system.query_log.
+	QueryID    string
+	LogComment string
+	// Offset is the number of rows skipped before the first row, and
+	// NextCursor continues the result after the last one.
+	Offset     int
+	NextCursor string
+}
+
+// queryError is a failed query, with the tags it has in system.query_log.
+type queryError struct {
+	QueryID    string
+	LogComment string
+	Err        error
+}
+
+func (e *queryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.Err
+}
+
+// queryLogComment describes the tool call of ctx for the log_comment setting,
+// so that queries in system.query_log can be traced back to the MCP client and
+// session that ran them.
+func queryLogComment(ctx context.Context) string {
+	comment := struct {
+		App string `json:"app"`
+		*toolCall
+	}{App: "local-mcp", toolCall: toolCallFromContext(ctx)}
+	data, err := json.Marshal(comment)
+	if err != nil {
+		return "local-mcp"
+	}
+	return string(data)
+}
+
+// executeQuery runs query unchanged and reads at most limit rows from the
+// result stream. The query text is never rewritten, so LIMIT BY, UNION ALL,
+// SETTINGS and FORMAT clauses keep their meaning. Once the limit is exceeded
+// the query is cancelled on the server instead of draining the remaining rows.
+//
+// The server's progress packets are forwarded as progress notifications when
+// the client asked for them. Every query gets a generated query ID and a
+// log_comment naming the tool call; failures are returned as *queryError. If
+// ctx is cancelled, the query is also killed by its query ID, in case the
+// server has not yet noticed the dropped connection.
+func executeQuery(ctx context.Context, conn driver.Conn, query string, limit int) (*queryResult, error) {
+	return executeQueryPage(ctx, conn, query, limit, 0)
+}
+
+// executeQueryPage is executeQuery skipping the first offset rows of the
+// result, with the offset setting, which adds to the query's own OFFSET.
+func executeQueryPage(ctx context.Context, conn driver.Conn, query string, limit, offset int) (*queryResult, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	queryID := uuid.NewString()
+	logComment := queryLogComment(parent)
+	auditQuery(parent, queryID)
+	var rowsRead, bytesRead, totalRows atomic.Uint64
+	settings := clickhouse.Settings{"log_comment": logComment}
+	if offset > 0 {
+		settings["offset"] = offset
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithQueryID(queryID), clickhouse.WithSettings(settings), clickhouse.WithProgress(func(p *clickhouse.Progress) {
+		rows := rowsRead.Add(p.Rows)
+		bytes := bytesRead.Add(p.Bytes)
+		total := totalRows.Add(p.TotalRows)
+		reportProgress(parent, float64(rows), float64(total), fmt.Sprintf("Read %d rows, %s in %s",
+			rows, formatBytes(bytes), time.Since(start).Round(time.Millisecond)))
+	}))
 
 	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		return "", fmt.Errorf("query execution failed: %w", err)
+		if parent.Err() != nil {
+			killQuery(conn, queryID)
+		}
+		return nil, &queryError{QueryID: queryID, LogComment: logComment, Err: fmt.Errorf("query execution failed: %w", err)}
 	}
-	defer rows.Close()
+	result, err := collectQueryResult(rows, limit)
+	if err != nil || result.Truncated {
+		// Closing the rows would otherwise read the whole remaining result.
+		cancel()
+	}
+	_ = rows.Close()
+	if parent.Err() != nil {
+		killQuery(conn, queryID)
+	}
+	if err != nil {
+		return nil, &queryError{QueryID: queryID, LogComment: logComment, Err: err}
+	}
+	auditRows(parent, len(result.Rows))
+	result.Elapsed = time.Since(start)
+	result.RowsRead = rowsRead.Load()
+	result.BytesRead = bytesRead.Load()
+	result.QueryID = queryID
+	result.LogComment = logComment
+	result.Offset = offset
 
-	return formatQueryResults(rows, limit)
+	return result, nil
 }
 
-func formatQueryResults(rows driver.Rows, limit int) (string, error) {
+// tagQuery returns ctx set up to run a single query directly on a connection
+// with a generated query ID and the log_comment of the tool call, as
+// executeQuery does, so that metadata lookups do not show up in
+// system.query_log as anonymous traffic. The query ID is returned.
+func tagQuery(ctx context.Context) (context.Context, string) {
+	queryID := uuid.NewString()
+	auditQuery(ctx, queryID)
+	return clickhouse.Context(ctx, clickhouse.WithQueryID(queryID),
+		clickhouse.WithSettings(clickhouse.Settings{"log_comment": queryLogComment(ctx)})), queryID
+}
+
+// killQuery asks the server to stop a query. It is best effort: the query may
+// already have finished, or the server may be unreachable.
+func killQuery(conn driver.Conn, queryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), killQueryTimeout)
+	defer cancel()
+	_ = conn.Exec(ctx, "KILL QUERY WHERE query_id = ? ASYNC", queryID)
+}
+
+// collectQueryResult scans up to limit rows. Truncated is set if more rows were available.
+func collectQueryResult(rows driver.Rows, limit int) (*queryResult, error) {
 	columnTypes := rows.ColumnTypes()
-	columnNames := make([]string, len(columnTypes))
+	result := &queryResult{
+		Columns: make([]queryColumn, len(columnTypes)),
+		Limit:   limit,
+	}
 	for i, col := range columnTypes {
-		columnNames[i] = col.Name()
+		result.Columns[i] = queryColumn{Name: col.Name(), Type: col.DatabaseTypeName()}
 	}
 
-	var result strings.Builder
-	result.WriteString("Query Results:\n\n")
-
-	// Write header
-	result.WriteString(strings.Join(columnNames, " | "))
-	result.WriteString("\n")
-	result.WriteString(strings.Repeat("-", len(strings.Join(columnNames, " | "))))
-	result.WriteString("\n")
-
-	rowCount := 0
 	for rows.Next() {
-		if rowCount >= limit {
+		if len(result.Rows) >= limit {
+			result.Truncated = true
 			break
 		}
 
 		values := createValueSlice(columnTypes)
 		if err := rows.Scan(values...); err != nil {
-			return "", fmt.Errorf("failed to scan row: %w", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-
-		stringValues := convertValuesToStrings(values)
-		result.WriteString(strings.Join(stringValues, " | "))
-		result.WriteString("\n")
-		rowCount++
+		result.Rows = append(result.Rows, values)
 	}
 
 	if err := rows.Err(); err != nil {
-		return "", fmt.Errorf("error iterating rows: %w", err)
-	}
-
-	if rowCount == 0 {
-		result.WriteString("No rows returned.\n")
-	} else {
-		result.WriteString(fmt.Sprintf("\nTotal rows: %d", rowCount))
-		if rowCount >= limit {
-			result.WriteString(fmt.Sprintf(" (limited to %d)", limit))
-		}
-		result.WriteString("\n")
-	}
-
-	return result.String(), nil
-}
-
-func createValueSlice(columnTypes []driver.ColumnType) []interface{} {
-	values := make([]interface{}, len(columnTypes))
-	for i, colType := range columnTypes {
-		switch colType.DatabaseTypeName() {
-		case "UInt8":
-			values[i] = new(uint8)
-		case "UInt16":
-			values[i] = new(uint16)
-		case "UInt32":
-			values[i] = new(uint32)
-		case "UInt64":
-			values[i] = new(uint64)
-		case "Int8":
-			values[i] = new(int8)
-		case "Int16":
-			values[i] = new(int16)
-		case "Int32":
-			values[i] = new(int32)
-		case "Int64":
-			values[i] = new(int64)
-		case "Float32":
-			values[i] = new(float32)
-		case "Float64":
-			values[i] = new(float64)
-		case "String", "FixedString":
-			values[i] = new(string)
-		case "Date", "DateTime", "DateTime64":
-			values[i] = new(time.Time)
-		default:
-			values[i] = new(string)
-		}
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
-	return values
-}
 
-func convertValuesToStrings(values []interface{}) []string {
-	stringValues := make([]string, len(values))
-	for i, val := range values {
-		if val == nil {
-			stringValues[i] = "NULL"
-			continue
-		}
-
-		switch v := val.(type) {
-		case *uint8:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *uint16:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *uint32:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *uint64:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *int8:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *int16:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *int32:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *int64:
-			stringValues[i] = fmt.Sprintf("%d", *v)
-		case *float32:
-			stringValues[i] = fmt.Sprintf("%g", *v)
-		case *float64:
-			stringValues[i] = fmt.Sprintf("%g", *v)
-		case *string:
-			stringValues[i] = *v
-		case *time.Time:
-			stringValues[i] = v.Format("2006-01-02 15:04:05")
-		default:
-			stringValues[i] = fmt.Sprintf("%v", val)
-		}
-	}
-	return stringValues
+	return result, nil
 }
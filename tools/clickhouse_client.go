@@ -0,0 +1,285 @@
+package tools
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"go.uber.org/fx"
+)
+
+var errClickHouseNotConfigured = errors.New("ClickHouse configuration not found in environment variables")
+
+// clickHouseConnectError wraps failures to open or ping a ClickHouse connection,
+// so handlers can tell them apart from query failures.
+type clickHouseConnectError struct {
+	Err error
+}
+
+func (e *clickHouseConnectError) Error() string {
+	return "failed to connect to ClickHouse: " + e.Err.Error()
+}
+
+func (e *clickHouseConnectError) Unwrap() error {
+	return e.Err
+}
+
+// clickHouseConfigError reports an invalid configuration or an unknown
+// connection profile.
+type clickHouseConfigError struct {
+	Err error
+}
+
+func (e *clickHouseConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *clickHouseConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ClickHouseClient owns one long-lived connection pool per connection profile,
+// shared by all ClickHouse tools. Pools are opened on first use and closed
+// when the fx app stops.
+type ClickHouseClient struct {
+	profiles *clickHouseProfiles
+	loadErr  error
+	pools    map[string]*clickHousePool
+}
+
+// clickHousePool is the lazily opened connection of a single profile.
+type clickHousePool struct {
+	config ClickHouseConfig
+
+	mu   sync.Mutex
+	conn driver.Conn
+}
+
+// NewClickHouseClient creates the shared ClickHouse client from the configured
+// profiles and registers its shutdown with the fx lifecycle.
+func NewClickHouseClient(lc fx.Lifecycle) *ClickHouseClient {
+	profiles, err := loadClickHouseProfiles()
+	client := newClickHouseClient(profiles)
+	client.loadErr = err
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return client.Close()
+		},
+	})
+	return client
+}
+
+func newClickHouseClient(profiles *clickHouseProfiles) *ClickHouseClient {
+	client := &ClickHouseClient{
+		profiles: profiles,
+		pools:    map[string]*clickHousePool{},
+	}
+	if profiles != nil {
+		for name, config := range profiles.configs {
+			client.pools[name] = &clickHousePool{config: *config}
+		}
+	}
+	return client
+}
+
+// Profiles returns the names of all configured connection profiles, sorted.
+func (c *ClickHouseClient) Profiles() []string {
+	if c.profiles == nil {
+		return nil
+	}
+	return c.profiles.names
+}
+
+// AllowedProfiles returns the profiles the caller of ctx may use.
+func (c *ClickHouseClient) AllowedProfiles(ctx context.Context) []string {
+	caller := callerFromContext(ctx)
+	if caller == nil {
+		return c.Profiles()
+	}
+	var names []string
+	for _, name := range c.Profiles() {
+		if caller.AllowsConnection(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// DefaultProfile returns the profile used when a tool call names none.
+func (c *ClickHouseClient) DefaultProfile() string {
+	if c.profiles == nil {
+		return ""
+	}
+	return c.profiles.defaultProfile
+}
+
+// Config returns the configuration of profile, or of the default profile if
+// profile is empty.
+func (c *ClickHouseClient) Config(profile string) (*ClickHouseConfig, error) {
+	pool, err := c.pool(profile)
+	if err != nil {
+		return nil, err
+	}
+	config := pool.config
+	return &config, nil
+}
+
+// Do runs fn with the connection of profile. If fn fails because the
+// connection is broken, the pool is reopened and fn is retried once.
+func (c *ClickHouseClient) Do(ctx context.Context, profile string, fn func(conn driver.Conn) error) error {
+	if err := c.authorize(ctx, profile); err != nil {
+		return err
+	}
+	pool, err := c.pool(profile)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		profile = c.DefaultProfile()
+	}
+	auditConnection(ctx, profile)
+	return pool.do(ctx, fn)
+}
+
+// authorize checks that the caller of ctx, if any, may use profile.
+func (c *ClickHouseClient) authorize(ctx context.Context, profile string) error {
+	caller := callerFromContext(ctx)
+	if caller == nil {
+		return nil
+	}
+	if profile == "" {
+		profile = c.DefaultProfile()
+	}
+	if !caller.AllowsConnection(profile) {
+		return &clickHouseConfigError{Err: fmt.Errorf("connection profile %q is not permitted for caller %s", profile, caller.Name)}
+	}
+	return nil
+}
+
+// Close closes every opened connection pool.
+func (c *ClickHouseClient) Close() error {
+	var errs []error
+	for _, pool := range c.pools {
+		errs = append(errs, pool.close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ClickHouseClient) pool(profile string) (*clickHousePool, error) {
+	if c.loadErr != nil {
+		return nil, &clickHouseConfigError{Err: fmt.Errorf("invalid ClickHouse configuration: %w", c.loadErr)}
+	}
+	if len(c.pools) == 0 {
+		return nil, errClickHouseNotConfigured
+	}
+	if profile == "" {
+		profile = c.DefaultProfile()
+	}
+
+	pool, ok := c.pools[profile]
+	if !ok {
+		return nil, &clickHouseConfigError{Err: fmt.Errorf("unknown connection profile %q (available: %s)",
+			profile, strings.Join(c.Profiles(), ", "))}
+	}
+	return pool, nil
+}
+
+func (c *ClickHouseClient) query(ctx context.Context, profile, query string, limit int) (*queryResult, error) {
+	return c.queryPage(ctx, profile, query, limit, 0)
+}
+
+// queryPage runs query on profile, skipping the first offset rows.
+func (c *ClickHouseClient) queryPage(ctx context.Context, profile, query string, limit, offset int) (*queryResult, error) {
+	var result *queryResult
+	err := c.Do(ctx, profile, func(conn driver.Conn) error {
+		var err error
+		result, err = executeQueryPage(ctx, conn, query, limit, offset)
+		return err
+	})
+	return result, err
+}
+
+// open returns the pool's connection, dialing it on first use.
+func (p *clickHousePool) open(ctx context.Context) (driver.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		return p.conn, nil
+	}
+
+	conn, err := connectToClickHouse(ctx, p.config)
+	if err != nil {
+		return nil, &clickHouseConnectError{Err: err}
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+func (p *clickHousePool) do(ctx context.Context, fn func(conn driver.Conn) error) error {
+	conn, err := p.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(conn)
+	if err == nil || ctx.Err() != nil || !isConnectionError(err) {
+		return err
+	}
+
+	p.discard(conn)
+	conn, err = p.open(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (p *clickHousePool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// discard drops conn so that the next call reconnects. It is a no-op if conn
+// has already been replaced by a concurrent caller.
+func (p *clickHousePool) discard(conn driver.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != conn {
+		return
+	}
+	_ = p.conn.Close()
+	p.conn = nil
+}
+
+// isConnectionError reports whether err indicates a broken connection rather
+// than a failed query.
+func isConnectionError(err error) bool {
+	if errors.Is(err, sqldriver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"bad conn", sqldriver.ErrBadConn, true},
+		{"wrapped EOF", fmt.Errorf("read: %w", io.EOF), true},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true},
+		{"net op error", &net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{"query error", errors.New("code: 60, message: Table does not exist"), false},
+		{"context canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := isConnectionError(tt.err)
+			if result != tt.expected {
+				t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClickHouseClientNotConfigured(t *testing.T) {
+	client := newClickHouseClient(nil)
+
+	if _, err := client.Config(""); !errors.Is(err, errClickHouseNotConfigured) {
+		t.Errorf("Config() error = %v, want %v", err, errClickHouseNotConfigured)
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Close() on unopened client returned error: %v", err)
+	}
+
+	result := clickHouseSchemasHandler(client)(context.Background(), map[string]interface{}{})
+	if result.IsError == nil || !*result.IsError {
+		t.Error("Expected error result when ClickHouse is not configured")
+	}
+}
+
+func TestClickHouseClientUnknownProfile(t *testing.T) {
+	client := newClickHouseClient(&clickHouseProfiles{
+		names:          []string{"prod", "staging"},
+		configs:        map[string]*ClickHouseConfig{"prod": {Host: "prod"}, "staging": {Host: "staging"}},
+		defaultProfile: "prod",
+	})
+
+	config, err := client.Config("")
+	if err != nil || config.Host != "prod" {
+		t.Errorf("Config(\"\") = %v, %v, want default profile", config, err)
+	}
+
+	_, err = client.Config("analytics")
+	var configErr *clickHouseConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Config(\"analytics\") error = %v, want *clickHouseConfigError", err)
+	}
+	expected := `unknown connection profile "analytics" (available: prod, staging)`
+	if err.Error() != expected {
+		t.Errorf("Config(\"analytics\") error = %q, want %q", err.Error(), expected)
+	}
+}
+
+func TestClickHouseQueryHandlerValidation(t *testing.T) {
+	handler := clickHouseQueryHandler(newClickHouseClient(nil))
+	ctx := context.Background()
+
+	invalidArgs := []map[string]interface{}{
+		{},
+		{"query": ""},
+		{"query": 123},
+		{"query": "DROP TABLE users"},
+	}
+
+	for _, args := range invalidArgs {
+		result := handler(ctx, args)
+		if result.IsError == nil || !*result.IsError {
+			t.Errorf("Expected error result for args %v", args)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+const (
+	completionTimeout  = 5 * time.Second
+	completionCacheTTL = 30 * time.Second
+	// maxCompletionValues is the most values a completion may return per the MCP spec.
+	maxCompletionValues = 100
+)
+
+// ClickHouseCompleter completes connection, database, table and column
+// arguments from the metadata of a connection profile. Metadata is cached
+// per profile, briefly, so that completing as the user types does not query
+// the server on every keystroke.
+type ClickHouseCompleter struct {
+	client *ClickHouseClient
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]completionCacheEntry
+}
+
+type completionCacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// NewClickHouseCompleter creates the completer shared by prompts and resource templates.
+func NewClickHouseCompleter(client *ClickHouseClient) *ClickHouseCompleter {
+	return &ClickHouseCompleter{
+		client: client,
+		ttl:    completionCacheTTL,
+		now:    time.Now,
+		cache:  map[string]completionCacheEntry{},
+	}
+}
+
+// promptMux completes prompt arguments with the request context, which the
+// library does not pass to per-prompt completers. The context carries the
+// caller, whose connection scope limits what may be completed.
+type promptMux struct {
+	fxctx.PromptMux
+	completer *ClickHouseCompleter
+}
+
+// DecoratePromptMux completes the arguments of every prompt with completer.
+func DecoratePromptMux(mux fxctx.PromptMux, completer *ClickHouseCompleter) fxctx.PromptMux {
+	return &promptMux{PromptMux: mux, completer: completer}
+}
+
+func (m *promptMux) Complete(ctx context.Context, req *mcp.CompleteRequest, name string) (*mcp.CompleteResult, error) {
+	for _, prompt := range m.ListPrompts(ctx) {
+		if prompt.Name == name {
+			ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+			defer cancel()
+			// A completion request carries a single argument, so the
+			// prompt's connection is not known and metadata comes from
+			// the default profile.
+			return m.completer.Complete(ctx, "", req.Params.Argument.Name, req.Params.Argument.Value)
+		}
+	}
+	return m.PromptMux.Complete(ctx, req, name)
+}
+
+// Complete returns the values of the named argument that start with value.
+// Arguments other than connection, database, table and column complete to nothing.
+//
+// Databases, tables and columns come from profile; if it is empty, from the
+// default profile, or for a caller not allowed to use that, from the only
+// profile the caller may use. Tables complete as database.table, or as a bare
+// name in the profile's database. Columns complete as column, table.column or
+// database.table.column, depending on how much of the qualified name has been
+// typed.
+func (c *ClickHouseCompleter) Complete(ctx context.Context, profile, argument, value string) (*mcp.CompleteResult, error) {
+	if argument == "connection" {
+		return completionResult(filterByPrefix(c.client.AllowedProfiles(ctx), value)), nil
+	}
+	if argument != "database" && argument != "table" && argument != "column" {
+		return completionResult([]string{}), nil
+	}
+
+	// Cached metadata must not bypass the caller's connection scope.
+	profile, err := c.completionProfile(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	switch argument {
+	case "database":
+		candidates, err = c.cached(ctx, profile, "databases", "SELECT name FROM system.databases ORDER BY name")
+	case "table":
+		candidates, err = c.tableCandidates(ctx, profile)
+	case "column":
+		candidates, err = c.columnCandidates(ctx, profile, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return completionResult(filterByPrefix(candidates, value)), nil
+}
+
+// completionProfile resolves the profile metadata is completed from and checks
+// that the caller of ctx may use it.
+func (c *ClickHouseCompleter) completionProfile(ctx context.Context, profile string) (string, error) {
+	if profile == "" {
+		profile = c.client.DefaultProfile()
+		if allowed := c.client.AllowedProfiles(ctx); c.client.authorize(ctx, profile) != nil && len(allowed) == 1 {
+			profile = allowed[0]
+		}
+	}
+	if err := c.client.authorize(ctx, profile); err != nil {
+		return "", err
+	}
+	return profile, nil
+}
+
+func (c *ClickHouseCompleter) tableCandidates(ctx context.Context, profile string) ([]string, error) {
+	config, err := c.client.Config(profile)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := c.cached(ctx, profile, "tables", `SELECT concat(database, '.', name)
+FROM system.tables
+WHERE NOT is_temporary AND database NOT IN ('system', 'INFORMATION_SCHEMA', 'information_schema')
+ORDER BY database, name`)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if name, ok := strings.CutPrefix(table, config.Database+"."); ok {
+			candidates = append(candidates, name)
+		}
+	}
+	return append(candidates, tables...), nil
+}
+
+func (c *ClickHouseCompleter) columnCandidates(ctx context.Context, profile, value string) ([]string, error) {
+	config, err := c.client.Config(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(value, ".")
+	switch len(parts) {
+	case 1:
+		return c.cached(ctx, profile, "columns:"+config.Database,
+			"SELECT DISTINCT name FROM system.columns WHERE database = ? ORDER BY name", config.Database)
+	case 2:
+		return c.qualifiedColumns(ctx, profile, parts[0]+".", config.Database, parts[0])
+	default:
+		return c.qualifiedColumns(ctx, profile, parts[0]+"."+parts[1]+".", parts[0], parts[1])
+	}
+}
+
+// qualifiedColumns returns the columns of database.table prefixed with qualifier.
+func (c *ClickHouseCompleter) qualifiedColumns(ctx context.Context, profile, qualifier, database, table string) ([]string, error) {
+	columns, err := c.cached(ctx, profile, "columns:"+database+"."+table,
+		"SELECT name FROM system.columns WHERE database = ? AND table = ? ORDER BY position", database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]string, len(columns))
+	for i, column := range columns {
+		candidates[i] = qualifier + column
+	}
+	return candidates, nil
+}
+
+// cached runs query on profile, reusing the result for the cache TTL.
+func (c *ClickHouseCompleter) cached(ctx context.Context, profile, key, query string, args ...any) ([]string, error) {
+	now := c.now()
+	key = profile + "/" + key
+
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.values, nil
+	}
+
+	values, err := selectStrings(ctx, c.client, profile, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, k)
+		}
+	}
+	c.cache[key] = completionCacheEntry{values: values, expires: now.Add(c.ttl)}
+	return values, nil
+}
+
+// selectStrings returns the first column of query, which must be a String.
+func selectStrings(ctx context.Context, client *ClickHouseClient, profile, query string, args ...any) ([]string, error) {
+	var values []string
+	err := client.Do(ctx, profile, func(conn driver.Conn) error {
+		values = nil
+		queryCtx, _ := tagQuery(ctx)
+		rows, err := conn.Query(queryCtx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		return rows.Err()
+	})
+	return values, err
+}
+
+// filterByPrefix keeps the values starting with prefix, ignoring case.
+func filterByPrefix(values []string, prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	matches := []string{}
+	for _, v := range values {
+		if strings.HasPrefix(strings.ToLower(v), prefix) {
+			matches = append(matches, v)
+		}
+	}
+	return matches
+}
+
+// completionResult caps values at the protocol limit, reporting the total.
+func completionResult(values []string) *mcp.CompleteResult {
+	total := len(values)
+	if total > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return &mcp.CompleteResult{
+		Completion: mcp.CompleteResultCompletion{
+			Values:  values,
+			Total:   ptr(total),
+			HasMore: ptr(total > len(values)),
+		},
+	}
+}
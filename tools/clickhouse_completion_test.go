@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestCompleter(t *testing.T) (*ClickHouseCompleter, *time.Time) {
+	t.Helper()
+	client := newClickHouseClient(&clickHouseProfiles{
+		names: []string{"default", "prod"},
+		// Nothing listens on port 1, so a cache miss fails fast.
+		configs: map[string]*ClickHouseConfig{
+			"default": {Host: "127.0.0.1", Port: 1, Database: "main"},
+			"prod":    {Host: "127.0.0.1", Port: 1, Database: "sales"},
+		},
+		defaultProfile: "default",
+	})
+	t.Cleanup(func() { _ = client.Close() })
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	completer := NewClickHouseCompleter(client)
+	completer.now = func() time.Time { return now }
+
+	expires := now.Add(completer.ttl)
+	completer.cache = map[string]completionCacheEntry{
+		"default/databases":           {values: []string{"main", "metrics", "logs"}, expires: expires},
+		"default/tables":              {values: []string{"logs.access", "main.events", "main.users"}, expires: expires},
+		"default/columns:main":        {values: []string{"event_time", "id", "user_id"}, expires: expires},
+		"default/columns:main.events": {values: []string{"event_time", "user_id"}, expires: expires},
+		"default/columns:logs.access": {values: []string{"ts", "url"}, expires: expires},
+		"prod/databases":              {values: []string{"sales"}, expires: expires},
+		"prod/tables":                 {values: []string{"sales.orders"}, expires: expires},
+	}
+	return completer, &now
+}
+
+func TestClickHouseCompleter_Complete(t *testing.T) {
+	completer, _ := newTestCompleter(t)
+
+	tests := []struct {
+		argument string
+		value    string
+		expected []string
+	}{
+		{"connection", "", []string{"default", "prod"}},
+		{"database", "M", []string{"main", "metrics"}},
+		{"table", "", []string{"events", "users", "logs.access", "main.events", "main.users"}},
+		{"table", "ev", []string{"events"}},
+		{"table", "logs.", []string{"logs.access"}},
+		{"column", "user", []string{"user_id"}},
+		{"column", "events.e", []string{"events.event_time"}},
+		{"column", "logs.access.", []string{"logs.access.ts", "logs.access.url"}},
+		{"question", "x", []string{}},
+	}
+
+	for _, test := range tests {
+		result, err := completer.Complete(context.Background(), "", test.argument, test.value)
+		if err != nil {
+			t.Errorf("Complete(%s, %q) returned error: %v", test.argument, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Completion.Values, test.expected) {
+			t.Errorf("Complete(%s, %q) = %v, want %v", test.argument, test.value, result.Completion.Values, test.expected)
+		}
+	}
+}
+
+func TestClickHouseCompleter_Profiles(t *testing.T) {
+	completer, _ := newTestCompleter(t)
+	prodOnly := withCaller(context.Background(), &Caller{Name: "ci", Connections: []string{"prod"}})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		profile  string
+		argument string
+		expected []string
+	}{
+		{"named profile", context.Background(), "prod", "table", []string{"orders", "sales.orders"}},
+		{"caller's only profile", prodOnly, "", "database", []string{"sales"}},
+		{"caller's named profile", prodOnly, "prod", "table", []string{"orders", "sales.orders"}},
+	}
+	for _, test := range tests {
+		result, err := completer.Complete(test.ctx, test.profile, test.argument, "")
+		if err != nil {
+			t.Errorf("%s: Complete() returned error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Completion.Values, test.expected) {
+			t.Errorf("%s: Complete() = %v, want %v", test.name, result.Completion.Values, test.expected)
+		}
+	}
+
+	if _, err := completer.Complete(prodOnly, "default", "database", ""); err == nil {
+		t.Error("Expected completing from a profile the caller may not use to be refused")
+	}
+	both := withCaller(context.Background(), &Caller{Name: "ops", Connections: []string{"default", "prod"}})
+	if result, err := completer.Complete(both, "", "database", "m"); err != nil || !reflect.DeepEqual(result.Completion.Values, []string{"main", "metrics"}) {
+		t.Errorf("Complete() for a caller of several profiles = %v, %v, want the default profile's databases", result, err)
+	}
+}
+
+func TestClickHouseCompleter_CacheExpires(t *testing.T) {
+	completer, now := newTestCompleter(t)
+
+	*now = now.Add(completer.ttl - time.Second)
+	if _, err := completer.Complete(context.Background(), "", "database", ""); err != nil {
+		t.Fatalf("Complete() before expiry returned error: %v", err)
+	}
+
+	// After the TTL the completer must query the server again, which is unreachable here.
+	*now = now.Add(2 * time.Second)
+	if _, err := completer.Complete(context.Background(), "", "database", ""); err == nil {
+		t.Error("Expected an expired cache entry to be refreshed from the server")
+	}
+}
+
+func TestCompletionResult_Capped(t *testing.T) {
+	values := make([]string, 150)
+	for i := range values {
+		values[i] = fmt.Sprintf("t%03d", i)
+	}
+
+	result := completionResult(values)
+	if len(result.Completion.Values) != maxCompletionValues {
+		t.Errorf("got %d values, want %d", len(result.Completion.Values), maxCompletionValues)
+	}
+	if *result.Completion.Total != 150 || !*result.Completion.HasMore {
+		t.Errorf("Total = %d, HasMore = %v, want 150, true", *result.Completion.Total, *result.Completion.HasMore)
+	}
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const connectionCheckTimeout = 5 * time.Second
+
+// connectionStatus describes a connection profile without its credentials.
+type connectionStatus struct {
+	Name      string
+	Host      string
+	Port      int
+	Database  string
+	Username  string
+	Secure    bool
+	Reachable bool
+	Latency   time.Duration
+	Err       error
+}
+
+// checkClickHouseConnections pings every profile the caller may use concurrently.
+func checkClickHouseConnections(ctx context.Context, client *ClickHouseClient) []connectionStatus {
+	names := client.AllowedProfiles(ctx)
+	statuses := make([]connectionStatus, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			statuses[i] = checkClickHouseConnection(ctx, client, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+func checkClickHouseConnection(ctx context.Context, client *ClickHouseClient, name string) connectionStatus {
+	status := connectionStatus{Name: name}
+
+	config, err := client.Config(name)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	status.Host = config.Host
+	status.Port = config.Port
+	status.Database = config.Database
+	status.Username = config.Username
+	status.Secure = config.Secure
+
+	ctx, cancel := context.WithTimeout(ctx, connectionCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status.Err = client.Do(ctx, name, func(conn driver.Conn) error {
+		return conn.Ping(ctx)
+	})
+	status.Latency = time.Since(start)
+	status.Reachable = status.Err == nil
+
+	return status
+}
+
+func formatConnectionStatuses(statuses []connectionStatus, defaultProfile string) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("ClickHouse connections (%d configured):\n\n", len(statuses)))
+
+	for _, status := range statuses {
+		name := status.Name
+		if name == defaultProfile {
+			name += " (default)"
+		}
+		result.WriteString(name + "\n")
+		result.WriteString(fmt.Sprintf("   Address: %s:%d\n", status.Host, status.Port))
+		result.WriteString(fmt.Sprintf("   Database: %s\n", status.Database))
+		result.WriteString(fmt.Sprintf("   Username: %s\n", status.Username))
+		result.WriteString(fmt.Sprintf("   Secure: %t\n", status.Secure))
+		if status.Reachable {
+			result.WriteString(fmt.Sprintf("   Status: reachable (%s)\n", status.Latency.Round(time.Millisecond)))
+		} else {
+			result.WriteString(fmt.Sprintf("   Status: unreachable (%v)\n", status.Err))
+		}
+	}
+
+	return result.String()
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// tableCost is the estimated read of one table by a query. Bytes are
+// extrapolated from the table's average row size on disk.
+type tableCost struct {
+	readEstimate
+	Bytes        uint64
+	PartitionKey string
+	PrimaryKey   string
+}
+
+// queryCostError is returned by checkQueryCost for a query whose estimated
+// read exceeds the limits of the connection profile.
+type queryCostError struct {
+	Tables   []tableCost
+	Rows     uint64
+	Bytes    uint64
+	MaxRows  int
+	MaxBytes int
+	// AllowForce is whether the force argument may be used to run the query anyway.
+	AllowForce bool
+}
+
+func (e *queryCostError) Error() string {
+	var exceeded []string
+	if e.MaxRows > 0 && e.Rows > uint64(e.MaxRows) {
+		exceeded = append(exceeded, fmt.Sprintf("%d rows (limit %d)", e.Rows, e.MaxRows))
+	}
+	if e.MaxBytes > 0 && e.Bytes > uint64(e.MaxBytes) {
+		exceeded = append(exceeded, fmt.Sprintf("%s (limit %s)", formatBytes(e.Bytes), formatBytes(uint64(e.MaxBytes))))
+	}
+
+	var msg strings.Builder
+	msg.WriteString("Query refused: it would read an estimated " + strings.Join(exceeded, " and ") + ".\n")
+	for _, table := range e.Tables {
+		msg.WriteString(fmt.Sprintf("  %s.%s: %d rows, %s in %d marks from %d parts\n",
+			table.Database, table.Table, table.Rows, formatBytes(table.Bytes), table.Marks, table.Parts))
+		if table.PartitionKey != "" {
+			msg.WriteString("    partition key: " + table.PartitionKey + "\n")
+		}
+		if table.PrimaryKey != "" {
+			msg.WriteString("    primary key: " + table.PrimaryKey + "\n")
+		}
+	}
+	msg.WriteString("Add WHERE conditions on the partition key or the leading primary key columns so that fewer parts and granules are read " +
+		"(a LIMIT does not reduce the data scanned); clickhouse-explain shows which indexes the query uses.")
+	if e.AllowForce {
+		msg.WriteString(" To run the query anyway, call it again with force set to true.")
+	}
+	return msg.String()
+}
+
+// checkQueryCost runs EXPLAIN ESTIMATE for query and returns a *queryCostError
+// if the estimated rows or bytes read exceed the limits of config. Queries the
+// estimate does not apply to (SHOW, DESCRIBE, ...) and configurations without
+// limits are not checked.
+func checkQueryCost(ctx context.Context, client *ClickHouseClient, profile, query string, config *ClickHouseConfig) error {
+	if config.MaxEstimatedRows <= 0 && config.MaxEstimatedBytes <= 0 {
+		return nil
+	}
+	if validateExplainedQuery(query) != nil {
+		return nil
+	}
+
+	result, err := client.query(ctx, profile, explainStatements[explainEstimate]+query, maxCHLimit)
+	if err != nil {
+		return err
+	}
+
+	costErr := &queryCostError{
+		MaxRows:    config.MaxEstimatedRows,
+		MaxBytes:   config.MaxEstimatedBytes,
+		AllowForce: config.AllowForce,
+	}
+	estimates := parseReadEstimates(result)
+	if config.MaxEstimatedBytes <= 0 {
+		// Table metadata is only needed to estimate bytes and to explain a refusal.
+		var rows uint64
+		for _, estimate := range estimates {
+			rows += estimate.Rows
+		}
+		if rows <= uint64(config.MaxEstimatedRows) {
+			return nil
+		}
+	}
+	err = client.Do(ctx, profile, func(conn driver.Conn) error {
+		for _, estimate := range estimates {
+			table := tableCost{readEstimate: estimate}
+			var tables []tableMetadata
+			queryCtx, _ := tagQuery(ctx)
+			if err := conn.Select(queryCtx, &tables, describeTableQuery, estimate.Database, estimate.Table); err != nil {
+				return fmt.Errorf("failed to read system.tables: %w", err)
+			}
+			if len(tables) > 0 {
+				meta := tables[0]
+				table.PartitionKey = meta.PartitionKey
+				table.PrimaryKey = meta.PrimaryKey
+				if meta.TotalRows != nil && meta.TotalBytes != nil && *meta.TotalRows > 0 {
+					table.Bytes = uint64(float64(estimate.Rows) / float64(*meta.TotalRows) * float64(*meta.TotalBytes))
+				}
+			}
+			costErr.Tables = append(costErr.Tables, table)
+			costErr.Rows += table.Rows
+			costErr.Bytes += table.Bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if (costErr.MaxRows > 0 && costErr.Rows > uint64(costErr.MaxRows)) ||
+		(costErr.MaxBytes > 0 && costErr.Bytes > uint64(costErr.MaxBytes)) {
+		return costErr
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// costConn answers EXPLAIN ESTIMATE with a read of 2 million rows of
+// default.hits, a table of 10 million rows taking 1 GiB.
+type costConn struct {
+	driver.Conn
+	queries []string
+}
+
+func (c *costConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.queries = append(c.queries, query)
+	if strings.HasPrefix(query, explainStatements[explainEstimate]) {
+		return &fakeRows{
+			columns: []fakeColumnType{{"database", "String"}, {"table", "String"}, {"parts", "UInt64"}, {"rows", "UInt64"}, {"marks", "UInt64"}},
+			data:    [][]interface{}{{"default", "hits", uint64(4), uint64(2000000), uint64(245)}},
+		}, nil
+	}
+	return &fakeRows{columns: []fakeColumnType{{"x", "UInt8"}}, data: [][]interface{}{{uint8(1)}}}, nil
+}
+
+func (c *costConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	c.queries = append(c.queries, query)
+	totalRows, totalBytes := uint64(10000000), uint64(1<<30)
+	*dest.(*[]tableMetadata) = []tableMetadata{{
+		PartitionKey: "toYYYYMM(EventDate)",
+		PrimaryKey:   "CounterID, EventDate",
+		TotalRows:    &totalRows,
+		TotalBytes:   &totalBytes,
+	}}
+	return nil
+}
+
+func TestCheckQueryCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		config      ClickHouseConfig
+		expectError bool
+		queries     int
+	}{
+		{"no limits", "SELECT * FROM hits", ClickHouseConfig{}, false, 0},
+		{"not a SELECT", "SHOW TABLES", ClickHouseConfig{MaxEstimatedRows: 1}, false, 0},
+		{"rows under limit", "SELECT * FROM hits", ClickHouseConfig{MaxEstimatedRows: 5000000}, false, 1},
+		{"rows over limit", "SELECT * FROM hits", ClickHouseConfig{MaxEstimatedRows: 1000000}, true, 2},
+		{"bytes under limit", "SELECT * FROM hits", ClickHouseConfig{MaxEstimatedBytes: 1 << 30}, false, 2},
+		{"bytes over limit", "SELECT * FROM hits", ClickHouseConfig{MaxEstimatedBytes: 100 << 20}, true, 2},
+	}
+
+	for _, test := range tests {
+		conn := &costConn{}
+		err := checkQueryCost(context.Background(), newExplainTestClient(conn), "", test.query, &test.config)
+		var costErr *queryCostError
+		if errors.As(err, &costErr) != test.expectError || (err != nil && costErr == nil) {
+			t.Errorf("%s: checkQueryCost() = %v, want error %v", test.name, err, test.expectError)
+		}
+		if len(conn.queries) != test.queries {
+			t.Errorf("%s: checkQueryCost() ran %q, want %d queries", test.name, conn.queries, test.queries)
+		}
+	}
+}
+
+func TestQueryCostError(t *testing.T) {
+	err := &queryCostError{
+		Tables: []tableCost{{
+			readEstimate: readEstimate{Database: "default", Table: "hits", Parts: 4, Rows: 2000000, Marks: 245},
+			Bytes:        214748364,
+			PartitionKey: "toYYYYMM(EventDate)",
+			PrimaryKey:   "CounterID, EventDate",
+		}},
+		Rows:       2000000,
+		Bytes:      214748364,
+		MaxRows:    1000000,
+		AllowForce: true,
+	}
+
+	expected := `Query refused: it would read an estimated 2000000 rows (limit 1000000).
+  default.hits: 2000000 rows, 204.8 MiB in 245 marks from 4 parts
+    partition key: toYYYYMM(EventDate)
+    primary key: CounterID, EventDate
+Add WHERE conditions on the partition key or the leading primary key columns so that fewer parts and granules are read ` +
+		`(a LIMIT does not reduce the data scanned); clickhouse-explain shows which indexes the query uses. ` +
+		`To run the query anyway, call it again with force set to true.`
+	if err.Error() != expected {
+		t.Errorf("queryCostError.Error() =\n%s\nwant\n%s", err.Error(), expected)
+	}
+}
+
+func TestClickHouseQueryHandler_Force(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowForce bool
+		force      bool
+		expected   string
+	}{
+		{"refused", true, false, "Query refused"},
+		{"forced", true, true, ""},
+		{"force not allowed", false, true, "not allowed"},
+	}
+
+	for _, test := range tests {
+		conn := &costConn{}
+		client := newExplainTestClient(conn)
+		client.pools["default"].config = ClickHouseConfig{MaxEstimatedRows: 1000, AllowForce: test.allowForce}
+
+		result := clickHouseQueryHandler(client)(context.Background(), map[string]interface{}{
+			"query": "SELECT * FROM hits",
+			"force": test.force,
+		})
+		text := resultText(result)
+		if test.expected == "" {
+			if result.IsError != nil && *result.IsError {
+				t.Errorf("%s: clickHouseQueryHandler() = %q, want success", test.name, text)
+			}
+			if len(conn.queries) != 1 || conn.queries[0] != "SELECT * FROM hits" {
+				t.Errorf("%s: clickHouseQueryHandler() ran %q, want only the query", test.name, conn.queries)
+			}
+		} else if !strings.Contains(text, test.expected) {
+			t.Errorf("%s: clickHouseQueryHandler() = %q, want %q", test.name, text, test.expected)
+		}
+	}
+}
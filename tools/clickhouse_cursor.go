@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// queryCursor is the position of the next page of a clickhouse-query result.
+// Pages are read by re-running the query with the offset setting, so the
+// cursor carries everything needed to do that and no state is kept on the
+// server; a cursor stays valid until the data it pages through changes.
+type queryCursor struct {
+	Query      string `json:"q"`
+	Connection string `json:"c,omitempty"`
+	Offset     int    `json:"o"`
+	Limit      int    `json:"l"`
+	Force      bool   `json:"f,omitempty"`
+}
+
+// encode returns the opaque form of the cursor handed to clients.
+func (c *queryCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeQueryCursor(value string) (*queryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("the cursor is not one returned by clickhouse-query")
+	}
+	var cursor queryCursor
+	// Cursors are not signed, so a forged page size must not get past the
+	// limit of clickhouse-query.
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Query == "" || cursor.Offset < 0 ||
+		cursor.Limit < 1 || cursor.Limit > maxCHLimit {
+		return nil, errors.New("the cursor is not one returned by clickhouse-query")
+	}
+	return &cursor, nil
+}
+
+// queryPaging tells whether a query can be paged through with cursors.
+type queryPaging struct {
+	// Limit is the query's own top-level LIMIT, or -1 if it has none.
+	Limit int
+	// Reason explains why the query cannot be paged; it is empty if it can.
+	Reason string
+}
+
+// analyzePaging checks that query returns its rows in a stable order, so that
+// re-running it with an offset continues where the previous page stopped: it
+// must be a single SELECT with a top-level ORDER BY. The query's own LIMIT,
+// which the offset setting shifts rather than respects, is returned so that
+// pages stop at it.
+func analyzePaging(query string) queryPaging {
+	if err := validateExplainedQuery(query); err != nil {
+		return queryPaging{Limit: -1, Reason: "only SELECT queries can be paged"}
+	}
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return queryPaging{Limit: -1, Reason: err.Error()}
+	}
+
+	paging := queryPaging{Limit: -1}
+	ordered := false
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		next := func(k int) sqlToken {
+			if i+k < len(tokens) {
+				return tokens[i+k]
+			}
+			return sqlToken{}
+		}
+		switch {
+		case tok.isPunct("("):
+			depth++
+		case tok.isPunct(")"):
+			depth--
+		case depth != 0:
+		case tok.is("UNION") || tok.is("INTERSECT") ||
+			(tok.is("EXCEPT") && (next(1).is("SELECT") || next(1).is("ALL") || next(1).is("DISTINCT") || (next(1).isPunct("(") && next(2).is("SELECT")))):
+			return queryPaging{Limit: -1, Reason: "queries combining SELECTs with " + tok.Text + " cannot be paged"}
+		case tok.is("ORDER") && next(1).is("BY"):
+			ordered = true
+		case tok.is("FETCH"):
+			return queryPaging{Limit: -1, Reason: "queries with FETCH cannot be paged, use LIMIT"}
+		case tok.is("LIMIT"):
+			// LIMIT n, LIMIT m, n and LIMIT n OFFSET m, unless followed by BY.
+			end := i + 2
+			if next(2).isPunct(",") || next(2).is("OFFSET") {
+				end = i + 4
+			}
+			if end < len(tokens) && (tokens[end].is("BY") || tokens[end].is("WITH")) {
+				if tokens[end].is("WITH") {
+					return queryPaging{Limit: -1, Reason: "queries with LIMIT ... WITH TIES cannot be paged"}
+				}
+				continue
+			}
+			count := next(1)
+			if next(2).isPunct(",") {
+				count = next(3)
+			}
+			n, err := strconv.Atoi(count.Text)
+			if count.Kind != tokenNumber || err != nil {
+				return queryPaging{Limit: -1, Reason: "queries whose LIMIT is not a number cannot be paged"}
+			}
+			paging.Limit = n
+			i = end - 1
+		}
+	}
+	if !ordered {
+		return queryPaging{Limit: -1, Reason: "the query has no ORDER BY, so its rows have no stable order between pages"}
+	}
+	return paging
+}
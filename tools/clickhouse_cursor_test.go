@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestAnalyzePaging(t *testing.T) {
+	tests := []struct {
+		query     string
+		limit     int
+		pageable  bool
+		reasonHas string
+	}{
+		{"SELECT * FROM hits ORDER BY EventTime", -1, true, ""},
+		{"SELECT * FROM hits ORDER BY EventTime LIMIT 5000", 5000, true, ""},
+		{"SELECT * FROM hits ORDER BY EventTime LIMIT 10, 5000", 5000, true, ""},
+		{"SELECT * FROM hits ORDER BY EventTime LIMIT 5000 OFFSET 10 SETTINGS max_threads = 1", 5000, true, ""},
+		{"SELECT * FROM hits ORDER BY k, v LIMIT 2 BY k", -1, true, ""},
+		{"SELECT * FROM hits ORDER BY k LIMIT 2 BY k LIMIT 100", 100, true, ""},
+		{"WITH t AS (SELECT * FROM hits ORDER BY x LIMIT 10) SELECT * FROM t", -1, false, "no ORDER BY"},
+		{"SELECT * EXCEPT (secret) FROM users ORDER BY id", -1, true, ""},
+		{"SELECT * FROM hits", -1, false, "no ORDER BY"},
+		{"SELECT 1 AS x UNION ALL SELECT 2 ORDER BY x", -1, false, "UNION"},
+		{"SELECT * FROM hits ORDER BY x LIMIT 10 WITH TIES", -1, false, "WITH TIES"},
+		{"SELECT * FROM hits ORDER BY x LIMIT {n:UInt32}", -1, false, "not a number"},
+		{"SHOW TABLES", -1, false, "only SELECT"},
+	}
+
+	for _, test := range tests {
+		paging := analyzePaging(test.query)
+		if paging.Limit != test.limit || (paging.Reason == "") != test.pageable || !strings.Contains(paging.Reason, test.reasonHas) {
+			t.Errorf("analyzePaging(%q) = %+v, want limit %d, pageable %v (%q)", test.query, paging, test.limit, test.pageable, test.reasonHas)
+		}
+	}
+}
+
+func TestDecodeQueryCursor(t *testing.T) {
+	cursor := &queryCursor{Query: "SELECT 1 ORDER BY 1", Connection: "prod", Offset: 100, Limit: 100}
+	decoded, err := decodeQueryCursor(cursor.encode())
+	if err != nil || *decoded != *cursor {
+		t.Errorf("decodeQueryCursor(encode(%+v)) = %+v, %v", cursor, decoded, err)
+	}
+
+	forged := []*queryCursor{
+		{Offset: 1, Limit: 100},
+		{Query: "SELECT 1 ORDER BY 1", Offset: -1, Limit: 100},
+		{Query: "SELECT 1 ORDER BY 1", Offset: 100, Limit: 0},
+		{Query: "SELECT 1 ORDER BY 1", Offset: 100, Limit: -5},
+		{Query: "SELECT 1 ORDER BY 1", Offset: 100, Limit: maxCHLimit + 1},
+		{Query: "SELECT 1 ORDER BY 1", Offset: 100, Limit: 100000000},
+	}
+	values := []string{"not base64!", "bm90IGpzb24"}
+	for _, c := range forged {
+		values = append(values, c.encode())
+	}
+	for _, value := range values {
+		if _, err := decodeQueryCursor(value); err == nil {
+			t.Errorf("decodeQueryCursor(%q) returned no error", value)
+		}
+	}
+}
+
+// pagingConn serves the numbers 0..total-1 for every query, ignoring the
+// offset setting, and records the queries run.
+type pagingConn struct {
+	driver.Conn
+	total   int
+	queries []string
+}
+
+func (c *pagingConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.queries = append(c.queries, query)
+	rows := &fakeRows{columns: []fakeColumnType{{"n", "UInt64"}}}
+	for i := 0; i < c.total; i++ {
+		rows.data = append(rows.data, []interface{}{uint64(i)})
+	}
+	return rows, nil
+}
+
+func TestClickHouseQueryHandler_Cursor(t *testing.T) {
+	conn := &pagingConn{total: 10}
+	handler := clickHouseQueryHandler(newExplainTestClient(conn))
+	query := "SELECT number FROM numbers(10) ORDER BY number LIMIT 7"
+
+	result := handler(context.Background(), map[string]interface{}{"query": query, "limit": 3.0})
+	cursor, _ := result.Meta["next_cursor"].(string)
+	if cursor == "" || len(result.Content) != 2 || !strings.Contains(resultText(&mcp.CallToolResult{Content: result.Content[1:]}), cursor) {
+		t.Fatalf("clickHouseQueryHandler() = %+v, want a next cursor in _meta and in the text", result)
+	}
+
+	// The cursor keeps the page size; the last page stops at the query's LIMIT.
+	for _, expected := range []struct {
+		offset    int
+		rows      int
+		truncated bool
+	}{{3, 3, true}, {6, 1, false}} {
+		result = handler(context.Background(), map[string]interface{}{"cursor": cursor, "format": formatJSON})
+		var doc jsonQueryResult
+		if err := json.Unmarshal([]byte(resultText(result)), &doc); err != nil {
+			t.Fatalf("clickHouseQueryHandler(cursor) = %q, want JSON: %v", resultText(result), err)
+		}
+		meta := doc.Meta
+		if meta.Offset != expected.offset || meta.Rows != expected.rows || meta.Truncated != expected.truncated || meta.Limit != 3 {
+			t.Errorf("clickHouseQueryHandler(cursor) meta = %+v, want offset %d, %d rows, truncated %v", meta, expected.offset, expected.rows, expected.truncated)
+		}
+		cursor = meta.NextCursor
+	}
+	if cursor != "" {
+		t.Errorf("clickHouseQueryHandler() on the last page returned cursor %q", cursor)
+	}
+	for _, q := range conn.queries {
+		if q != query {
+			t.Errorf("clickHouseQueryHandler() ran %q, want the query unchanged", q)
+		}
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"cursor": (&queryCursor{Query: query, Offset: 3, Limit: 3}).encode(), "query": "SELECT 1"})
+	if !strings.Contains(resultText(result), "different query") {
+		t.Errorf("clickHouseQueryHandler() with a mismatched query = %q, want an error", resultText(result))
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "SELECT number FROM numbers(10)", "limit": 3.0})
+	if _, ok := result.Meta["next_cursor"]; ok || len(result.Content) != 2 || !strings.Contains(resultText(&mcp.CallToolResult{Content: result.Content[1:]}), "no ORDER BY") {
+		t.Errorf("clickHouseQueryHandler() without ORDER BY = %+v, want no cursor and an explanation", result)
+	}
+}
@@ -0,0 +1,294 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+var errTableNotFound = errors.New("table not found")
+
+// tableDescription is the schema and storage metadata of a single table.
+type tableDescription struct {
+	Database        string              `json:"database"`
+	Name            string              `json:"name"`
+	Engine          string              `json:"engine"`
+	PartitionKey    string              `json:"partition_key,omitempty"`
+	SortingKey      string              `json:"sorting_key,omitempty"`
+	PrimaryKey      string              `json:"primary_key,omitempty"`
+	SamplingKey     string              `json:"sampling_key,omitempty"`
+	TTL             string              `json:"ttl,omitempty"`
+	Comment         string              `json:"comment,omitempty"`
+	Columns         []columnDescription `json:"columns"`
+	Storage         tableStorage        `json:"storage"`
+	CreateStatement string              `json:"create_statement"`
+	// QueryIDs are the IDs of the queries that read the metadata.
+	QueryIDs []string `json:"-"`
+}
+
+type columnDescription struct {
+	Name              string `ch:"name" json:"name"`
+	Type              string `ch:"type" json:"type"`
+	DefaultKind       string `ch:"default_kind" json:"default_kind,omitempty"`
+	DefaultExpression string `ch:"default_expression" json:"default_expression,omitempty"`
+	Codec             string `ch:"compression_codec" json:"codec,omitempty"`
+	Comment           string `ch:"comment" json:"comment,omitempty"`
+	InPartitionKey    uint8  `ch:"is_in_partition_key" json:"-"`
+	InSortingKey      uint8  `ch:"is_in_sorting_key" json:"-"`
+	InPrimaryKey      uint8  `ch:"is_in_primary_key" json:"-"`
+	// Keys lists the table keys the column is part of: partition, sorting, primary.
+	Keys []string `ch:"-" json:"keys,omitempty"`
+}
+
+// tableStorage sums the active parts of a table. Tables without parts (views,
+// Memory, Distributed, ...) report the server's total_rows/total_bytes if known.
+type tableStorage struct {
+	Rows              uint64 `ch:"rows" json:"rows"`
+	Parts             uint64 `ch:"parts" json:"parts"`
+	BytesOnDisk       uint64 `ch:"bytes_on_disk" json:"bytes_on_disk"`
+	CompressedBytes   uint64 `ch:"compressed_bytes" json:"compressed_bytes"`
+	UncompressedBytes uint64 `ch:"uncompressed_bytes" json:"uncompressed_bytes"`
+}
+
+type tableMetadata struct {
+	Engine          string  `ch:"engine"`
+	PartitionKey    string  `ch:"partition_key"`
+	SortingKey      string  `ch:"sorting_key"`
+	PrimaryKey      string  `ch:"primary_key"`
+	SamplingKey     string  `ch:"sampling_key"`
+	Comment         string  `ch:"comment"`
+	CreateStatement string  `ch:"create_table_query"`
+	TotalRows       *uint64 `ch:"total_rows"`
+	TotalBytes      *uint64 `ch:"total_bytes"`
+}
+
+const (
+	describeTableQuery = `SELECT engine, partition_key, sorting_key, primary_key, sampling_key, comment,
+       create_table_query, total_rows, total_bytes
+FROM system.tables
+WHERE database = ? AND name = ?`
+
+	describeColumnsQuery = `SELECT name, type, default_kind, default_expression, compression_codec, comment,
+       is_in_partition_key, is_in_sorting_key, is_in_primary_key
+FROM system.columns
+WHERE database = ? AND table = ?
+ORDER BY position`
+
+	describePartsQuery = `SELECT sum(rows) AS rows, count() AS parts, sum(bytes_on_disk) AS bytes_on_disk,
+       sum(data_compressed_bytes) AS compressed_bytes, sum(data_uncompressed_bytes) AS uncompressed_bytes
+FROM system.parts
+WHERE database = ? AND table = ? AND active`
+)
+
+// parseTableName splits "database.table" into its parts, using defaultDatabase
+// if the name is not qualified. Backquoted and double-quoted identifiers are unquoted.
+func parseTableName(name, defaultDatabase string) (string, string) {
+	name = strings.TrimSpace(name)
+	database, table := defaultDatabase, name
+	if i := qualifierDot(name); i >= 0 {
+		database, table = name[:i], name[i+1:]
+	}
+	return unquoteIdentifier(database), unquoteIdentifier(table)
+}
+
+// qualifierDot returns the index of the dot separating database and table,
+// ignoring dots inside quoted identifiers, or -1.
+func qualifierDot(name string) int {
+	var quote byte
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '`' || c == '"':
+			quote = c
+		case c == '.':
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteIdentifier(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '`' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// describeTable collects the metadata of database.table from the system tables.
+func describeTable(ctx context.Context, conn driver.Conn, database, table string) (*tableDescription, error) {
+	var queryIDs []string
+	tagged := func() context.Context {
+		ctx, queryID := tagQuery(ctx)
+		queryIDs = append(queryIDs, queryID)
+		return ctx
+	}
+
+	var tables []tableMetadata
+	if err := conn.Select(tagged(), &tables, describeTableQuery, database, table); err != nil {
+		return nil, fmt.Errorf("failed to read system.tables: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil, errTableNotFound
+	}
+	meta := tables[0]
+
+	desc := &tableDescription{
+		Database:        database,
+		Name:            table,
+		Engine:          meta.Engine,
+		PartitionKey:    meta.PartitionKey,
+		SortingKey:      meta.SortingKey,
+		PrimaryKey:      meta.PrimaryKey,
+		SamplingKey:     meta.SamplingKey,
+		TTL:             extractTableTTL(meta.CreateStatement),
+		Comment:         meta.Comment,
+		CreateStatement: meta.CreateStatement,
+	}
+
+	if err := conn.Select(tagged(), &desc.Columns, describeColumnsQuery, database, table); err != nil {
+		return nil, fmt.Errorf("failed to read system.columns: %w", err)
+	}
+	for i := range desc.Columns {
+		desc.Columns[i].Keys = columnKeys(desc.Columns[i])
+	}
+
+	if err := conn.QueryRow(tagged(), describePartsQuery, database, table).ScanStruct(&desc.Storage); err != nil {
+		return nil, fmt.Errorf("failed to read system.parts: %w", err)
+	}
+	if desc.Storage.Parts == 0 {
+		if meta.TotalRows != nil {
+			desc.Storage.Rows = *meta.TotalRows
+		}
+		if meta.TotalBytes != nil {
+			desc.Storage.BytesOnDisk = *meta.TotalBytes
+		}
+	}
+
+	desc.QueryIDs = queryIDs
+	return desc, nil
+}
+
+// extractTableTTL returns the table-level TTL clause of a CREATE TABLE
+// statement. Column TTLs are inside the column list and are not returned.
+func extractTableTTL(createStatement string) string {
+	tokens, err := tokenizeSQL(createStatement)
+	if err != nil {
+		return ""
+	}
+
+	depth, start, engine := 0, -1, false
+	for _, tok := range tokens {
+		switch {
+		case tok.isPunct("("):
+			depth++
+		case tok.isPunct(")"):
+			depth--
+		case depth != 0:
+		case tok.is("ENGINE"):
+			engine = true
+		case engine && start < 0 && tok.is("TTL"):
+			start = tok.Pos + len(tok.Text)
+		case start >= 0 && (tok.is("SETTINGS") || tok.is("COMMENT")):
+			return strings.TrimSpace(createStatement[start:tok.Pos])
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	return strings.TrimSpace(createStatement[start:])
+}
+
+func formatTableDescription(desc *tableDescription, format string) (string, error) {
+	if format == formatJSON {
+		data, err := json.Marshal(desc)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode JSON result: %w", err)
+		}
+		return string(data), nil
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Table: %s.%s\n", desc.Database, desc.Name))
+	output.WriteString(fmt.Sprintf("Engine: %s\n", desc.Engine))
+	writeField := func(label, value string) {
+		if value != "" {
+			output.WriteString(fmt.Sprintf("%s: %s\n", label, value))
+		}
+	}
+	writeField("Partition key", desc.PartitionKey)
+	writeField("Sorting key", desc.SortingKey)
+	writeField("Primary key", desc.PrimaryKey)
+	writeField("Sampling key", desc.SamplingKey)
+	writeField("TTL", desc.TTL)
+	writeField("Comment", desc.Comment)
+
+	storage := desc.Storage
+	output.WriteString(fmt.Sprintf("Rows: %d", storage.Rows))
+	if storage.Parts > 0 {
+		output.WriteString(fmt.Sprintf(" in %d active parts\n", storage.Parts))
+		output.WriteString(fmt.Sprintf("Size: %s compressed, %s uncompressed, %s on disk\n",
+			formatBytes(storage.CompressedBytes), formatBytes(storage.UncompressedBytes), formatBytes(storage.BytesOnDisk)))
+	} else {
+		output.WriteString("\n")
+		if storage.BytesOnDisk > 0 {
+			output.WriteString(fmt.Sprintf("Size: %s\n", formatBytes(storage.BytesOnDisk)))
+		}
+	}
+
+	output.WriteString(fmt.Sprintf("\nColumns (%d):\n", len(desc.Columns)))
+	header := "name | type | default | codec | key | comment"
+	output.WriteString(header + "\n")
+	output.WriteString(strings.Repeat("-", len(header)) + "\n")
+	for _, col := range desc.Columns {
+		defaultValue := ""
+		if col.DefaultKind != "" {
+			defaultValue = col.DefaultKind + " " + col.DefaultExpression
+		}
+		output.WriteString(strings.Join([]string{
+			col.Name, col.Type, defaultValue, col.Codec, strings.Join(col.Keys, ", "), col.Comment,
+		}, " | "))
+		output.WriteString("\n")
+	}
+
+	output.WriteString("\nCREATE statement:\n")
+	output.WriteString(desc.CreateStatement)
+	output.WriteString("\n")
+	return output.String(), nil
+}
+
+// columnKeys lists the table keys a column is part of.
+func columnKeys(col columnDescription) []string {
+	var keys []string
+	if col.InPartitionKey != 0 {
+		keys = append(keys, "partition")
+	}
+	if col.InSortingKey != 0 {
+		keys = append(keys, "sorting")
+	}
+	if col.InPrimaryKey != 0 {
+		keys = append(keys, "primary")
+	}
+	return keys
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestParseTableName(t *testing.T) {
+	tests := []struct {
+		input        string
+		wantDatabase string
+		wantTable    string
+	}{
+		{"events", "default", "events"},
+		{"analytics.events", "analytics", "events"},
+		{"`my.db`.`my table`", "my.db", "my table"},
+		{`"db"."t"`, "db", "t"},
+		{" db.t ", "db", "t"},
+	}
+
+	for _, test := range tests {
+		database, table := parseTableName(test.input, "default")
+		if database != test.wantDatabase || table != test.wantTable {
+			t.Errorf("parseTableName(%q) = %q, %q, want %q, %q",
+				test.input, database, table, test.wantDatabase, test.wantTable)
+		}
+	}
+}
+
+func TestExtractTableTTL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"CREATE TABLE db.t (`d` Date, `v` UInt64 TTL d + toIntervalDay(1)) ENGINE = MergeTree ORDER BY d TTL d + toIntervalMonth(1) SETTINGS index_granularity = 8192",
+			"d + toIntervalMonth(1)",
+		},
+		{
+			"CREATE TABLE db.t (`d` DateTime) ENGINE = MergeTree ORDER BY d TTL d + toIntervalDay(7) DELETE, d + toIntervalDay(1) TO VOLUME 'cold'",
+			"d + toIntervalDay(7) DELETE, d + toIntervalDay(1) TO VOLUME 'cold'",
+		},
+		{
+			"CREATE TABLE db.ttl (`ttl` UInt8 TTL now()) ENGINE = MergeTree ORDER BY ttl SETTINGS index_granularity = 8192",
+			"",
+		},
+		{"CREATE VIEW db.v AS SELECT 1", ""},
+	}
+
+	for _, test := range tests {
+		result := extractTableTTL(test.input)
+		if result != test.expected {
+			t.Errorf("extractTableTTL(%q) = %q, want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+
+	for _, test := range tests {
+		result := formatBytes(test.input)
+		if result != test.expected {
+			t.Errorf("formatBytes(%d) = %q, want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestFormatTableDescription(t *testing.T) {
+	desc := &tableDescription{
+		Database:     "db",
+		Name:         "events",
+		Engine:       "MergeTree",
+		PartitionKey: "toYYYYMM(d)",
+		SortingKey:   "d, id",
+		PrimaryKey:   "d, id",
+		Columns: []columnDescription{
+			{Name: "d", Type: "Date", Keys: []string{"partition", "sorting", "primary"}},
+			{Name: "id", Type: "UInt64", DefaultKind: "DEFAULT", DefaultExpression: "0", Codec: "CODEC(Delta(8), ZSTD(1))", Comment: "event id"},
+		},
+		Storage:         tableStorage{Rows: 1000, Parts: 2, BytesOnDisk: 2048, CompressedBytes: 1536, UncompressedBytes: 4096},
+		CreateStatement: "CREATE TABLE db.events (...)",
+	}
+
+	output, err := formatTableDescription(desc, formatTable)
+	if err != nil {
+		t.Fatalf("formatTableDescription() returned error: %v", err)
+	}
+	for _, want := range []string{
+		"Table: db.events\n",
+		"Partition key: toYYYYMM(d)\n",
+		"Rows: 1000 in 2 active parts\n",
+		"Size: 1.5 KiB compressed, 4.0 KiB uncompressed, 2.0 KiB on disk\n",
+		"d | Date |  |  | partition, sorting, primary | \n",
+		"id | UInt64 | DEFAULT 0 | CODEC(Delta(8), ZSTD(1)) |  | event id\n",
+		"CREATE statement:\nCREATE TABLE db.events (...)\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("formatTableDescription() output missing %q:\n%s", want, output)
+		}
+	}
+
+	output, err = formatTableDescription(desc, formatJSON)
+	if err != nil {
+		t.Fatalf("formatTableDescription(json) returned error: %v", err)
+	}
+	if !strings.Contains(output, `"keys":["partition","sorting","primary"]`) {
+		t.Errorf("formatTableDescription(json) = %s, want column keys", output)
+	}
+}
+
+// metadataConn answers the metadata queries of describeTable.
+type metadataConn struct {
+	driver.Conn
+	queries int
+}
+
+func (c *metadataConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	c.queries++
+	switch dest := dest.(type) {
+	case *[]tableMetadata:
+		*dest = []tableMetadata{{Engine: "MergeTree", CreateStatement: "CREATE TABLE db.events (id UInt64) ENGINE = MergeTree ORDER BY id"}}
+	case *[]columnDescription:
+		*dest = []columnDescription{{Name: "id", Type: "UInt64", InSortingKey: 1}}
+	}
+	return nil
+}
+
+func (c *metadataConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	c.queries++
+	return metadataRow{}
+}
+
+type metadataRow struct {
+	driver.Row
+}
+
+func (metadataRow) ScanStruct(dest any) error {
+	*dest.(*tableStorage) = tableStorage{Rows: 10, Parts: 1}
+	return nil
+}
+
+func TestClickHouseDescribeHandler_QueryIDs(t *testing.T) {
+	conn := &metadataConn{}
+	record := &AuditRecord{}
+	ctx := withAuditRecord(context.Background(), record)
+
+	result := clickHouseDescribeHandler(newExplainTestClient(conn))(ctx, map[string]interface{}{"table": "db.events"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("clickHouseDescribeHandler() = %q, want success", resultText(result))
+	}
+	queryIDs, _ := result.Meta["query_ids"].([]string)
+	if conn.queries != 3 || len(queryIDs) != 3 || !reflect.DeepEqual(queryIDs, record.QueryIDs) {
+		t.Errorf("clickHouseDescribeHandler() ran %d queries with IDs %v, audited %v, want 3 tagged queries", conn.queries, queryIDs, record.QueryIDs)
+	}
+	if !strings.Contains(resultText(result), "Query IDs: "+strings.Join(queryIDs, ", ")) || result.Meta["log_comment"] == nil {
+		t.Errorf("clickHouseDescribeHandler() = %q, %v, want the query IDs and log_comment", resultText(result), result.Meta)
+	}
+}
@@ -2,10 +2,12 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strconv"
 	"strings"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/strowk/foxy-contexts/pkg/fxctx"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
 )
@@ -17,10 +19,28 @@ const (
 	envCHUsername = "CLICKHOUSE_USERNAME"
 	envCHPassword = "CLICKHOUSE_PASSWORD"
 	envCHSecure   = "CLICKHOUSE_SECURE"
+	envCHHTTPPort = "CLICKHOUSE_HTTP_PORT"
+
+	envCHMaxExecutionTime   = "CLICKHOUSE_MAX_EXECUTION_TIME"
+	envCHMaxResultRows      = "CLICKHOUSE_MAX_RESULT_ROWS"
+	envCHMaxResultBytes     = "CLICKHOUSE_MAX_RESULT_BYTES"
+	envCHMaxMemoryUsage     = "CLICKHOUSE_MAX_MEMORY_USAGE"
+	envCHResultOverflowMode = "CLICKHOUSE_RESULT_OVERFLOW_MODE"
+	envCHSettingsProfile    = "CLICKHOUSE_SETTINGS_PROFILE"
+	envCHMaxEstimatedRows   = "CLICKHOUSE_MAX_ESTIMATED_ROWS"
+	envCHMaxEstimatedBytes  = "CLICKHOUSE_MAX_ESTIMATED_BYTES"
+	envCHAllowForce         = "CLICKHOUSE_ALLOW_FORCE"
 )
 
+// connectionProperty is the optional connection profile argument shared by all
+// ClickHouse tools.
+var connectionProperty = map[string]interface{}{
+	"type":        "string",
+	"description": "Connection profile to use (optional, uses the default profile if not specified; see clickhouse-connections)",
+}
+
 // NewClickHouseQueryTool creates a ClickHouse query tool that uses environment variables.
-func NewClickHouseQueryTool() fxctx.Tool {
+func NewClickHouseQueryTool(client *ClickHouseClient) fxctx.Tool {
 	return fxctx.NewTool(
 		&mcp.Tool{
 			Name:        "clickhouse-query",
@@ -30,7 +50,11 @@ func NewClickHouseQueryTool() fxctx.Tool {
 				Properties: map[string]map[string]interface{}{
 					"query": {
 						"type":        "string",
-						"description": "SQL query to execute against ClickHouse",
+						"description": "SQL query to execute against ClickHouse (may be omitted when cursor is given)",
+					},
+					"cursor": {
+						"type":        "string",
+						"description": "Cursor returned with a truncated result, to fetch the rows that follow it",
 					},
 					"limit": {
 						"type":        "integer",
@@ -39,32 +63,46 @@ func NewClickHouseQueryTool() fxctx.Tool {
 						"maximum":     maxCHLimit,
 						"default":     defaultCHLimit,
 					},
+					"format": {
+						"type":        "string",
+						"description": "Output format: table (default), json (columns with types, typed rows and metadata), jsonl, csv, tsv or markdown",
+						"enum":        queryFormats,
+						"default":     formatTable,
+					},
+					"force": {
+						"type":        "boolean",
+						"description": "Run the query even if its estimated cost exceeds the configured limits (only honoured where the server configuration allows it)",
+						"default":     false,
+					},
+					"connection": connectionProperty,
 				},
-				Required: []string{"query"},
+				Required: []string{},
 			},
 		},
-		clickHouseQueryHandler,
+		clickHouseQueryHandler(client),
 	)
 }
 
 // NewClickHouseSchemasTool creates a tool to list ClickHouse schemas using environment configuration.
-func NewClickHouseSchemasTool() fxctx.Tool {
+func NewClickHouseSchemasTool(client *ClickHouseClient) fxctx.Tool {
 	return fxctx.NewTool(
 		&mcp.Tool{
 			Name:        "clickhouse-schemas",
 			Description: ptr("List available databases in ClickHouse instance using environment configuration"),
 			InputSchema: mcp.ToolInputSchema{
-				Type:       "object",
-				Properties: map[string]map[string]interface{}{},
-				Required:   []string{},
+				Type: "object",
+				Properties: map[string]map[string]interface{}{
+					"connection": connectionProperty,
+				},
+				Required: []string{},
 			},
 		},
-		clickHouseSchemasHandler,
+		clickHouseSchemasHandler(client),
 	)
 }
 
 // NewClickHouseTablesTool creates a tool to list tables using environment configuration.
-func NewClickHouseTablesTool() fxctx.Tool {
+func NewClickHouseTablesTool(client *ClickHouseClient) fxctx.Tool {
 	return fxctx.NewTool(
 		&mcp.Tool{
 			Name:        "clickhouse-tables",
@@ -74,104 +112,493 @@ func NewClickHouseTablesTool() fxctx.Tool {
 				Properties: map[string]map[string]interface{}{
 					"database": {
 						"type":        "string",
-						"description": "Database name to list tables from (optional, uses env CLICKHOUSE_DATABASE if not specified)",
+						"description": "Database name to list tables from (optional, uses the connection's default database if not specified)",
 					},
+					"connection": connectionProperty,
 				},
 				Required: []string{},
 			},
 		},
-		clickHouseTablesHandler,
+		clickHouseTablesHandler(client),
 	)
 }
 
-func clickHouseQueryHandler(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
-	query, ok := args["query"].(string)
-	if !ok || strings.TrimSpace(query) == "" {
-		return errorResult("Query parameter is required and must be a non-empty string")
-	}
+// NewClickHouseDescribeTool creates a tool that describes the schema and storage of a table.
+func NewClickHouseDescribeTool(client *ClickHouseClient) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "clickhouse-describe",
+			Description: ptr("Describe a ClickHouse table: columns with types, defaults, codecs and comments, engine, partition/sorting/primary keys, TTL, row count, size on disk and the CREATE TABLE statement"),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]interface{}{
+					"table": {
+						"type":        "string",
+						"description": "Table to describe, as database.table or table (uses the connection's default database if not qualified)",
+					},
+					"format": {
+						"type":        "string",
+						"description": "Output format: table (default) or json",
+						"enum":        []string{formatTable, formatJSON},
+						"default":     formatTable,
+					},
+					"connection": connectionProperty,
+				},
+				Required: []string{"table"},
+			},
+		},
+		clickHouseDescribeHandler(client),
+	)
+}
 
-	if !isQuerySafe(query) {
-		return errorResult("Only SELECT, SHOW, and DESCRIBE queries are allowed for security reasons")
-	}
+// NewClickHouseExplainTool creates a tool that shows the plan, pipeline, index
+// usage and read estimate of a query without running it.
+func NewClickHouseExplainTool(client *ClickHouseClient) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "clickhouse-explain",
+			Description: ptr("Check the cost of a ClickHouse SELECT before running it: runs EXPLAIN PLAN, EXPLAIN PIPELINE, EXPLAIN indexes=1 and EXPLAIN ESTIMATE and summarises how many parts and granules will be read and whether the primary key and skip indexes are used"),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]interface{}{
+					"query": {
+						"type":        "string",
+						"description": "SELECT query to explain",
+					},
+					"kinds": {
+						"type":        "array",
+						"description": "EXPLAIN kinds to run (default: all)",
+						"items": map[string]interface{}{
+							"type": "string",
+							"enum": explainKindNames,
+						},
+					},
+					"format": {
+						"type":        "string",
+						"description": "Output format: table (default) or json",
+						"enum":        []string{formatTable, formatJSON},
+						"default":     formatTable,
+					},
+					"connection": connectionProperty,
+				},
+				Required: []string{"query"},
+			},
+		},
+		clickHouseExplainHandler(client),
+	)
+}
 
-	config := getClickHouseConfigFromEnv()
-	if config == nil {
-		return errorResult("ClickHouse configuration not found in environment variables. Please check your settings.")
-	}
+// NewClickHouseExportTool creates a tool that writes the result of a query to a
+// file in the export directory.
+func NewClickHouseExportTool(client *ClickHouseClient) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "clickhouse-export",
+			Description: ptr("Export the result of a ClickHouse SELECT to a local file for analysis, in Parquet, Arrow, CSV, TSV or JSONEachRow. The file is written under the configured export directory; returns its path, size, row count (for the text formats) and schema"),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]interface{}{
+					"query": {
+						"type":        "string",
+						"description": "SELECT query whose result is exported (without a FORMAT clause)",
+					},
+					"format": {
+						"type":        "string",
+						"description": "File format (default: parquet)",
+						"enum":        exportFormatNames(),
+						"default":     exportFormats[0].Name,
+					},
+					"path": {
+						"type":        "string",
+						"description": "File path relative to the export directory (default: a generated name); the format's extension is added if missing",
+					},
+					"overwrite": {
+						"type":        "boolean",
+						"description": "Replace the file if it already exists",
+						"default":     false,
+					},
+					"force": {
+						"type":        "boolean",
+						"description": "Run the query even if its estimated cost exceeds the configured limits (only honoured where the server configuration allows it)",
+						"default":     false,
+					},
+					"connection": connectionProperty,
+				},
+				Required: []string{"query"},
+			},
+		},
+		clickHouseExportHandler(client),
+	)
+}
+
+// NewClickHouseConnectionsTool creates a tool to list the configured connection profiles.
+func NewClickHouseConnectionsTool(client *ClickHouseClient) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "clickhouse-connections",
+			Description: ptr("List configured ClickHouse connection profiles and check whether each one is reachable"),
+			InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]map[string]interface{}{},
+				Required:   []string{},
+			},
+		},
+		clickHouseConnectionsHandler(client),
+	)
+}
 
-	limit := parseClickHouseLimit(args["limit"])
+func clickHouseQueryHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		query, _ := args["query"].(string)
+		profile, _ := args["connection"].(string)
+		force, _ := args["force"].(bool)
+		limit := parseClickHouseLimit(args["limit"])
+		offset := 0
 
-	conn, err := connectToClickHouse(ctx, *config)
-	if err != nil {
-		return errorResult("Failed to connect to ClickHouse: " + err.Error() + "\nPlease verify your connection settings.")
+		if value, _ := args["cursor"].(string); value != "" {
+			cursor, err := decodeQueryCursor(value)
+			if err != nil {
+				return errorResult("Invalid cursor: " + err.Error())
+			}
+			if (query != "" && query != cursor.Query) || (profile != "" && profile != cursor.Connection) {
+				return errorResult("The cursor belongs to a different query or connection; pass only the cursor to continue its result")
+			}
+			query, profile, offset = cursor.Query, cursor.Connection, cursor.Offset
+			force = force || cursor.Force
+			if args["limit"] == nil {
+				limit = cursor.Limit
+			}
+		}
+
+		if strings.TrimSpace(query) == "" {
+			return errorResult("Query parameter is required and must be a non-empty string")
+		}
+
+		if err := validateReadOnlyQuery(query); err != nil {
+			return errorResult("Query rejected for security reasons: " + err.Error())
+		}
+
+		format, err := parseQueryFormat(args["format"])
+		if err != nil {
+			return errorResult("Invalid format: " + err.Error())
+		}
+
+		config, err := client.Config(profile)
+		if err != nil {
+			return connectionErrorResult(err)
+		}
+
+		if result := costGuardResult(ctx, client, profile, query, config, force); result != nil {
+			return result
+		}
+
+		// Stop pages at the query's own LIMIT, which the offset would shift.
+		paging := analyzePaging(query)
+		pageLimit := limit
+		if paging.Limit >= 0 && paging.Limit-offset < limit {
+			pageLimit = max(paging.Limit-offset, 0)
+		}
+
+		result, err := client.queryPage(ctx, profile, query, pageLimit, offset)
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			return queryErrorResult(describeQueryError(err), err)
+		}
+		result.Limit = limit
+		if pageLimit < limit {
+			result.Truncated = false
+		}
+		if result.Truncated && paging.Reason == "" {
+			cursor := queryCursor{Query: query, Connection: profile, Offset: offset + len(result.Rows), Limit: limit, Force: force}
+			result.NextCursor = cursor.encode()
+		}
+
+		output, err := formatQueryResult(result, format)
+		if err != nil {
+			return errorResult("Failed to format results: " + err.Error())
+		}
+
+		res := querySuccessResult(output, result)
+		switch {
+		case result.NextCursor != "":
+			res.Meta["next_cursor"] = result.NextCursor
+			res.Content = append(res.Content, mcp.TextContent{
+				Type: "text",
+				Text: "More rows are available. To fetch the next page, call clickhouse-query with cursor: " + result.NextCursor,
+			})
+		case result.Truncated:
+			res.Content = append(res.Content, mcp.TextContent{
+				Type: "text",
+				Text: "More rows are available, but the result cannot be paged with a cursor: " + paging.Reason + ".",
+			})
+		}
+		return res
 	}
-	defer conn.Close()
+}
 
-	results, err := executeQuery(ctx, conn, query, limit)
-	if err != nil {
-		return errorResult("Query execution failed: " + err.Error())
+// costGuardResult applies the cost guard of config to query, returning the
+// error result if the query is refused or nil if it may run.
+func costGuardResult(ctx context.Context, client *ClickHouseClient, profile, query string, config *ClickHouseConfig, force bool) *mcp.CallToolResult {
+	if force && !config.AllowForce {
+		return errorResult("The force argument is not allowed for this connection profile (set " + envCHAllowForce + "=true to allow it)")
+	}
+	if force {
+		return nil
 	}
+	if err := checkQueryCost(ctx, client, profile, query, config); err != nil {
+		if result := connectionErrorResult(err); result != nil {
+			return result
+		}
+		var costErr *queryCostError
+		if errors.As(err, &costErr) {
+			return errorResult(costErr.Error())
+		}
+		return queryErrorResult("Failed to estimate the query cost: "+describeQueryError(err), err)
+	}
+	return nil
+}
 
-	return successResult(results)
+func clickHouseSchemasHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		profile, _ := args["connection"].(string)
+		result, err := client.query(ctx, profile, "SHOW DATABASES", maxCHLimit)
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			return queryErrorResult("Failed to list databases: "+err.Error(), err)
+		}
+
+		return querySuccessResult(formatQueryResults(result), result)
+	}
 }
 
-func clickHouseSchemasHandler(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
-	config := getClickHouseConfigFromEnv()
-	if config == nil {
-		return errorResult("ClickHouse configuration not found in environment variables. Please check your settings.")
+func clickHouseTablesHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		profile, _ := args["connection"].(string)
+		config, err := client.Config(profile)
+		if err != nil {
+			return connectionErrorResult(err)
+		}
+
+		database := config.Database
+		if db, ok := args["database"].(string); ok && db != "" {
+			database = db
+		}
+
+		query := "SHOW TABLES FROM " + quoteIdentifier(database)
+		result, err := client.query(ctx, profile, query, maxCHLimit)
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			return queryErrorResult("Failed to list tables from database '"+database+"': "+err.Error(), err)
+		}
+
+		return querySuccessResult(formatQueryResults(result), result)
 	}
+}
 
-	conn, err := connectToClickHouse(ctx, *config)
-	if err != nil {
-		return errorResult("Failed to connect to ClickHouse: " + err.Error() + "\nPlease verify your connection settings.")
+func clickHouseDescribeHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		name, ok := args["table"].(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			return errorResult("Table parameter is required and must be a non-empty string")
+		}
+
+		format, err := parseQueryFormat(args["format"])
+		if err != nil || (format != formatTable && format != formatJSON) {
+			return errorResult("Invalid format: supported formats are table and json")
+		}
+
+		profile, _ := args["connection"].(string)
+		config, err := client.Config(profile)
+		if err != nil {
+			return connectionErrorResult(err)
+		}
+
+		database, table := parseTableName(name, config.Database)
+		var desc *tableDescription
+		err = client.Do(ctx, profile, func(conn driver.Conn) error {
+			var err error
+			desc, err = describeTable(ctx, conn, database, table)
+			return err
+		})
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			if errors.Is(err, errTableNotFound) {
+				return errorResult("Table '" + database + "." + table + "' does not exist")
+			}
+			return errorResult("Failed to describe table '" + database + "." + table + "': " + err.Error())
+		}
+
+		output, err := formatTableDescription(desc, format)
+		if err != nil {
+			return errorResult("Failed to format results: " + err.Error())
+		}
+		if format == formatTable {
+			output += "\nQuery IDs: " + strings.Join(desc.QueryIDs, ", ") + "\n"
+		}
+		res := successResult(output)
+		res.Meta = queryIDsMeta(ctx, desc.QueryIDs)
+		return res
 	}
-	defer conn.Close()
+}
 
-	results, err := executeQuery(ctx, conn, "SHOW DATABASES", maxCHLimit)
-	if err != nil {
-		return errorResult("Failed to list databases: " + err.Error())
+func clickHouseExplainHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		query, ok := args["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return errorResult("Query parameter is required and must be a non-empty string")
+		}
+
+		if err := validateExplainedQuery(query); err != nil {
+			return errorResult("Query rejected for security reasons: " + err.Error())
+		}
+
+		kinds, err := parseExplainKinds(args["kinds"])
+		if err != nil {
+			return errorResult("Invalid kinds: " + err.Error())
+		}
+
+		format, err := parseQueryFormat(args["format"])
+		if err != nil || (format != formatTable && format != formatJSON) {
+			return errorResult("Invalid format: supported formats are table and json")
+		}
+
+		profile, _ := args["connection"].(string)
+		result, err := explainQuery(ctx, client, profile, query, kinds)
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			return queryErrorResult(describeQueryError(err), err)
+		}
+
+		output, err := formatExplainResult(result, format)
+		if err != nil {
+			return errorResult("Failed to format results: " + err.Error())
+		}
+		res := successResult(output)
+		res.Meta = queryIDsMeta(ctx, result.QueryIDs)
+		if len(result.Truncated) > 0 {
+			res.Meta["truncated"] = result.Truncated
+		}
+		return res
 	}
+}
+
+func clickHouseExportHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		query, ok := args["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return errorResult("Query parameter is required and must be a non-empty string")
+		}
+
+		query, err := validateExportQuery(query)
+		if err != nil {
+			return errorResult("Query rejected for security reasons: " + err.Error())
+		}
+
+		format, err := parseExportFormat(args["format"])
+		if err != nil {
+			return errorResult("Invalid format: " + err.Error())
+		}
 
-	return successResult(results)
+		root := exportDir()
+		if root == "" {
+			return errorResult("Exports are disabled: set " + envExportDir + " to the directory clickhouse-export may write to")
+		}
+
+		profile, _ := args["connection"].(string)
+		config, err := client.Config(profile)
+		if err != nil {
+			return connectionErrorResult(err)
+		}
+		// The export path is created below, before the query first reaches
+		// the connection, so the caller has to be checked up front.
+		if err := client.authorize(ctx, profile); err != nil {
+			return connectionErrorResult(err)
+		}
+
+		force, _ := args["force"].(bool)
+		if result := costGuardResult(ctx, client, profile, query, config, force); result != nil {
+			return result
+		}
+
+		name, _ := args["path"].(string)
+		overwrite, _ := args["overwrite"].(bool)
+		path, err := resolveExportPath(root, name, format.Extension, overwrite)
+		if err != nil {
+			return errorResult("Invalid path: " + err.Error())
+		}
+
+		maxSize := int64(parseEnvInt(envExportMaxSizeMB, defaultExportMaxSizeMB)) << 20
+		result, err := exportToFile(ctx, client, profile, query, format, path, maxSize)
+		if err != nil {
+			if result := connectionErrorResult(err); result != nil {
+				return result
+			}
+			return queryErrorResult(describeQueryError(err), err)
+		}
+
+		res := successResult(formatExportResult(result))
+		res.Meta = queryMeta(result.QueryID, result.LogComment)
+		res.Meta["path"] = result.Path
+		return res
+	}
 }
 
-func clickHouseTablesHandler(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
-	config := getClickHouseConfigFromEnv()
-	if config == nil {
-		return errorResult("ClickHouse configuration not found in environment variables. Please check your settings.")
+func clickHouseConnectionsHandler(client *ClickHouseClient) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		if _, err := client.Config(""); err != nil {
+			return connectionErrorResult(err)
+		}
+
+		statuses := checkClickHouseConnections(ctx, client)
+		return successResult(formatConnectionStatuses(statuses, client.DefaultProfile()))
 	}
+}
 
-	database := config.Database
-	if db, ok := args["database"].(string); ok && db != "" {
-		database = db
+// connectionErrorResult returns the error result for configuration and
+// connection failures, or nil if err is neither.
+func connectionErrorResult(err error) *mcp.CallToolResult {
+	if errors.Is(err, errClickHouseNotConfigured) {
+		return errorResult("ClickHouse configuration not found in environment variables. Please check your settings.")
 	}
 
-	conn, err := connectToClickHouse(ctx, *config)
-	if err != nil {
-		return errorResult("Failed to connect to ClickHouse: " + err.Error() + "\nPlease verify your connection settings.")
+	var configErr *clickHouseConfigError
+	if errors.As(err, &configErr) {
+		return errorResult(configErr.Error())
 	}
-	defer conn.Close()
 
-	query := "SHOW TABLES FROM " + database
-	results, err := executeQuery(ctx, conn, query, maxCHLimit)
-	if err != nil {
-		return errorResult("Failed to list tables from database '" + database + "': " + err.Error())
+	var connectErr *clickHouseConnectError
+	if errors.As(err, &connectErr) {
+		return errorResult("Failed to connect to ClickHouse: " + connectErr.Err.Error() + "\nPlease verify your connection settings.")
 	}
 
-	return successResult(results)
+	return nil
 }
 
-func getClickHouseConfigFromEnv() *ClickHouseConfig {
-	host := os.Getenv(envCHHost)
+// getClickHouseConfigFromEnv reads the connection configuration of profile from
+// the environment, or of the unnamed profile if profile is empty. It returns
+// nil if the host variable is not set.
+func getClickHouseConfigFromEnv(profile string) *ClickHouseConfig {
+	host := os.Getenv(profileEnvVar(envCHHost, profile))
 	if host == "" {
 		return nil
 	}
 
-	port := parseEnvInt(envCHPort, defaultCHPort)
-	database := getEnvOrDefault(envCHDatabase, defaultCHDatabase)
-	username := getEnvOrDefault(envCHUsername, defaultCHUsername)
-	password := os.Getenv(envCHPassword)
-	secure := parseEnvBool(envCHSecure)
+	port := parseEnvInt(profileEnvVar(envCHPort, profile), defaultCHPort)
+	database := getEnvOrDefault(profileEnvVar(envCHDatabase, profile), defaultCHDatabase)
+	username := getEnvOrDefault(profileEnvVar(envCHUsername, profile), defaultCHUsername)
+	password := os.Getenv(profileEnvVar(envCHPassword, profile))
+	secure := parseEnvBool(profileEnvVar(envCHSecure, profile))
+	httpPort := parseEnvInt(profileEnvVar(envCHHTTPPort, profile), 0)
 
 	return &ClickHouseConfig{
 		Host:     host,
@@ -180,7 +607,29 @@ func getClickHouseConfigFromEnv() *ClickHouseConfig {
 		Username: username,
 		Password: password,
 		Secure:   secure,
+		HTTPPort: httpPort,
+
+		MaxExecutionTime:   parseEnvInt(profileLimitEnvVar(envCHMaxExecutionTime, profile), defaultCHMaxExecutionTime),
+		MaxResultRows:      parseEnvInt(profileLimitEnvVar(envCHMaxResultRows, profile), 0),
+		MaxResultBytes:     parseEnvInt(profileLimitEnvVar(envCHMaxResultBytes, profile), 0),
+		MaxMemoryUsage:     parseEnvInt(profileLimitEnvVar(envCHMaxMemoryUsage, profile), 0),
+		ResultOverflowMode: parseOverflowMode(os.Getenv(profileLimitEnvVar(envCHResultOverflowMode, profile))),
+		SettingsProfile:    os.Getenv(profileLimitEnvVar(envCHSettingsProfile, profile)),
+
+		MaxEstimatedRows:  parseEnvInt(profileLimitEnvVar(envCHMaxEstimatedRows, profile), 0),
+		MaxEstimatedBytes: parseEnvInt(profileLimitEnvVar(envCHMaxEstimatedBytes, profile), 0),
+		AllowForce:        parseEnvBool(profileLimitEnvVar(envCHAllowForce, profile)),
+	}
+}
+
+// parseOverflowMode accepts the ClickHouse result_overflow_mode values and
+// ignores anything else.
+func parseOverflowMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "throw" || mode == "break" {
+		return mode
 	}
+	return ""
 }
 
 func parseEnvInt(envVar string, defaultValue int) int {
@@ -0,0 +1,347 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EXPLAIN kinds run by clickhouse-explain.
+const (
+	explainPlan     = "plan"
+	explainPipeline = "pipeline"
+	explainIndexes  = "indexes"
+	explainEstimate = "estimate"
+)
+
+var explainKindNames = []string{explainPlan, explainPipeline, explainIndexes, explainEstimate}
+
+// explainStatements prefixes the explained query for each kind. Index usage
+// is read as JSON so that it can be summarised reliably.
+var explainStatements = map[string]string{
+	explainPlan:     "EXPLAIN PLAN ",
+	explainPipeline: "EXPLAIN PIPELINE ",
+	explainIndexes:  "EXPLAIN json = 1, indexes = 1 ",
+	explainEstimate: "EXPLAIN ESTIMATE ",
+}
+
+// explainResult is the output of clickhouse-explain.
+type explainResult struct {
+	Plan     string            `json:"plan,omitempty"`
+	Pipeline string            `json:"pipeline,omitempty"`
+	Reads    []tableRead       `json:"reads,omitempty"`
+	Estimate []readEstimate    `json:"estimate,omitempty"`
+	Summary  []string          `json:"summary"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	QueryIDs []string          `json:"query_ids"`
+	// Truncated lists the kinds whose output exceeded maxCHLimit rows and
+	// was cut off.
+	Truncated []string `json:"truncated,omitempty"`
+}
+
+// tableRead is a MergeTree read in the query plan, with the indexes that
+// select its parts and granules in the order they are applied.
+type tableRead struct {
+	Table   string       `json:"table"`
+	Indexes []indexUsage `json:"indexes"`
+}
+
+type indexUsage struct {
+	Type             string   `json:"type"`
+	Name             string   `json:"name,omitempty"`
+	Description      string   `json:"description,omitempty"`
+	Keys             []string `json:"keys,omitempty"`
+	Condition        string   `json:"condition,omitempty"`
+	InitialParts     uint64   `json:"initial_parts"`
+	SelectedParts    uint64   `json:"selected_parts"`
+	InitialGranules  uint64   `json:"initial_granules"`
+	SelectedGranules uint64   `json:"selected_granules"`
+}
+
+// readEstimate is a row of EXPLAIN ESTIMATE.
+type readEstimate struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Parts    uint64 `json:"parts"`
+	Rows     uint64 `json:"rows"`
+	Marks    uint64 `json:"marks"`
+}
+
+// explainPlanNode is a node of EXPLAIN json = 1 output.
+type explainPlanNode struct {
+	NodeType    string            `json:"Node Type"`
+	Description string            `json:"Description"`
+	Indexes     []explainIndex    `json:"Indexes"`
+	Plans       []explainPlanNode `json:"Plans"`
+}
+
+type explainIndex struct {
+	Type             string   `json:"Type"`
+	Name             string   `json:"Name"`
+	Description      string   `json:"Description"`
+	Keys             []string `json:"Keys"`
+	Condition        string   `json:"Condition"`
+	InitialParts     uint64   `json:"Initial Parts"`
+	SelectedParts    uint64   `json:"Selected Parts"`
+	InitialGranules  uint64   `json:"Initial Granules"`
+	SelectedGranules uint64   `json:"Selected Granules"`
+}
+
+// parseExplainKinds validates the kinds argument, defaulting to all kinds.
+func parseExplainKinds(arg interface{}) ([]string, error) {
+	values, ok := arg.([]interface{})
+	if arg == nil || (ok && len(values) == 0) {
+		return explainKindNames, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("kinds must be an array of: %s", strings.Join(explainKindNames, ", "))
+	}
+
+	selected := map[string]bool{}
+	for _, value := range values {
+		kind, _ := value.(string)
+		kind = strings.ToLower(kind)
+		if _, ok := explainStatements[kind]; !ok {
+			return nil, fmt.Errorf("unsupported kind %v (supported: %s)", value, strings.Join(explainKindNames, ", "))
+		}
+		selected[kind] = true
+	}
+	// Keep a fixed order regardless of the order requested.
+	var kinds []string
+	for _, kind := range explainKindNames {
+		if selected[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
+
+// validateExplainedQuery checks that query passes the read-only check and is
+// a SELECT, the only statement EXPLAIN ESTIMATE and indexes apply to.
+func validateExplainedQuery(query string) error {
+	if err := validateReadOnlyQuery(query); err != nil {
+		return err
+	}
+	tokens, _ := tokenizeSQL(query)
+	for _, tok := range tokens {
+		if tok.isPunct("(") {
+			continue
+		}
+		if tok.is("SELECT") || tok.is("WITH") {
+			return nil
+		}
+		return newUnsafeQueryError(tok, "only SELECT queries can be explained")
+	}
+	return &unsafeQueryError{Reason: "query is empty"}
+}
+
+// explainQuery runs the EXPLAIN kinds for query. A kind the server cannot run
+// is reported in Errors; connection errors, and the first error when every
+// kind failed, are returned.
+func explainQuery(ctx context.Context, client *ClickHouseClient, profile, query string, kinds []string) (*explainResult, error) {
+	result := &explainResult{Errors: map[string]string{}}
+	var firstErr error
+	for _, kind := range kinds {
+		rows, err := client.query(ctx, profile, explainStatements[kind]+query, maxCHLimit)
+		if err != nil {
+			if connectionErrorResult(err) != nil || ctx.Err() != nil {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			result.Errors[kind] = describeQueryError(err)
+			continue
+		}
+		result.QueryIDs = append(result.QueryIDs, rows.QueryID)
+		if rows.Truncated {
+			result.Truncated = append(result.Truncated, kind)
+		}
+
+		switch kind {
+		case explainPlan:
+			result.Plan = explainText(rows)
+		case explainPipeline:
+			result.Pipeline = explainText(rows)
+		case explainIndexes:
+			reads, err := parseIndexUsage(explainText(rows))
+			if err != nil {
+				result.Errors[kind] = err.Error()
+				continue
+			}
+			result.Reads = reads
+		case explainEstimate:
+			result.Estimate = parseReadEstimates(rows)
+		}
+	}
+	if len(result.QueryIDs) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	result.Summary = summarizeExplain(result)
+	return result, nil
+}
+
+// explainText joins the single-column output of EXPLAIN into text.
+func explainText(rows *queryResult) string {
+	types := parseColumnTypes(rows.Columns)
+	lines := make([]string, 0, len(rows.Rows))
+	for _, row := range rows.Rows {
+		lines = append(lines, strings.Join(convertValuesToStrings(row, types), "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseIndexUsage extracts the MergeTree reads of an EXPLAIN json = 1,
+// indexes = 1 plan.
+func parseIndexUsage(plan string) ([]tableRead, error) {
+	var doc []struct {
+		Plan explainPlanNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse EXPLAIN indexes output: %w", err)
+	}
+
+	var reads []tableRead
+	var walk func(node explainPlanNode)
+	walk = func(node explainPlanNode) {
+		if node.NodeType == "ReadFromMergeTree" {
+			read := tableRead{Table: node.Description, Indexes: []indexUsage{}}
+			for _, index := range node.Indexes {
+				read.Indexes = append(read.Indexes, indexUsage(index))
+			}
+			reads = append(reads, read)
+		}
+		for _, child := range node.Plans {
+			walk(child)
+		}
+	}
+	for _, entry := range doc {
+		walk(entry.Plan)
+	}
+	return reads, nil
+}
+
+// parseReadEstimates reads the database, table, parts, rows and marks columns
+// of EXPLAIN ESTIMATE.
+func parseReadEstimates(rows *queryResult) []readEstimate {
+	types := parseColumnTypes(rows.Columns)
+	estimates := make([]readEstimate, 0, len(rows.Rows))
+	for _, row := range rows.Rows {
+		var estimate readEstimate
+		for i, value := range convertValuesToStrings(row, types) {
+			number, _ := strconv.ParseUint(value, 10, 64)
+			switch rows.Columns[i].Name {
+			case "database":
+				estimate.Database = value
+			case "table":
+				estimate.Table = value
+			case "parts":
+				estimate.Parts = number
+			case "rows":
+				estimate.Rows = number
+			case "marks":
+				estimate.Marks = number
+			}
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates
+}
+
+// summarizeExplain describes, for each table read, how much of it will be
+// read and which indexes narrow it down.
+func summarizeExplain(result *explainResult) []string {
+	summary := []string{}
+	for _, read := range result.Reads {
+		summary = append(summary, summarizeRead(read)...)
+	}
+	for _, estimate := range result.Estimate {
+		summary = append(summary, fmt.Sprintf("%s.%s: estimated %d rows in %d marks (granules) from %d parts",
+			estimate.Database, estimate.Table, estimate.Rows, estimate.Marks, estimate.Parts))
+	}
+	if result.Reads != nil && len(result.Reads) == 0 {
+		summary = append(summary, "The query reads no MergeTree tables, so no index information is available")
+	}
+	return summary
+}
+
+func summarizeRead(read tableRead) []string {
+	if len(read.Indexes) == 0 {
+		return []string{fmt.Sprintf("%s: no index analysis, every part and granule is read", read.Table)}
+	}
+
+	first, last := read.Indexes[0], read.Indexes[len(read.Indexes)-1]
+	lines := []string{fmt.Sprintf("%s: reads %d/%d parts and %d/%d granules",
+		read.Table, last.SelectedParts, first.InitialParts, last.SelectedGranules, first.InitialGranules)}
+
+	primaryKeyUsed := false
+	for _, index := range read.Indexes {
+		used := index.Condition != "" && index.Condition != "true"
+		switch index.Type {
+		case "PrimaryKey":
+			primaryKeyUsed = used
+			if used {
+				lines = append(lines, fmt.Sprintf("  primary key (%s) used: %s, %d/%d granules selected",
+					strings.Join(index.Keys, ", "), index.Condition, index.SelectedGranules, index.InitialGranules))
+			} else {
+				lines = append(lines, fmt.Sprintf("  primary key (%s) NOT used: the query has no usable condition on its leading columns",
+					strings.Join(index.Keys, ", ")))
+			}
+		case "Skip":
+			if index.SelectedGranules < index.InitialGranules {
+				lines = append(lines, fmt.Sprintf("  skip index %s (%s) used: %d/%d granules selected",
+					index.Name, index.Description, index.SelectedGranules, index.InitialGranules))
+			} else {
+				lines = append(lines, fmt.Sprintf("  skip index %s (%s) did not skip any granules", index.Name, index.Description))
+			}
+		case "MinMax", "Partition":
+			if used && index.SelectedParts < index.InitialParts {
+				lines = append(lines, fmt.Sprintf("  %s pruning: %d/%d parts selected by %s",
+					strings.ToLower(index.Type), index.SelectedParts, index.InitialParts, index.Condition))
+			}
+		}
+	}
+	if !primaryKeyUsed && last.SelectedGranules == first.InitialGranules && first.InitialGranules > 0 {
+		lines = append(lines, "  full scan: every granule of the selected parts is read")
+	}
+	return lines
+}
+
+func formatExplainResult(result *explainResult, format string) (string, error) {
+	if format == formatJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode JSON result: %w", err)
+		}
+		return string(data), nil
+	}
+
+	var output strings.Builder
+	if len(result.Summary) > 0 {
+		output.WriteString("Summary:\n")
+		for _, line := range result.Summary {
+			output.WriteString(line + "\n")
+		}
+	}
+	writeSection := func(title, text string) {
+		if text != "" {
+			output.WriteString(fmt.Sprintf("\n%s:\n%s\n", title, text))
+		}
+	}
+	writeSection("Plan", result.Plan)
+	writeSection("Pipeline", result.Pipeline)
+	for _, kind := range explainKindNames {
+		if err, ok := result.Errors[kind]; ok {
+			output.WriteString(fmt.Sprintf("\nEXPLAIN %s failed: %s\n", kind, err))
+		}
+	}
+	for _, kind := range result.Truncated {
+		output.WriteString(fmt.Sprintf("\nEXPLAIN %s output limited to %d rows\n", kind, maxCHLimit))
+	}
+	if len(result.QueryIDs) > 0 {
+		output.WriteString(fmt.Sprintf("\nQuery IDs: %s\n", strings.Join(result.QueryIDs, ", ")))
+	}
+	return output.String(), nil
+}
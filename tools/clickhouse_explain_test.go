@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const explainIndexesJSON = `[
+  {
+    "Plan": {
+      "Node Type": "Expression",
+      "Plans": [
+        {
+          "Node Type": "ReadFromMergeTree",
+          "Description": "default.hits",
+          "Indexes": [
+            {"Type": "MinMax", "Keys": ["EventDate"], "Condition": "(EventDate in [19000, +Inf))",
+             "Initial Parts": 10, "Selected Parts": 4, "Initial Granules": 1000, "Selected Granules": 400},
+            {"Type": "PrimaryKey", "Keys": ["CounterID", "EventDate"], "Condition": "(CounterID in [34, 34])",
+             "Initial Parts": 4, "Selected Parts": 2, "Initial Granules": 400, "Selected Granules": 12},
+            {"Type": "Skip", "Name": "url_bf", "Description": "bloom_filter GRANULARITY 1",
+             "Initial Parts": 2, "Selected Parts": 2, "Initial Granules": 12, "Selected Granules": 12}
+          ]
+        },
+        {
+          "Node Type": "ReadFromMergeTree",
+          "Description": "default.users",
+          "Indexes": [
+            {"Type": "PrimaryKey", "Keys": ["UserID"], "Condition": "true",
+             "Initial Parts": 3, "Selected Parts": 3, "Initial Granules": 90, "Selected Granules": 90}
+          ]
+        }
+      ]
+    }
+  }
+]`
+
+func TestValidateExplainedQuery(t *testing.T) {
+	tests := []struct {
+		query       string
+		expectError bool
+	}{
+		{"SELECT count() FROM hits WHERE CounterID = 34", false},
+		{"WITH 1 AS x SELECT x", false},
+		{"(SELECT 1) UNION ALL (SELECT 2)", false},
+		{"SHOW TABLES", true},
+		{"EXPLAIN SELECT 1", true},
+		{"DROP TABLE hits", true},
+		{"SELECT * FROM url('http://example.com')", true},
+	}
+
+	for _, test := range tests {
+		err := validateExplainedQuery(test.query)
+		if (err != nil) != test.expectError {
+			t.Errorf("validateExplainedQuery(%q) = %v, want error %v", test.query, err, test.expectError)
+		}
+	}
+}
+
+func TestParseExplainKinds(t *testing.T) {
+	tests := []struct {
+		arg         interface{}
+		expected    []string
+		expectError bool
+	}{
+		{nil, explainKindNames, false},
+		{[]interface{}{}, explainKindNames, false},
+		{[]interface{}{"estimate", "PLAN"}, []string{explainPlan, explainEstimate}, false},
+		{[]interface{}{"syntax"}, nil, true},
+		{"plan", nil, true},
+	}
+
+	for _, test := range tests {
+		result, err := parseExplainKinds(test.arg)
+		if (err != nil) != test.expectError || !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseExplainKinds(%v) = %v, %v, want %v (error %v)", test.arg, result, err, test.expected, test.expectError)
+		}
+	}
+}
+
+func TestSummarizeExplain(t *testing.T) {
+	reads, err := parseIndexUsage(explainIndexesJSON)
+	if err != nil {
+		t.Fatalf("parseIndexUsage() returned error: %v", err)
+	}
+	if len(reads) != 2 || reads[0].Table != "default.hits" || len(reads[0].Indexes) != 3 {
+		t.Fatalf("parseIndexUsage() = %+v, want reads of default.hits and default.users", reads)
+	}
+
+	summary := summarizeExplain(&explainResult{
+		Reads:    reads,
+		Estimate: []readEstimate{{Database: "default", Table: "hits", Parts: 2, Rows: 98304, Marks: 12}},
+	})
+	expected := []string{
+		"default.hits: reads 2/10 parts and 12/1000 granules",
+		"  minmax pruning: 4/10 parts selected by (EventDate in [19000, +Inf))",
+		"  primary key (CounterID, EventDate) used: (CounterID in [34, 34]), 12/400 granules selected",
+		"  skip index url_bf (bloom_filter GRANULARITY 1) did not skip any granules",
+		"default.users: reads 3/3 parts and 90/90 granules",
+		"  primary key (UserID) NOT used: the query has no usable condition on its leading columns",
+		"  full scan: every granule of the selected parts is read",
+		"default.hits: estimated 98304 rows in 12 marks (granules) from 2 parts",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("summarizeExplain() =\n%s\nwant\n%s", strings.Join(summary, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// explainConn answers each EXPLAIN kind with canned rows, and fails the
+// statements listed in failing. If lines is set, plans and pipelines have
+// that many lines.
+type explainConn struct {
+	driver.Conn
+	failing map[string]bool
+	lines   int
+	queries []string
+}
+
+func (c *explainConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.queries = append(c.queries, query)
+	for kind, prefix := range explainStatements {
+		if !strings.HasPrefix(query, prefix) {
+			continue
+		}
+		if c.failing[kind] {
+			return nil, &clickhouse.Exception{Code: 48, Message: "EXPLAIN " + kind + " is not supported"}
+		}
+		switch kind {
+		case explainEstimate:
+			return &fakeRows{
+				columns: []fakeColumnType{{"database", "String"}, {"table", "String"}, {"parts", "UInt64"}, {"rows", "UInt64"}, {"marks", "UInt64"}},
+				data:    [][]interface{}{{"default", "hits", uint64(2), uint64(98304), uint64(12)}},
+			}, nil
+		case explainIndexes:
+			return &fakeRows{columns: []fakeColumnType{{"explain", "String"}}, data: [][]interface{}{{explainIndexesJSON}}}, nil
+		default:
+			rows := &fakeRows{columns: []fakeColumnType{{"explain", "String"}}}
+			for i := range max(c.lines, 2) {
+				rows.data = append(rows.data, []interface{}{fmt.Sprintf("%s line %d", kind, i+1)})
+			}
+			return rows, nil
+		}
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+func newExplainTestClient(conn driver.Conn) *ClickHouseClient {
+	client := newClickHouseClient(&clickHouseProfiles{
+		names:          []string{"default"},
+		configs:        map[string]*ClickHouseConfig{"default": {}},
+		defaultProfile: "default",
+	})
+	client.pools["default"].conn = conn
+	return client
+}
+
+func TestExplainQuery(t *testing.T) {
+	conn := &explainConn{failing: map[string]bool{explainPipeline: true}}
+	client := newExplainTestClient(conn)
+
+	result, err := explainQuery(context.Background(), client, "", "SELECT count() FROM hits", explainKindNames)
+	if err != nil {
+		t.Fatalf("explainQuery() returned error: %v", err)
+	}
+	if len(conn.queries) != 4 || conn.queries[0] != "EXPLAIN PLAN SELECT count() FROM hits" {
+		t.Errorf("explainQuery() ran %q, want the four EXPLAIN statements", conn.queries)
+	}
+	if result.Plan != "plan line 1\nplan line 2" {
+		t.Errorf("explainQuery() plan = %q", result.Plan)
+	}
+	if result.Pipeline != "" || !strings.Contains(result.Errors[explainPipeline], "not supported") {
+		t.Errorf("explainQuery() pipeline = %q, errors = %v, want the pipeline error reported", result.Pipeline, result.Errors)
+	}
+	if len(result.Reads) != 2 || len(result.Estimate) != 1 || result.Estimate[0].Rows != 98304 {
+		t.Errorf("explainQuery() reads = %+v, estimate = %+v", result.Reads, result.Estimate)
+	}
+	if len(result.QueryIDs) != 3 || len(result.Summary) == 0 {
+		t.Errorf("explainQuery() = %d query IDs, %d summary lines, want 3 and a summary", len(result.QueryIDs), len(result.Summary))
+	}
+
+	conn = &explainConn{failing: map[string]bool{explainPlan: true}}
+	_, err = explainQuery(context.Background(), newExplainTestClient(conn), "", "SELECT 1", []string{explainPlan})
+	var qerr *queryError
+	if !errors.As(err, &qerr) {
+		t.Errorf("explainQuery() with every kind failing = %v, want the query error", err)
+	}
+}
+
+func TestClickHouseExplainHandler_Truncated(t *testing.T) {
+	conn := &explainConn{lines: maxCHLimit + 1}
+	handler := clickHouseExplainHandler(newExplainTestClient(conn))
+
+	result := handler(context.Background(), map[string]interface{}{"query": "SELECT count() FROM hits"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("clickHouseExplainHandler() = %q, want success", resultText(result))
+	}
+	if truncated := result.Meta["truncated"]; !reflect.DeepEqual(truncated, []string{explainPlan, explainPipeline}) {
+		t.Errorf("clickHouseExplainHandler() _meta truncated = %v, want the plan and pipeline", truncated)
+	}
+	text := resultText(result)
+	for _, expected := range []string{"EXPLAIN plan output limited to 1000 rows", "EXPLAIN pipeline output limited to 1000 rows"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("clickHouseExplainHandler() = %q, want it to contain %q", text, expected)
+		}
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "SELECT 1", "kinds": []interface{}{"plan"}, "format": "json"})
+	var doc explainResult
+	if err := json.Unmarshal([]byte(resultText(result)), &doc); err != nil || !reflect.DeepEqual(doc.Truncated, []string{explainPlan}) {
+		t.Errorf("clickHouseExplainHandler() JSON truncated = %v, %v, want the plan", doc.Truncated, err)
+	}
+	if strings.Count(doc.Plan, "\n") != maxCHLimit-1 {
+		t.Errorf("clickHouseExplainHandler() plan has %d lines, want %d", strings.Count(doc.Plan, "\n")+1, maxCHLimit)
+	}
+
+	conn.lines = 0
+	result = handler(context.Background(), map[string]interface{}{"query": "SELECT 1"})
+	if _, ok := result.Meta["truncated"]; ok || strings.Contains(resultText(result), "limited to") {
+		t.Errorf("clickHouseExplainHandler() for a short plan = %q, want no truncation note", resultText(result))
+	}
+}
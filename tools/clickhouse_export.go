@@ -0,0 +1,430 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+)
+
+const (
+	envExportDir       = "LOCAL_MCP_EXPORT_DIR"
+	envExportMaxSizeMB = "LOCAL_MCP_EXPORT_MAX_SIZE_MB"
+
+	defaultExportMaxSizeMB = 1024
+	defaultCHHTTPPort      = 8123
+	defaultCHHTTPSPort     = 8443
+)
+
+// exportFormat is a file format of clickhouse-export and the ClickHouse
+// output format that produces it.
+type exportFormat struct {
+	Name       string
+	ClickHouse string
+	Extension  string
+	// Rows counts the rows of line-based formats as they are written, or is
+	// nil for binary formats.
+	Rows func() *rowCounter
+}
+
+var exportFormats = []exportFormat{
+	{"parquet", "Parquet", ".parquet", nil},
+	{"arrow", "Arrow", ".arrow", nil},
+	{"csv", "CSVWithNames", ".csv", func() *rowCounter { return &rowCounter{header: true, quoted: true} }},
+	{"tsv", "TSVWithNames", ".tsv", func() *rowCounter { return &rowCounter{header: true} }},
+	{"jsoneachrow", "JSONEachRow", ".jsonl", func() *rowCounter { return &rowCounter{} }},
+}
+
+// errExportTooLarge is returned once an export grows past its size limit.
+var errExportTooLarge = errors.New("the export is too large")
+
+// exportTailSize is how much of the end of an export is kept to look for an
+// exception the server wrote into the response after it had started.
+const exportTailSize = 64 << 10
+
+// streamedExceptionPattern matches an exception ClickHouse appended to a
+// response whose status it had already sent.
+var streamedExceptionPattern = regexp.MustCompile(`Code: (\d+)\. DB::Exception: ([^\r\n]*)`)
+
+// exportHTTPClient talks to the HTTP interface of ClickHouse. It has no
+// timeout: exports are bounded by max_execution_time on the server.
+var exportHTTPClient = &http.Client{}
+
+// exportResult describes a file written by clickhouse-export.
+type exportResult struct {
+	Path   string        `json:"path"`
+	Format string        `json:"format"`
+	Size   int64         `json:"size"`
+	Rows   *uint64       `json:"rows,omitempty"`
+	Schema []queryColumn `json:"schema"`
+	// QueryID and LogComment tag the export in system.query_log.
+	QueryID    string        `json:"query_id"`
+	LogComment string        `json:"-"`
+	Elapsed    time.Duration `json:"-"`
+}
+
+func exportFormatNames() []string {
+	names := make([]string, len(exportFormats))
+	for i, format := range exportFormats {
+		names[i] = format.Name
+	}
+	return names
+}
+
+// parseExportFormat validates the format argument, defaulting to Parquet.
+func parseExportFormat(arg interface{}) (exportFormat, error) {
+	name, _ := arg.(string)
+	if name == "" {
+		return exportFormats[0], nil
+	}
+	for _, format := range exportFormats {
+		if strings.EqualFold(name, format.Name) || strings.EqualFold(name, format.ClickHouse) {
+			return format, nil
+		}
+	}
+	return exportFormat{}, fmt.Errorf("unsupported format %q (supported: %s)", name, strings.Join(exportFormatNames(), ", "))
+}
+
+// exportDir returns the directory clickhouse-export writes to, set by
+// LOCAL_MCP_EXPORT_DIR, or "" if exports are not enabled.
+func exportDir() string {
+	return os.Getenv(envExportDir)
+}
+
+// validateExportQuery checks that query is a SELECT that passes the read-only
+// check and has no FORMAT clause of its own, and returns it without a
+// trailing semicolon.
+func validateExportQuery(query string) (string, error) {
+	if err := validateExplainedQuery(query); err != nil {
+		return "", err
+	}
+	tokens, _ := tokenizeSQL(query)
+	depth := 0
+	for _, tok := range tokens {
+		switch {
+		case tok.isPunct("("):
+			depth++
+		case tok.isPunct(")"):
+			depth--
+		case tok.isPunct(";"):
+			return query[:tok.Pos], nil
+		case depth == 0 && tok.is("FORMAT"):
+			return "", newUnsafeQueryError(tok, "the export format is set by the format argument, remove the FORMAT clause")
+		}
+	}
+	return query, nil
+}
+
+// resolveExportPath returns the absolute path of name inside root, creating
+// its directories. name must be relative and stay inside root, also through
+// symbolic links; a missing name is generated and a missing extension added.
+// An existing file is only replaced if overwrite is set.
+func resolveExportPath(root, name, extension string, overwrite bool) (string, error) {
+	if name == "" {
+		name = "export-" + time.Now().UTC().Format("20060102-150405") + "-" + uuid.NewString()[:8]
+	}
+	if filepath.Ext(name) == "" {
+		name += extension
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%q must be a relative path inside the export directory", name)
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create the export directory: %w", err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the export directory: %w", err)
+	}
+	path := filepath.Join(realRoot, name)
+
+	// Check where the directories that already exist lead before creating
+	// the rest, so that a link inside the root cannot redirect the export.
+	existing := filepath.Dir(path)
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	realDir, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w", name, err)
+	}
+	if !pathWithin(realRoot, realDir) {
+		return "", fmt.Errorf("%q leads outside the export directory", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create the directory of %q: %w", name, err)
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%q exists and is not a regular file", name)
+		}
+		if !overwrite {
+			return "", fmt.Errorf("%q already exists, set overwrite to replace it", name)
+		}
+	}
+	return path, nil
+}
+
+// pathWithin reports whether path is root or inside it.
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// clickHouseHTTPURL returns the address of the HTTP interface of config.
+func clickHouseHTTPURL(config ClickHouseConfig) string {
+	scheme, port := "http", defaultCHHTTPPort
+	if config.Secure {
+		scheme, port = "https", defaultCHHTTPSPort
+	}
+	if config.HTTPPort > 0 {
+		port = config.HTTPPort
+	}
+	return scheme + "://" + net.JoinHostPort(config.Host, strconv.Itoa(port)) + "/"
+}
+
+// exportToFile writes the result of query on profile to path. The file is
+// written next to path and renamed into place once complete, so a failed
+// export leaves nothing behind.
+func exportToFile(ctx context.Context, client *ClickHouseClient, profile, query string, format exportFormat, path string, maxSize int64) (*exportResult, error) {
+	config, err := client.Config(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *exportResult
+	err = client.Do(ctx, profile, func(conn driver.Conn) error {
+		schema, err := describeQueryColumns(ctx, conn, query)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("failed to create the export file: %w", err)
+		}
+		defer os.Remove(file.Name())
+
+		result, err = exportQuery(ctx, *config, query, format, file, maxSize)
+		if result != nil && (ctx.Err() != nil || errors.Is(err, errExportTooLarge)) {
+			// The server keeps producing the result until it notices the
+			// closed connection.
+			killQuery(conn, result.QueryID)
+		}
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write the export file: %w", closeErr)
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(file.Name(), path); err != nil {
+			return fmt.Errorf("failed to write the export file: %w", err)
+		}
+
+		result.Path = path
+		result.Schema = schema
+		if result.Rows != nil {
+			auditRows(ctx, int(*result.Rows))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// describeQueryColumns returns the columns of the result of query.
+func describeQueryColumns(ctx context.Context, conn driver.Conn, query string) ([]queryColumn, error) {
+	// The newline keeps a trailing comment from swallowing the parenthesis.
+	result, err := executeQuery(ctx, conn, "DESCRIBE (\n"+query+"\n)", maxCHLimit)
+	if err != nil {
+		return nil, err
+	}
+	types := parseColumnTypes(result.Columns)
+	columns := make([]queryColumn, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		values := convertValuesToStrings(row, types)
+		if len(values) >= 2 {
+			columns = append(columns, queryColumn{Name: values[0], Type: values[1]})
+		}
+	}
+	return columns, nil
+}
+
+// exportQuery streams the result of query in format from the HTTP interface
+// of ClickHouse to out, with the same settings as the native connections, and
+// stops reading once maxSize is exceeded. The server sends the result as it
+// produces it, so an exception can arrive after the first rows: it is found
+// in the trailer or at the end of the body, and the export fails. Failures are
+// returned as *queryError; the result is also returned with its query ID when
+// the export was interrupted.
+func exportQuery(ctx context.Context, config ClickHouseConfig, query string, format exportFormat, out io.Writer, maxSize int64) (*exportResult, error) {
+	start := time.Now()
+	result := &exportResult{Format: format.Name, QueryID: uuid.NewString(), LogComment: queryLogComment(ctx)}
+	auditQuery(ctx, result.QueryID)
+	fail := func(err error) (*exportResult, error) {
+		return result, &queryError{QueryID: result.QueryID, LogComment: result.LogComment, Err: err}
+	}
+
+	params := url.Values{}
+	for name, value := range clickHouseSettings(config) {
+		params.Set(name, fmt.Sprint(value))
+	}
+	params.Set("database", config.Database)
+	params.Set("query_id", result.QueryID)
+	params.Set("log_comment", result.LogComment)
+	params.Set("default_format", format.ClickHouse)
+	params.Set("wait_end_of_query", "0")
+	// Exceptions are written as plain text rather than in the output format.
+	params.Set("http_write_exception_in_output_format", "0")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, clickHouseHTTPURL(config)+"?"+params.Encode(), strings.NewReader(query))
+	if err != nil {
+		return fail(fmt.Errorf("export failed: %w", err))
+	}
+	req.Header.Set("X-ClickHouse-User", config.Username)
+	req.Header.Set("X-ClickHouse-Key", config.Password)
+
+	resp, err := exportHTTPClient.Do(req)
+	if err != nil {
+		return fail(fmt.Errorf("export failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		message := strings.TrimSpace(string(body))
+		if code, err := strconv.Atoi(resp.Header.Get("X-ClickHouse-Exception-Code")); err == nil {
+			return fail(fmt.Errorf("query execution failed: %w", &clickhouse.Exception{Code: int32(code), Message: message}))
+		}
+		return fail(fmt.Errorf("export failed: %s: %s", resp.Status, message))
+	}
+
+	tail := &tailBuffer{size: exportTailSize}
+	writers := []io.Writer{out, tail}
+	var rows *rowCounter
+	if format.Rows != nil {
+		rows = format.Rows()
+		writers = append(writers, rows)
+	}
+	result.Size, err = io.Copy(io.MultiWriter(writers...), io.LimitReader(resp.Body, maxSize+1))
+	if exception := streamedException(resp.Trailer, tail.data); exception != nil {
+		return fail(fmt.Errorf("query execution failed: %w", exception))
+	}
+	if err != nil {
+		return fail(fmt.Errorf("export failed: %w", err))
+	}
+	if result.Size > maxSize {
+		return fail(fmt.Errorf("%w: larger than %s (%s)", errExportTooLarge, formatBytes(uint64(maxSize)), envExportMaxSizeMB))
+	}
+
+	if rows != nil {
+		result.Rows = ptr(rows.count())
+	}
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// streamedException returns the exception the server reported after the
+// response had started: in the X-ClickHouse-Exception-Code trailer, or at
+// the end of the body, either as a last line or between __exception__
+// markers.
+func streamedException(trailer http.Header, tail []byte) *clickhouse.Exception {
+	var match [][]byte
+	if i := bytes.Index(tail, []byte("__exception__")); i >= 0 {
+		match = streamedExceptionPattern.FindSubmatch(tail[i:])
+	} else {
+		body := bytes.TrimRight(tail, "\r\n")
+		last := body[bytes.LastIndexByte(body, '\n')+1:]
+		if bytes.HasPrefix(last, []byte("Code: ")) {
+			match = streamedExceptionPattern.FindSubmatch(last)
+		}
+	}
+	if match != nil {
+		code, _ := strconv.Atoi(string(match[1]))
+		return &clickhouse.Exception{Code: int32(code), Message: string(match[2])}
+	}
+	if code, err := strconv.Atoi(trailer.Get("X-ClickHouse-Exception-Code")); err == nil {
+		return &clickhouse.Exception{Code: int32(code), Message: "the query failed after the export had started"}
+	}
+	return nil
+}
+
+// tailBuffer keeps the last size bytes written to it.
+type tailBuffer struct {
+	size int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.size; over > 0 {
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	return len(p), nil
+}
+
+// rowCounter counts the rows of a line-based format: its lines after the
+// header, where for CSV only newlines outside quoted values end a line.
+type rowCounter struct {
+	header   bool
+	quoted   bool
+	inQuotes bool
+	lines    uint64
+}
+
+func (c *rowCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch {
+		case b == '"' && c.quoted:
+			c.inQuotes = !c.inQuotes
+		case b == '\n' && !c.inQuotes:
+			c.lines++
+		}
+	}
+	return len(p), nil
+}
+
+func (c *rowCounter) count() uint64 {
+	if c.header && c.lines > 0 {
+		return c.lines - 1
+	}
+	return c.lines
+}
+
+func formatExportResult(result *exportResult) string {
+	var output strings.Builder
+	rows := "an unknown number of rows"
+	if result.Rows != nil {
+		rows = fmt.Sprintf("%d rows", *result.Rows)
+	}
+	output.WriteString(fmt.Sprintf("Exported %s (%s) to %s in %s\n", rows, formatBytes(uint64(result.Size)), result.Path,
+		result.Elapsed.Round(time.Millisecond)))
+	output.WriteString(fmt.Sprintf("Format: %s\n", result.Format))
+	output.WriteString("\nSchema:\n")
+	for _, col := range result.Schema {
+		output.WriteString(fmt.Sprintf("  %s %s\n", col.Name, col.Type))
+	}
+	output.WriteString(fmt.Sprintf("\nQuery ID: %s\n", result.QueryID))
+	return output.String()
+}
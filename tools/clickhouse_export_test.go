@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+func TestValidateExportQuery(t *testing.T) {
+	tests := []struct {
+		query       string
+		expected    string
+		expectError bool
+	}{
+		{"SELECT * FROM hits", "SELECT * FROM hits", false},
+		{"SELECT * FROM hits; -- done", "SELECT * FROM hits", false},
+		{"SELECT formatDateTime(now(), '%F') AS d", "SELECT formatDateTime(now(), '%F') AS d", false},
+		{"SELECT * FROM hits FORMAT CSV", "", true},
+		{"SHOW TABLES", "", true},
+		{"SELECT * FROM file('/etc/passwd')", "", true},
+	}
+
+	for _, test := range tests {
+		result, err := validateExportQuery(test.query)
+		if (err != nil) != test.expectError || result != test.expected {
+			t.Errorf("validateExportQuery(%q) = %q, %v, want %q (error %v)", test.query, result, err, test.expected, test.expectError)
+		}
+	}
+}
+
+func TestResolveExportPath(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "exports")
+	outside := t.TempDir()
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "existing.csv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target.csv"), filepath.Join(root, "link.csv")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		overwrite   bool
+		expected    string
+		expectError bool
+	}{
+		{"hits", false, "hits.parquet", false},
+		{"daily/2026-01-02.csv", false, "daily/2026-01-02.csv", false},
+		{"existing.csv", false, "", true},
+		{"existing.csv", true, "existing.csv", false},
+		{"../hits.csv", false, "", true},
+		{"/tmp/hits.csv", false, "", true},
+		{"escape/hits.csv", false, "", true},
+		{"escape/new/hits.csv", false, "", true},
+		{"link.csv", true, "", true},
+	}
+
+	realRoot, _ := filepath.EvalSymlinks(root)
+	for _, test := range tests {
+		path, err := resolveExportPath(root, test.name, ".parquet", test.overwrite)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("resolveExportPath(%q) = %q, want an error", test.name, path)
+			}
+			continue
+		}
+		if err != nil || path != filepath.Join(realRoot, test.expected) {
+			t.Errorf("resolveExportPath(%q) = %q, %v, want %q", test.name, path, err, test.expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("resolveExportPath() created a directory outside the export root")
+	}
+
+	path, err := resolveExportPath(root, "", ".arrow", false)
+	if err != nil || filepath.Dir(path) != realRoot || !strings.HasPrefix(filepath.Base(path), "export-") || filepath.Ext(path) != ".arrow" {
+		t.Errorf("resolveExportPath(\"\") = %q, %v, want a generated .arrow file in the root", path, err)
+	}
+}
+
+// describeConn answers DESCRIBE with two columns.
+type describeConn struct {
+	driver.Conn
+}
+
+func (c *describeConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	return &fakeRows{
+		columns: []fakeColumnType{{"name", "String"}, {"type", "String"}, {"default_type", "String"}},
+		data:    [][]interface{}{{"CounterID", "UInt32", ""}, {"URL", "String", ""}},
+	}, nil
+}
+
+func TestClickHouseHTTPURL(t *testing.T) {
+	tests := []struct {
+		config   ClickHouseConfig
+		expected string
+	}{
+		{ClickHouseConfig{Host: "localhost"}, "http://localhost:8123/"},
+		{ClickHouseConfig{Host: "ch.example.com", Secure: true}, "https://ch.example.com:8443/"},
+		{ClickHouseConfig{Host: "::1", HTTPPort: 18123}, "http://[::1]:18123/"},
+	}
+
+	for _, tt := range tests {
+		if result := clickHouseHTTPURL(tt.config); result != tt.expected {
+			t.Errorf("clickHouseHTTPURL(%+v) = %q, want %q", tt.config, result, tt.expected)
+		}
+	}
+}
+
+func TestClickHouseExportHandler(t *testing.T) {
+	var params map[string]string
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		params = map[string]string{"user": r.Header.Get("X-ClickHouse-User")}
+		for name, values := range r.URL.Query() {
+			params[name] = values[0]
+		}
+		if strings.Contains(body, "missing") {
+			w.Header().Set("X-ClickHouse-Exception-Code", "60")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "Code: 60. DB::Exception: Table default.missing does not exist.")
+			return
+		}
+		w.Header().Set("X-ClickHouse-Summary", `{"read_rows":"10","result_rows":"2"}`)
+		io.WriteString(w, "CounterID,URL\n1,a\n2,b\n")
+	}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	httpPort, _ := strconv.Atoi(port)
+	client := newExplainTestClient(&describeConn{})
+	client.pools["default"].config = ClickHouseConfig{Host: host, HTTPPort: httpPort, Database: "default", Username: "reader", MaxExecutionTime: 60}
+	root := t.TempDir()
+	t.Setenv(envExportDir, root)
+	handler := clickHouseExportHandler(client)
+
+	result := handler(context.Background(), map[string]interface{}{"query": "SELECT CounterID, URL FROM hits;", "format": "csv", "path": "hits"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("clickHouseExportHandler() = %q, want success", resultText(result))
+	}
+	data, err := os.ReadFile(filepath.Join(root, "hits.csv"))
+	if err != nil || string(data) != "CounterID,URL\n1,a\n2,b\n" {
+		t.Errorf("exported file = %q, %v, want the server's response", data, err)
+	}
+	if body != "SELECT CounterID, URL FROM hits" {
+		t.Errorf("export sent %q, want the query without its semicolon", body)
+	}
+	for name, expected := range map[string]string{
+		"default_format": "CSVWithNames", "readonly": "2", "max_execution_time": "60",
+		"database": "default", "user": "reader", "query_id": result.Meta["query_id"].(string),
+	} {
+		if params[name] != expected {
+			t.Errorf("export parameter %s = %q, want %q", name, params[name], expected)
+		}
+	}
+	text := resultText(result)
+	for _, expected := range []string{"Exported 2 rows (22 B)", "hits.csv", "CounterID UInt32", "URL String"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("clickHouseExportHandler() = %q, want it to contain %q", text, expected)
+		}
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "SELECT * FROM missing", "path": "missing"})
+	if !strings.Contains(resultText(result), "does not exist") || result.Meta["query_id"] == nil {
+		t.Errorf("clickHouseExportHandler() for a failing query = %q, want the server error and its query ID", resultText(result))
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Errorf("export directory has %d entries, want only hits.csv", len(entries))
+	}
+
+	scoped := withCaller(context.Background(), &Caller{Name: "ci", Connections: []string{"prod"}})
+	result = handler(scoped, map[string]interface{}{"query": "SELECT 1", "path": "reports/denied", "force": true})
+	if !strings.Contains(resultText(result), "not permitted") {
+		t.Errorf("clickHouseExportHandler() for a profile the caller may not use = %q, want it refused", resultText(result))
+	}
+	if _, err := os.Stat(filepath.Join(root, "reports")); !os.IsNotExist(err) {
+		t.Errorf("refused export created its directory: %v", err)
+	}
+
+	t.Setenv(envExportDir, "")
+	result = handler(context.Background(), map[string]interface{}{"query": "SELECT 1"})
+	if !strings.Contains(resultText(result), "disabled") {
+		t.Errorf("clickHouseExportHandler() without an export directory = %q, want it disabled", resultText(result))
+	}
+}
+
+func TestExportQuery_Streaming(t *testing.T) {
+	var params map[string]string
+	var response string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = map[string]string{}
+		for name, values := range r.URL.Query() {
+			params[name] = values[0]
+		}
+		w.Header().Set("Trailer", "X-ClickHouse-Exception-Code")
+		io.WriteString(w, response)
+		if strings.Contains(response, "trailer") {
+			w.Header().Set("X-ClickHouse-Exception-Code", "159")
+		}
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	httpPort, _ := strconv.Atoi(port)
+	config := ClickHouseConfig{Host: host, HTTPPort: httpPort}
+	csv, _ := parseExportFormat("csv")
+
+	tests := []struct {
+		name     string
+		response string
+		maxSize  int64
+		code     int32
+		rows     uint64
+	}{
+		{"complete", "id,note\n1,\"two\nlines\"\n2,b\n", 1 << 20, 0, 2},
+		{"exception line", "id\n1\n2\nCode: 241. DB::Exception: Memory limit (total) exceeded. (MEMORY_LIMIT_EXCEEDED)\n", 1 << 20, 241, 0},
+		{"exception markers", "id\n1\n__exception__\r\nabcdefghijklmnop\r\nCode: 159. DB::Exception: Timeout exceeded. (TIMEOUT_EXCEEDED)\r\n80 abcdefghijklmnop\r\n__exception__\r\n", 1 << 20, 159, 0},
+		{"exception trailer", "id\n1\ntrailer\n", 1 << 20, 159, 0},
+	}
+	for _, test := range tests {
+		response = test.response
+		var out bytes.Buffer
+		result, err := exportQuery(context.Background(), config, "SELECT 1", csv, &out, test.maxSize)
+		if params["wait_end_of_query"] != "0" {
+			t.Errorf("%s: wait_end_of_query = %q, want the result streamed", test.name, params["wait_end_of_query"])
+		}
+		var exception *clickhouse.Exception
+		if test.code != 0 {
+			if !errors.As(err, &exception) || exception.Code != test.code {
+				t.Errorf("%s: exportQuery() = %v, want exception %d", test.name, err, test.code)
+			}
+			continue
+		}
+		if err != nil || result.Rows == nil || *result.Rows != test.rows || out.String() != test.response {
+			t.Errorf("%s: exportQuery() = %+v, %v, want %d rows written", test.name, result, err, test.rows)
+		}
+	}
+
+	response = strings.Repeat("1234567\n", 100)
+	result, err := exportQuery(context.Background(), config, "SELECT 1", csv, io.Discard, 100)
+	if !errors.Is(err, errExportTooLarge) || result == nil || result.QueryID == "" {
+		t.Errorf("exportQuery() past the size limit = %v, want errExportTooLarge with the query ID", err)
+	}
+}
@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Output formats accepted by the clickhouse-query format argument.
+const (
+	formatTable    = "table"
+	formatJSON     = "json"
+	formatJSONL    = "jsonl"
+	formatCSV      = "csv"
+	formatTSV      = "tsv"
+	formatMarkdown = "markdown"
+)
+
+var queryFormats = []string{formatTable, formatJSON, formatJSONL, formatCSV, formatTSV, formatMarkdown}
+
+// parseQueryFormat validates the format argument, defaulting to the text table.
+func parseQueryFormat(formatArg interface{}) (string, error) {
+	format, ok := formatArg.(string)
+	if !ok || format == "" {
+		return formatTable, nil
+	}
+
+	format = strings.ToLower(format)
+	for _, f := range queryFormats {
+		if f == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported format %q (supported: %s)", format, strings.Join(queryFormats, ", "))
+}
+
+// formatQueryResult renders result in the given output format.
+func formatQueryResult(result *queryResult, format string) (string, error) {
+	switch format {
+	case formatJSON:
+		return formatResultJSON(result)
+	case formatJSONL:
+		return formatResultJSONL(result)
+	case formatCSV:
+		return formatResultCSV(result)
+	case formatTSV:
+		return formatResultTSV(result), nil
+	case formatMarkdown:
+		return formatResultMarkdown(result), nil
+	default:
+		return formatQueryResults(result), nil
+	}
+}
+
+func formatQueryResults(result *queryResult) string {
+	types := parseColumnTypes(result.Columns)
+	columnNames := result.columnNames()
+
+	var output strings.Builder
+	output.WriteString("Query Results:\n\n")
+
+	// Write header
+	output.WriteString(strings.Join(columnNames, " | "))
+	output.WriteString("\n")
+	output.WriteString(strings.Repeat("-", len(strings.Join(columnNames, " | "))))
+	output.WriteString("\n")
+
+	for _, row := range result.Rows {
+		output.WriteString(strings.Join(convertValuesToStrings(row, types), " | "))
+		output.WriteString("\n")
+	}
+
+	rowCount := len(result.Rows)
+	if rowCount == 0 {
+		output.WriteString("No rows returned.\n")
+	} else {
+		if result.Offset > 0 {
+			output.WriteString(fmt.Sprintf("\nRows %d-%d", result.Offset+1, result.Offset+rowCount))
+		} else {
+			output.WriteString(fmt.Sprintf("\nTotal rows: %d", rowCount))
+		}
+		if result.Truncated {
+			output.WriteString(fmt.Sprintf(" (limited to %d)", result.Limit))
+		}
+		output.WriteString("\n")
+	}
+	if result.QueryID != "" {
+		output.WriteString(fmt.Sprintf("Query ID: %s\n", result.QueryID))
+	}
+
+	return output.String()
+}
+
+// jsonQueryResult is the document produced by the json format.
+type jsonQueryResult struct {
+	Columns []queryColumn     `json:"columns"`
+	Rows    [][]interface{}   `json:"rows"`
+	Meta    jsonQueryMetadata `json:"meta"`
+}
+
+type jsonQueryMetadata struct {
+	Rows      int     `json:"rows"`
+	Limit     int     `json:"limit"`
+	Truncated bool    `json:"truncated"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+	RowsRead  uint64  `json:"rows_read"`
+	BytesRead uint64  `json:"bytes_read"`
+	// QueryID and LogComment identify the query in system.query_log.
+	QueryID    string `json:"query_id,omitempty"`
+	LogComment string `json:"log_comment,omitempty"`
+	// Offset and NextCursor locate the page within a paged result.
+	Offset     int    `json:"offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func formatResultJSON(result *queryResult) (string, error) {
+	types := parseColumnTypes(result.Columns)
+	doc := jsonQueryResult{
+		Columns: result.Columns,
+		Rows:    make([][]interface{}, len(result.Rows)),
+		Meta: jsonQueryMetadata{
+			Rows:       len(result.Rows),
+			Limit:      result.Limit,
+			Truncated:  result.Truncated,
+			ElapsedMS:  float64(result.Elapsed.Microseconds()) / 1000,
+			RowsRead:   result.RowsRead,
+			BytesRead:  result.BytesRead,
+			QueryID:    result.QueryID,
+			LogComment: result.LogComment,
+			Offset:     result.Offset,
+			NextCursor: result.NextCursor,
+		},
+	}
+	for i, row := range result.Rows {
+		doc.Rows[i] = jsonValues(row, types)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON result: %w", err)
+	}
+	return string(data), nil
+}
+
+func formatResultJSONL(result *queryResult) (string, error) {
+	types := parseColumnTypes(result.Columns)
+	var output strings.Builder
+	for _, row := range result.Rows {
+		values := jsonValues(row, types)
+		// Build the object by hand to keep the column order of the result.
+		output.WriteString("{")
+		for i, col := range result.Columns {
+			if i > 0 {
+				output.WriteString(",")
+			}
+			key, _ := json.Marshal(col.Name)
+			value, err := json.Marshal(values[i])
+			if err != nil {
+				return "", fmt.Errorf("failed to encode JSON row: %w", err)
+			}
+			output.Write(key)
+			output.WriteString(":")
+			output.Write(value)
+		}
+		output.WriteString("}\n")
+	}
+	return output.String(), nil
+}
+
+func formatResultCSV(result *queryResult) (string, error) {
+	types := parseColumnTypes(result.Columns)
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(result.columnNames()); err != nil {
+		return "", fmt.Errorf("failed to encode CSV header: %w", err)
+	}
+	for _, row := range result.Rows {
+		if err := writer.Write(convertValuesToStrings(row, types)); err != nil {
+			return "", fmt.Errorf("failed to encode CSV row: %w", err)
+		}
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("failed to encode CSV result: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// tsvEscaper escapes values the way ClickHouse's TabSeparated format does.
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func formatResultTSV(result *queryResult) string {
+	types := parseColumnTypes(result.Columns)
+	var output strings.Builder
+	writeLine := func(values []string) {
+		for i, v := range values {
+			if i > 0 {
+				output.WriteString("\t")
+			}
+			output.WriteString(tsvEscaper.Replace(v))
+		}
+		output.WriteString("\n")
+	}
+
+	writeLine(result.columnNames())
+	for _, row := range result.Rows {
+		writeLine(convertValuesToStrings(row, types))
+	}
+	return output.String()
+}
+
+// markdownEscaper keeps cell values from breaking the table layout.
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>")
+
+func formatResultMarkdown(result *queryResult) string {
+	types := parseColumnTypes(result.Columns)
+	var output strings.Builder
+	writeLine := func(values []string) {
+		output.WriteString("|")
+		for _, v := range values {
+			output.WriteString(" " + markdownEscaper.Replace(v) + " |")
+		}
+		output.WriteString("\n")
+	}
+
+	columnNames := result.columnNames()
+	writeLine(columnNames)
+	output.WriteString("|" + strings.Repeat(" --- |", len(columnNames)) + "\n")
+	for _, row := range result.Rows {
+		writeLine(convertValuesToStrings(row, types))
+	}
+
+	output.WriteString(fmt.Sprintf("\n%d rows", len(result.Rows)))
+	if result.Truncated {
+		output.WriteString(fmt.Sprintf(" (truncated at %d)", result.Limit))
+	}
+	output.WriteString("\n")
+	return output.String()
+}
+
+func (r *queryResult) columnNames() []string {
+	names := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// jsonFloat keeps NaN and infinities, which JSON cannot represent, as strings.
+func jsonFloat(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return f
+}
@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeColumnType is a driver.ColumnType with a fixed name and ClickHouse type.
+type fakeColumnType struct {
+	name     string
+	typeName string
+}
+
+func (c fakeColumnType) Name() string             { return c.name }
+func (c fakeColumnType) Nullable() bool           { return strings.HasPrefix(c.typeName, "Nullable(") }
+func (c fakeColumnType) ScanType() reflect.Type   { return reflect.TypeOf("") }
+func (c fakeColumnType) DatabaseTypeName() string { return c.typeName }
+
+// fakeRows is an in-memory driver.Rows that records how far it was read.
+type fakeRows struct {
+	columns []fakeColumnType
+	data    [][]interface{}
+	pos     int
+	closed  bool
+
+	// ctx is the query context; cancelled records whether it was done at Close.
+	ctx       context.Context
+	cancelled bool
+}
+
+func (r *fakeRows) Next() bool {
+	if r.pos >= len(r.data) {
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, value := range r.data[r.pos-1] {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if target.Kind() == reflect.Ptr && v.Kind() != reflect.Ptr {
+			ptr := reflect.New(v.Type())
+			ptr.Elem().Set(v)
+			v = ptr
+		}
+		target.Set(v)
+	}
+	return nil
+}
+
+func (r *fakeRows) ScanStruct(dest any) error { return nil }
+func (r *fakeRows) Totals(dest ...any) error  { return nil }
+func (r *fakeRows) Err() error                { return nil }
+
+func (r *fakeRows) Close() error {
+	r.closed = true
+	r.cancelled = r.ctx != nil && r.ctx.Err() != nil
+	return nil
+}
+
+func (r *fakeRows) ColumnTypes() []driver.ColumnType {
+	types := make([]driver.ColumnType, len(r.columns))
+	for i, c := range r.columns {
+		types[i] = c
+	}
+	return types
+}
+
+func (r *fakeRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func newTestQueryResult(t *testing.T, limit int) *queryResult {
+	t.Helper()
+	rows := &fakeRows{
+		columns: []fakeColumnType{{"id", "UInt64"}, {"name", "String"}, {"created", "DateTime"}},
+		data: [][]interface{}{
+			{uint64(1), "plain", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{uint64(2), "with | pipe\nand newline", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+			{uint64(3), "third", time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	result, err := collectQueryResult(rows, limit)
+	if err != nil {
+		t.Fatalf("collectQueryResult() returned error: %v", err)
+	}
+	return result
+}
+
+func TestCollectQueryResult_Truncated(t *testing.T) {
+	result := newTestQueryResult(t, 2)
+	if len(result.Rows) != 2 {
+		t.Errorf("got %d rows, want 2", len(result.Rows))
+	}
+	if !result.Truncated {
+		t.Error("Expected result to be truncated")
+	}
+
+	result = newTestQueryResult(t, 3)
+	if result.Truncated {
+		t.Error("Expected result not to be truncated when all rows fit")
+	}
+}
+
+func TestParseQueryFormat(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+		wantErr  bool
+	}{
+		{nil, formatTable, false},
+		{"", formatTable, false},
+		{"JSON", formatJSON, false},
+		{"markdown", formatMarkdown, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		result, err := parseQueryFormat(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQueryFormat(%v) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if result != tt.expected {
+			t.Errorf("parseQueryFormat(%v) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestFormatQueryResult(t *testing.T) {
+	result := newTestQueryResult(t, 2)
+	result.Elapsed = 1500 * time.Microsecond
+	result.RowsRead = 3
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: formatTable,
+			expected: "Query Results:\n\nid | name | created\n-------------------\n" +
+				"1 | plain | 2024-01-02 03:04:05\n2 | with | pipe\nand newline | 2024-01-03 00:00:00\n" +
+				"\nTotal rows: 2 (limited to 2)\n",
+		},
+		{
+			format: formatJSON,
+			expected: `{"columns":[{"name":"id","type":"UInt64"},{"name":"name","type":"String"},{"name":"created","type":"DateTime"}],` +
+				`"rows":[[1,"plain","2024-01-02T03:04:05Z"],[2,"with | pipe\nand newline","2024-01-03T00:00:00Z"]],` +
+				`"meta":{"rows":2,"limit":2,"truncated":true,"elapsed_ms":1.5,"rows_read":3,"bytes_read":0}}`,
+		},
+		{
+			format: formatJSONL,
+			expected: `{"id":1,"name":"plain","created":"2024-01-02T03:04:05Z"}` + "\n" +
+				`{"id":2,"name":"with | pipe\nand newline","created":"2024-01-03T00:00:00Z"}` + "\n",
+		},
+		{
+			format: formatCSV,
+			expected: "id,name,created\n1,plain,2024-01-02 03:04:05\n" +
+				"2,\"with | pipe\nand newline\",2024-01-03 00:00:00\n",
+		},
+		{
+			format: formatTSV,
+			expected: "id\tname\tcreated\n1\tplain\t2024-01-02 03:04:05\n" +
+				"2\twith | pipe\\nand newline\t2024-01-03 00:00:00\n",
+		},
+		{
+			format: formatMarkdown,
+			expected: "| id | name | created |\n| --- | --- | --- |\n| 1 | plain | 2024-01-02 03:04:05 |\n" +
+				"| 2 | with \\| pipe<br>and newline | 2024-01-03 00:00:00 |\n\n2 rows (truncated at 2)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			output, err := formatQueryResult(result, tt.format)
+			if err != nil {
+				t.Fatalf("formatQueryResult(%s) returned error: %v", tt.format, err)
+			}
+			if output != tt.expected {
+				t.Errorf("formatQueryResult(%s) =\n%s\nwant\n%s", tt.format, output, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	envCHProfiles       = "CLICKHOUSE_PROFILES"
+	envCHDefaultProfile = "CLICKHOUSE_DEFAULT_PROFILE"
+	envCHConfigFile     = "CLICKHOUSE_CONFIG_FILE"
+
+	// legacyCHProfile names the profile configured by the plain CLICKHOUSE_* variables.
+	legacyCHProfile = "default"
+)
+
+// clickHouseConfigFile is the format of the file named by CLICKHOUSE_CONFIG_FILE.
+type clickHouseConfigFile struct {
+	DefaultProfile string                            `json:"default_profile"`
+	Profiles       map[string]*clickHouseFileProfile `json:"profiles"`
+}
+
+// clickHouseFileProfile is a profile of the config file. MaxExecutionTime is
+// a pointer so that an unset field gets the default, while 0 disables the
+// limit as it does in CLICKHOUSE_MAX_EXECUTION_TIME.
+type clickHouseFileProfile struct {
+	ClickHouseConfig
+	MaxExecutionTime *int `json:"max_execution_time"`
+}
+
+// clickHouseProfiles is the set of named connection profiles.
+type clickHouseProfiles struct {
+	names          []string
+	configs        map[string]*ClickHouseConfig
+	defaultProfile string
+}
+
+// loadClickHouseProfiles collects connection profiles from the optional config
+// file, CLICKHOUSE_PROFILES and the plain CLICKHOUSE_* variables. Profiles
+// defined in the environment override file profiles with the same name.
+func loadClickHouseProfiles() (*clickHouseProfiles, error) {
+	profiles := &clickHouseProfiles{configs: map[string]*ClickHouseConfig{}}
+
+	if path := os.Getenv(envCHConfigFile); path != "" {
+		file, err := readClickHouseConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, profile := range file.Profiles {
+			profiles.configs[name] = applyClickHouseDefaults(profile)
+		}
+		profiles.defaultProfile = file.DefaultProfile
+	}
+
+	for _, name := range strings.Split(os.Getenv(envCHProfiles), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		config := getClickHouseConfigFromEnv(name)
+		if config == nil {
+			return nil, fmt.Errorf("profile %q is listed in %s but %s is not set",
+				name, envCHProfiles, profileEnvVar(envCHHost, name))
+		}
+		profiles.configs[name] = config
+	}
+
+	if config := getClickHouseConfigFromEnv(""); config != nil {
+		profiles.configs[legacyCHProfile] = config
+	}
+
+	for name := range profiles.configs {
+		profiles.names = append(profiles.names, name)
+	}
+	sort.Strings(profiles.names)
+
+	if name := os.Getenv(envCHDefaultProfile); name != "" {
+		profiles.defaultProfile = name
+	}
+	if profiles.defaultProfile == "" && len(profiles.names) > 0 {
+		profiles.defaultProfile = profiles.names[0]
+		if _, ok := profiles.configs[legacyCHProfile]; ok {
+			profiles.defaultProfile = legacyCHProfile
+		}
+	}
+	if _, ok := profiles.configs[profiles.defaultProfile]; !ok && len(profiles.names) > 0 {
+		return nil, fmt.Errorf("default profile %q is not configured", profiles.defaultProfile)
+	}
+
+	return profiles, nil
+}
+
+func readClickHouseConfigFile(path string) (*clickHouseConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", envCHConfigFile, err)
+	}
+
+	var file clickHouseConfigFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for name, config := range file.Profiles {
+		if config == nil || config.Host == "" {
+			return nil, fmt.Errorf("profile %q in %s has no host", name, path)
+		}
+	}
+	return &file, nil
+}
+
+// applyClickHouseDefaults returns the configuration of a file profile with
+// its unset connection fields filled in.
+func applyClickHouseDefaults(profile *clickHouseFileProfile) *ClickHouseConfig {
+	config := &profile.ClickHouseConfig
+	if config.Port == 0 {
+		config.Port = defaultCHPort
+	}
+	if config.Database == "" {
+		config.Database = defaultCHDatabase
+	}
+	if config.Username == "" {
+		config.Username = defaultCHUsername
+	}
+	config.MaxExecutionTime = defaultCHMaxExecutionTime
+	if profile.MaxExecutionTime != nil {
+		config.MaxExecutionTime = *profile.MaxExecutionTime
+	}
+	config.ResultOverflowMode = parseOverflowMode(config.ResultOverflowMode)
+	return config
+}
+
+// profileEnvVar returns the profile-specific name of a CLICKHOUSE_* variable,
+// e.g. CLICKHOUSE_PROD_HOST for profile "prod". An empty profile returns envVar.
+func profileEnvVar(envVar, profile string) string {
+	if profile == "" {
+		return envVar
+	}
+	prefix := "CLICKHOUSE_" + strings.ToUpper(strings.ReplaceAll(profile, "-", "_")) + "_"
+	return strings.Replace(envVar, "CLICKHOUSE_", prefix, 1)
+}
+
+// profileLimitEnvVar returns the profile-specific variable for a limit if it is
+// set, and the shared one otherwise, so limits can be configured once for all profiles.
+func profileLimitEnvVar(envVar, profile string) string {
+	name := profileEnvVar(envVar, profile)
+	if _, ok := os.LookupEnv(name); ok {
+		return name
+	}
+	return envVar
+}
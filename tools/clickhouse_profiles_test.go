@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfileEnvVar(t *testing.T) {
+	tests := []struct {
+		envVar   string
+		profile  string
+		expected string
+	}{
+		{envCHHost, "", "CLICKHOUSE_HOST"},
+		{envCHHost, "prod", "CLICKHOUSE_PROD_HOST"},
+		{envCHPassword, "prod-replica", "CLICKHOUSE_PROD_REPLICA_PASSWORD"},
+		{envCHMaxResultRows, "staging", "CLICKHOUSE_STAGING_MAX_RESULT_ROWS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			result := profileEnvVar(tt.envVar, tt.profile)
+			if result != tt.expected {
+				t.Errorf("profileEnvVar(%q, %q) = %q, want %q", tt.envVar, tt.profile, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadClickHouseProfiles_Env(t *testing.T) {
+	t.Setenv(envCHProfiles, "prod, staging")
+	t.Setenv("CLICKHOUSE_PROD_HOST", "prod.example.com")
+	t.Setenv("CLICKHOUSE_PROD_PORT", "9440")
+	t.Setenv("CLICKHOUSE_PROD_SECURE", "true")
+	t.Setenv("CLICKHOUSE_STAGING_HOST", "staging.example.com")
+	t.Setenv(envCHMaxResultRows, "5000")
+	t.Setenv("CLICKHOUSE_STAGING_MAX_RESULT_ROWS", "100")
+	t.Setenv(envCHHost, "")
+
+	profiles, err := loadClickHouseProfiles()
+	if err != nil {
+		t.Fatalf("loadClickHouseProfiles() returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(profiles.names, []string{"prod", "staging"}) {
+		t.Errorf("names = %v, want [prod staging]", profiles.names)
+	}
+	if profiles.defaultProfile != "prod" {
+		t.Errorf("defaultProfile = %q, want %q", profiles.defaultProfile, "prod")
+	}
+
+	prod := profiles.configs["prod"]
+	if prod.Host != "prod.example.com" || prod.Port != 9440 || !prod.Secure || prod.MaxResultRows != 5000 {
+		t.Errorf("unexpected prod profile: %+v", prod)
+	}
+	staging := profiles.configs["staging"]
+	if staging.Port != defaultCHPort || staging.MaxResultRows != 100 {
+		t.Errorf("unexpected staging profile: %+v", staging)
+	}
+}
+
+func TestLoadClickHouseProfiles_LegacyIsDefault(t *testing.T) {
+	t.Setenv(envCHProfiles, "analytics")
+	t.Setenv("CLICKHOUSE_ANALYTICS_HOST", "analytics.example.com")
+	t.Setenv(envCHHost, "localhost")
+
+	profiles, err := loadClickHouseProfiles()
+	if err != nil {
+		t.Fatalf("loadClickHouseProfiles() returned error: %v", err)
+	}
+
+	if profiles.defaultProfile != legacyCHProfile {
+		t.Errorf("defaultProfile = %q, want %q", profiles.defaultProfile, legacyCHProfile)
+	}
+	if len(profiles.names) != 2 {
+		t.Errorf("names = %v, want 2 profiles", profiles.names)
+	}
+}
+
+func TestLoadClickHouseProfiles_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clickhouse.json")
+	content := `{
+		"default_profile": "replica",
+		"profiles": {
+			"replica": {"host": "replica.example.com", "database": "analytics"},
+			"archive": {"host": "archive.example.com", "port": 9001, "max_execution_time": 0},
+			"batch": {"host": "batch.example.com", "max_execution_time": 600}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envCHConfigFile, path)
+	t.Setenv(envCHProfiles, "")
+	t.Setenv(envCHHost, "")
+
+	profiles, err := loadClickHouseProfiles()
+	if err != nil {
+		t.Fatalf("loadClickHouseProfiles() returned error: %v", err)
+	}
+
+	if profiles.defaultProfile != "replica" {
+		t.Errorf("defaultProfile = %q, want %q", profiles.defaultProfile, "replica")
+	}
+	replica := profiles.configs["replica"]
+	if replica.Port != defaultCHPort || replica.Username != defaultCHUsername || replica.Database != "analytics" {
+		t.Errorf("file profile defaults not applied: %+v", replica)
+	}
+	for name, expected := range map[string]int{"replica": defaultCHMaxExecutionTime, "archive": 0, "batch": 600} {
+		if config := profiles.configs[name]; config.MaxExecutionTime != expected {
+			t.Errorf("profile %s max_execution_time = %d, want %d", name, config.MaxExecutionTime, expected)
+		}
+	}
+	if _, ok := clickHouseSettings(*profiles.configs["archive"])["max_execution_time"]; ok {
+		t.Error("max_execution_time 0 in the config file should leave the server's limit off")
+	}
+}
+
+func TestLoadClickHouseProfiles_Errors(t *testing.T) {
+	t.Run("missing host", func(t *testing.T) {
+		t.Setenv(envCHProfiles, "prod")
+		t.Setenv("CLICKHOUSE_PROD_HOST", "")
+		if _, err := loadClickHouseProfiles(); err == nil {
+			t.Error("Expected error for profile without host")
+		}
+	})
+
+	t.Run("unknown default", func(t *testing.T) {
+		t.Setenv(envCHProfiles, "")
+		t.Setenv(envCHHost, "localhost")
+		t.Setenv(envCHDefaultProfile, "prod")
+		if _, err := loadClickHouseProfiles(); err == nil {
+			t.Error("Expected error for unknown default profile")
+		}
+	})
+}
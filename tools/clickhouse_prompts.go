@@ -0,0 +1,310 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+const (
+	defaultSlowQueryMS  = 1000
+	slowQueryPromptRows = 20
+	// maxSchemaColumns caps the database schema embedded in the draft-query prompt.
+	maxSchemaColumns = 2000
+)
+
+var (
+	connectionPromptArgument = mcp.PromptArgument{
+		Name:        "connection",
+		Description: ptr("Connection profile to use (optional, uses the default profile if not specified)"),
+	}
+	tablePromptArgument = mcp.PromptArgument{
+		Name:        "table",
+		Description: ptr("Table as database.table, or table in the connection's default database"),
+		Required:    ptr(true),
+	}
+)
+
+// NewExplainTablePrompt creates a prompt asking to explain a table, with its
+// schema and sample rows embedded.
+func NewExplainTablePrompt(client *ClickHouseClient) fxctx.Prompt {
+	return fxctx.NewPrompt(
+		mcp.Prompt{
+			Name:        "clickhouse-explain-table",
+			Description: ptr("Explain what a ClickHouse table contains and how it is organized, based on its schema and sample rows"),
+			Arguments: []mcp.PromptArgument{
+				tablePromptArgument,
+				{
+					Name:        "column",
+					Description: ptr("Column to focus the explanation on (optional)"),
+				},
+				connectionPromptArgument,
+			},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			args := req.Params.Arguments
+			resource, err := promptTableResource(client, args)
+			if err != nil {
+				return nil, err
+			}
+			contents, err := readTableResource(ctx, client, resource)
+			if err != nil {
+				return nil, err
+			}
+
+			text := fmt.Sprintf("Explain the ClickHouse table %s.%s: what each column means, how the data is "+
+				"partitioned and sorted, which queries the sorting key makes efficient, and anything unusual "+
+				"about its types, defaults, codecs or TTL. The schema and sample rows are attached.",
+				resource.Database, resource.Table)
+			if column := strings.TrimSpace(args["column"]); column != "" {
+				// The column may have been completed as table.column or database.table.column.
+				column = column[strings.LastIndexByte(column, '.')+1:]
+				text += fmt.Sprintf(" Focus on the column %s: its meaning, its value distribution in the "+
+					"sample and how it is used by the table's keys.", column)
+			}
+			return promptResult("Explain table "+resource.Database+"."+resource.Table,
+				textMessage(text), resourceMessage(contents))
+		},
+	)
+}
+
+// NewSlowQueriesPrompt creates a prompt asking to analyze the slowest queries
+// of the last hour, with the matching query_log entries embedded.
+func NewSlowQueriesPrompt(client *ClickHouseClient) fxctx.Prompt {
+	return fxctx.NewPrompt(
+		mcp.Prompt{
+			Name:        "clickhouse-slow-queries",
+			Description: ptr("Find and analyze the slowest ClickHouse queries of the last hour from system.query_log"),
+			Arguments: []mcp.PromptArgument{
+				{
+					Name:        "min_duration_ms",
+					Description: ptr(fmt.Sprintf("Only include queries that ran at least this long (default: %d)", defaultSlowQueryMS)),
+				},
+				connectionPromptArgument,
+			},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			args := req.Params.Arguments
+			minDuration := defaultSlowQueryMS
+			if value := args["min_duration_ms"]; value != "" {
+				parsed, err := strconv.Atoi(value)
+				if err != nil || parsed < 0 {
+					return nil, fmt.Errorf("min_duration_ms must be a non-negative integer, got %q", value)
+				}
+				minDuration = parsed
+			}
+
+			query := fmt.Sprintf(`SELECT event_time, query_duration_ms, read_rows,
+       formatReadableSize(read_bytes) AS read_size, formatReadableSize(memory_usage) AS memory,
+       user, query_id, substring(query, 1, 1000) AS query
+FROM system.query_log
+WHERE type = 'QueryFinish' AND event_time >= now() - INTERVAL 1 HOUR AND query_duration_ms >= %d
+ORDER BY query_duration_ms DESC
+LIMIT %d`, minDuration, slowQueryPromptRows)
+
+			result, err := client.query(ctx, args["connection"], query, slowQueryPromptRows)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read system.query_log: %w", err)
+			}
+
+			text := fmt.Sprintf("These are the slowest queries of the last hour that ran for at least %d ms, "+
+				"from system.query_log. Group them by pattern, explain the likely cause of each slowdown "+
+				"(full scans, missing use of the sorting key, large JOINs, memory pressure, ...) and suggest "+
+				"concrete fixes. Use clickhouse-describe and clickhouse-query to check table schemas if needed.\n\n%s",
+				minDuration, formatResultMarkdown(result))
+			return promptResult("Slow queries of the last hour", textMessage(text))
+		},
+	)
+}
+
+// NewColumnCardinalityPrompt creates a prompt asking to profile the
+// cardinality of a table's columns, with the schema and a ready query embedded.
+func NewColumnCardinalityPrompt(client *ClickHouseClient) fxctx.Prompt {
+	return fxctx.NewPrompt(
+		mcp.Prompt{
+			Name:        "clickhouse-column-cardinality",
+			Description: ptr("Profile the cardinality of every column of a ClickHouse table"),
+			Arguments:   []mcp.PromptArgument{tablePromptArgument, connectionPromptArgument},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			resource, err := promptTableResource(client, req.Params.Arguments)
+			if err != nil {
+				return nil, err
+			}
+
+			var desc *tableDescription
+			err = client.Do(ctx, resource.Connection, func(conn driver.Conn) error {
+				desc, err = describeTable(ctx, conn, resource.Database, resource.Table)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe %s.%s: %w", resource.Database, resource.Table, err)
+			}
+			schema, err := formatTableDescription(desc, formatTable)
+			if err != nil {
+				return nil, err
+			}
+
+			text := fmt.Sprintf("Profile the column cardinality of %s.%s. Run this query with clickhouse-query "+
+				"(uniq is approximate and cheap; add a SAMPLE clause or a WHERE on the partition key if the "+
+				"table is very large):\n\n```sql\n%s\n```\n\nThen classify each column as constant, low "+
+				"cardinality (a LowCardinality or Enum candidate), high cardinality or unique, and point out "+
+				"columns whose type or position in the sorting key does not fit their cardinality.\n\n%s",
+				resource.Database, resource.Table, cardinalityQuery(desc), schema)
+			return promptResult("Column cardinality of "+resource.Database+"."+resource.Table, textMessage(text))
+		},
+	)
+}
+
+// NewDraftQueryPrompt creates a prompt asking to draft a query answering a
+// question, with the schema of the database embedded.
+func NewDraftQueryPrompt(client *ClickHouseClient) fxctx.Prompt {
+	return fxctx.NewPrompt(
+		mcp.Prompt{
+			Name:        "clickhouse-draft-query",
+			Description: ptr("Draft a ClickHouse SQL query that answers a question against a database"),
+			Arguments: []mcp.PromptArgument{
+				{
+					Name:        "question",
+					Description: ptr("The question the query should answer"),
+					Required:    ptr(true),
+				},
+				{
+					Name:        "database",
+					Description: ptr("Database to query"),
+					Required:    ptr(true),
+				},
+				connectionPromptArgument,
+			},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			args := req.Params.Arguments
+			question := strings.TrimSpace(args["question"])
+			database := strings.TrimSpace(args["database"])
+			if question == "" || database == "" {
+				return nil, errors.New("question and database are required")
+			}
+
+			schema, err := databaseSchema(ctx, client, args["connection"], database)
+			if err != nil {
+				return nil, err
+			}
+
+			text := fmt.Sprintf("Draft a ClickHouse SQL query against database %s that answers this question:\n\n%s\n\n"+
+				"Use only the tables and columns listed below, qualify table names with the database, prefer "+
+				"filters on partition and sorting keys, and add a LIMIT. Explain any assumption you make about "+
+				"the meaning of columns, then run the query with clickhouse-query to check it.\n\n%s",
+				database, question, schema)
+			return promptResult("Draft a query against "+database, textMessage(text))
+		},
+	)
+}
+
+// promptTableResource resolves the table and connection arguments of a prompt.
+func promptTableResource(client *ClickHouseClient, args map[string]string) (tableResource, error) {
+	name := strings.TrimSpace(args["table"])
+	if name == "" {
+		return tableResource{}, errors.New("table is required")
+	}
+
+	profile := args["connection"]
+	config, err := client.Config(profile)
+	if err != nil {
+		return tableResource{}, err
+	}
+	if profile == "" {
+		profile = client.DefaultProfile()
+	}
+
+	database, table := parseTableName(name, config.Database)
+	return tableResource{Connection: profile, Database: database, Table: table}, nil
+}
+
+// cardinalityQuery builds a query computing the distinct count of every column.
+func cardinalityQuery(desc *tableDescription) string {
+	exprs := []string{"count() AS total_rows"}
+	for _, col := range desc.Columns {
+		exprs = append(exprs, fmt.Sprintf("uniq(%s) AS %s", quoteIdentifier(col.Name), quoteIdentifier(col.Name)))
+	}
+	return fmt.Sprintf("SELECT\n    %s\nFROM %s.%s", strings.Join(exprs, ",\n    "),
+		quoteIdentifier(desc.Database), quoteIdentifier(desc.Name))
+}
+
+type schemaColumn struct {
+	Table   string `ch:"table"`
+	Name    string `ch:"name"`
+	Type    string `ch:"type"`
+	Comment string `ch:"comment"`
+}
+
+// databaseSchema lists the columns of every table of database as text.
+func databaseSchema(ctx context.Context, client *ClickHouseClient, profile, database string) (string, error) {
+	var columns []schemaColumn
+	err := client.Do(ctx, profile, func(conn driver.Conn) error {
+		columns = nil
+		queryCtx, _ := tagQuery(ctx)
+		return conn.Select(queryCtx, &columns, fmt.Sprintf(`SELECT table, name, type, comment
+FROM system.columns
+WHERE database = ?
+ORDER BY table, position
+LIMIT %d`, maxSchemaColumns+1), database)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read the schema of %s: %w", database, err)
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("database %s has no tables or does not exist", database)
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Schema of database %s:\n", database))
+	table := ""
+	for i, col := range columns {
+		if i == maxSchemaColumns {
+			output.WriteString("\n(schema truncated; use clickhouse-describe for the remaining tables)\n")
+			break
+		}
+		if col.Table != table {
+			table = col.Table
+			output.WriteString(fmt.Sprintf("\nTable %s.%s:\n", database, table))
+		}
+		output.WriteString(fmt.Sprintf("  %s %s", col.Name, col.Type))
+		if col.Comment != "" {
+			output.WriteString(" -- " + col.Comment)
+		}
+		output.WriteString("\n")
+	}
+	return output.String(), nil
+}
+
+func textMessage(text string) mcp.PromptMessage {
+	return mcp.PromptMessage{
+		Role:    mcp.RoleUser,
+		Content: mcp.TextContent{Type: "text", Text: text},
+	}
+}
+
+// resourceMessage embeds the contents of a resource read into a prompt message.
+func resourceMessage(result *mcp.ReadResourceResult) mcp.PromptMessage {
+	var resource interface{}
+	if len(result.Contents) > 0 {
+		resource = result.Contents[0]
+	}
+	return mcp.PromptMessage{
+		Role:    mcp.RoleUser,
+		Content: mcp.EmbeddedResource{Type: "resource", Resource: resource},
+	}
+}
+
+func promptResult(description string, messages ...mcp.PromptMessage) (*mcp.GetPromptResult, error) {
+	return &mcp.GetPromptResult{
+		Description: ptr(description),
+		Messages:    messages,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestCardinalityQuery(t *testing.T) {
+	desc := &tableDescription{
+		Database: "db",
+		Name:     "events",
+		Columns:  []columnDescription{{Name: "id"}, {Name: "user`name"}},
+	}
+
+	expected := "SELECT\n    count() AS total_rows,\n    uniq(`id`) AS `id`,\n    uniq(`user\\`name`) AS `user\\`name`\nFROM `db`.`events`"
+	if result := cardinalityQuery(desc); result != expected {
+		t.Errorf("cardinalityQuery() = %q, want %q", result, expected)
+	}
+}
+
+func TestPromptTableResource(t *testing.T) {
+	client := newClickHouseClient(&clickHouseProfiles{
+		names:          []string{"default", "prod"},
+		configs:        map[string]*ClickHouseConfig{"default": {Database: "main"}, "prod": {Database: "analytics"}},
+		defaultProfile: "default",
+	})
+
+	tests := []struct {
+		args     map[string]string
+		expected tableResource
+	}{
+		{map[string]string{"table": "events"}, tableResource{"default", "main", "events"}},
+		{map[string]string{"table": "logs.events", "connection": "prod"}, tableResource{"prod", "logs", "events"}},
+		{map[string]string{"table": "events", "connection": "prod"}, tableResource{"prod", "analytics", "events"}},
+	}
+
+	for _, test := range tests {
+		result, err := promptTableResource(client, test.args)
+		if err != nil {
+			t.Errorf("promptTableResource(%v) returned error: %v", test.args, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("promptTableResource(%v) = %+v, want %+v", test.args, result, test.expected)
+		}
+	}
+
+	if _, err := promptTableResource(client, map[string]string{}); err == nil {
+		t.Error("Expected a missing table to be rejected")
+	}
+	if _, err := promptTableResource(client, map[string]string{"table": "t", "connection": "nope"}); err == nil {
+		t.Error("Expected an unknown connection to be rejected")
+	}
+}
+
+func TestPromptMux_CompleteConnection(t *testing.T) {
+	client := newClickHouseClient(&clickHouseProfiles{
+		names:          []string{"default", "prod-eu", "prod-us"},
+		configs:        map[string]*ClickHouseConfig{"default": {}, "prod-eu": {}, "prod-us": {}},
+		defaultProfile: "default",
+	})
+	mux := DecoratePromptMux(fxctx.NewPromptMux([]fxctx.Prompt{NewExplainTablePrompt(client)}), NewClickHouseCompleter(client))
+	req := &mcp.CompleteRequest{Params: mcp.CompleteRequestParams{
+		Argument: mcp.CompleteRequestParamsArgument{Name: "connection", Value: "PROD"},
+	}}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected []string
+	}{
+		{"stdio", context.Background(), []string{"prod-eu", "prod-us"}},
+		{"scoped caller", withCaller(context.Background(), &Caller{Name: "ci", Connections: []string{"prod-eu"}}), []string{"prod-eu"}},
+	}
+
+	for _, test := range tests {
+		result, err := mux.Complete(test.ctx, req, "clickhouse-explain-table")
+		if err != nil {
+			t.Fatalf("%s: Complete() returned error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(result.Completion.Values, test.expected) {
+			t.Errorf("%s: Complete() = %v, want %v", test.name, result.Completion.Values, test.expected)
+		}
+	}
+
+	if _, err := mux.Complete(context.Background(), req, "no-such-prompt"); err == nil {
+		t.Error("Expected an error completing an unknown prompt")
+	}
+}
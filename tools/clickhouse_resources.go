@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+const (
+	tableResourceScheme   = "clickhouse://"
+	tableResourceTemplate = "clickhouse://{connection}/{database}/{table}"
+	tableResourceMimeType = "text/plain"
+
+	// resourceSampleRows is the number of rows included when a table resource is read.
+	resourceSampleRows = 5
+)
+
+// clickHouseResourceTemplates are advertised by resources/templates/list.
+var clickHouseResourceTemplates = []mcp.ResourceTemplate{
+	{
+		Name:        "ClickHouse table",
+		UriTemplate: tableResourceTemplate,
+		Description: ptr("Schema, storage metadata and a few sample rows of a ClickHouse table"),
+		MimeType:    ptr(tableResourceMimeType),
+	},
+}
+
+// tableResource identifies a table of a connection profile.
+type tableResource struct {
+	Connection string
+	Database   string
+	Table      string
+}
+
+func (r tableResource) URI() string {
+	return tableResourceScheme + url.PathEscape(r.Connection) + "/" +
+		url.PathEscape(r.Database) + "/" + url.PathEscape(r.Table)
+}
+
+// parseTableResourceURI parses clickhouse://{connection}/{database}/{table}.
+// It reports false for URIs of other schemes and malformed table URIs.
+func parseTableResourceURI(uri string) (tableResource, bool) {
+	rest, ok := strings.CutPrefix(uri, tableResourceScheme)
+	if !ok {
+		return tableResource{}, false
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 {
+		return tableResource{}, false
+	}
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil || unescaped == "" {
+			return tableResource{}, false
+		}
+		parts[i] = unescaped
+	}
+	return tableResource{Connection: parts[0], Database: parts[1], Table: parts[2]}, true
+}
+
+// templateConnection returns the connection of a reference to the table
+// resource template: empty for the template itself, or the profile filled in
+// for {connection}. It reports false for other URIs.
+func templateConnection(uri string) (string, bool) {
+	if uri == tableResourceTemplate {
+		return "", true
+	}
+	rest, ok := strings.CutPrefix(uri, tableResourceScheme)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || strings.ContainsAny(parts[0], "{}") {
+		return "", false
+	}
+	connection, err := url.PathUnescape(parts[0])
+	if err != nil || connection == "" {
+		return "", false
+	}
+	return connection, true
+}
+
+type tableListEntry struct {
+	Database string `ch:"database"`
+	Name     string `ch:"name"`
+	Engine   string `ch:"engine"`
+	Comment  string `ch:"comment"`
+}
+
+const listTablesQuery = `SELECT database, name, engine, comment
+FROM system.tables
+WHERE NOT is_temporary AND database NOT IN ('system', 'INFORMATION_SCHEMA', 'information_schema')
+ORDER BY database, name`
+
+// NewClickHouseResourceProvider exposes every table of every connection
+// profile as a resource.
+func NewClickHouseResourceProvider(client *ClickHouseClient) fxctx.ResourceProvider {
+	return fxctx.NewResourceProvider(
+		func(ctx context.Context) ([]mcp.Resource, error) {
+			return listTableResources(ctx, client)
+		},
+		func(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+			resource, ok := parseTableResourceURI(uri)
+			if !ok {
+				if strings.HasPrefix(uri, tableResourceScheme) {
+					return nil, fmt.Errorf("invalid resource URI %q, expected %s", uri, tableResourceTemplate)
+				}
+				return nil, nil
+			}
+			return readTableResource(ctx, client, resource)
+		},
+	)
+}
+
+// listTableResources lists the tables of all profiles the caller may use. Profiles that cannot be
+// reached are left out, so one broken connection does not hide the others.
+func listTableResources(ctx context.Context, client *ClickHouseClient) ([]mcp.Resource, error) {
+	resources := []mcp.Resource{}
+	for _, profile := range client.AllowedProfiles(ctx) {
+		var tables []tableListEntry
+		err := client.Do(ctx, profile, func(conn driver.Conn) error {
+			tables = nil
+			queryCtx, _ := tagQuery(ctx)
+			return conn.Select(queryCtx, &tables, listTablesQuery)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		for _, table := range tables {
+			resource := tableResource{Connection: profile, Database: table.Database, Table: table.Name}
+			description := fmt.Sprintf("%s table on connection %s", table.Engine, profile)
+			if table.Comment != "" {
+				description += ": " + table.Comment
+			}
+			resources = append(resources, mcp.Resource{
+				Uri:         resource.URI(),
+				Name:        table.Database + "." + table.Name,
+				Description: ptr(description),
+				MimeType:    ptr(tableResourceMimeType),
+			})
+		}
+	}
+	return resources, nil
+}
+
+// readTableResource returns the description of a table followed by a sample of its rows.
+func readTableResource(ctx context.Context, client *ClickHouseClient, resource tableResource) (*mcp.ReadResourceResult, error) {
+	var (
+		desc   *tableDescription
+		sample *queryResult
+	)
+	err := client.Do(ctx, resource.Connection, func(conn driver.Conn) error {
+		var err error
+		if desc, err = describeTable(ctx, conn, resource.Database, resource.Table); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT %d",
+			quoteIdentifier(resource.Database), quoteIdentifier(resource.Table), resourceSampleRows)
+		sample, err = executeQuery(ctx, conn, query, resourceSampleRows)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s: %w", resource.Database, resource.Table, err)
+	}
+
+	text, err := formatTableDescription(desc, formatTable)
+	if err != nil {
+		return nil, err
+	}
+	text += "\nSample rows:\n" + formatResultMarkdown(sample)
+
+	return &mcp.ReadResourceResult{
+		Contents: []interface{}{
+			mcp.TextResourceContents{
+				Uri:      resource.URI(),
+				MimeType: ptr(tableResourceMimeType),
+				Text:     text,
+			},
+		},
+	}, nil
+}
+
+// tableStructure returns the CREATE statement of a table, which changes with
+// every schema change, or an empty string if the table does not exist.
+func tableStructure(ctx context.Context, client *ClickHouseClient, resource tableResource) (string, error) {
+	var statements []struct {
+		Statement string `ch:"create_table_query"`
+	}
+	err := client.Do(ctx, resource.Connection, func(conn driver.Conn) error {
+		statements = nil
+		queryCtx, _ := tagQuery(ctx)
+		return conn.Select(queryCtx, &statements,
+			"SELECT create_table_query FROM system.tables WHERE database = ? AND name = ?",
+			resource.Database, resource.Table)
+	})
+	if err != nil || len(statements) == 0 {
+		return "", err
+	}
+	return statements[0].Statement, nil
+}
+
+var identifierEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+// quoteIdentifier quotes a database or table name for use in a query.
+func quoteIdentifier(name string) string {
+	return "`" + identifierEscaper.Replace(name) + "`"
+}
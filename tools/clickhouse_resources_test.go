@@ -0,0 +1,74 @@
+package tools
+
+import "testing"
+
+func TestTableResourceURI(t *testing.T) {
+	tests := []struct {
+		resource tableResource
+		uri      string
+	}{
+		{tableResource{"default", "analytics", "events"}, "clickhouse://default/analytics/events"},
+		{tableResource{"prod-eu", "my db", "a/b"}, "clickhouse://prod-eu/my%20db/a%2Fb"},
+	}
+
+	for _, test := range tests {
+		if uri := test.resource.URI(); uri != test.uri {
+			t.Errorf("URI() = %q, want %q", uri, test.uri)
+		}
+		resource, ok := parseTableResourceURI(test.uri)
+		if !ok || resource != test.resource {
+			t.Errorf("parseTableResourceURI(%q) = %+v, %v, want %+v", test.uri, resource, ok, test.resource)
+		}
+	}
+}
+
+func TestParseTableResourceURI_Invalid(t *testing.T) {
+	for _, uri := range []string{
+		"file:///etc/passwd",
+		"clickhouse://default/analytics",
+		"clickhouse://default/analytics/events/extra",
+		"clickhouse://default//events",
+		"clickhouse://default/%zz/events",
+	} {
+		if resource, ok := parseTableResourceURI(uri); ok {
+			t.Errorf("parseTableResourceURI(%q) = %+v, want invalid", uri, resource)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"events", "`events`"},
+		{"we`ird", "`we\\`ird`"},
+		{`back\slash`, "`back\\\\slash`"},
+	}
+
+	for _, test := range tests {
+		if result := quoteIdentifier(test.input); result != test.expected {
+			t.Errorf("quoteIdentifier(%q) = %q, want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestTemplateConnection(t *testing.T) {
+	tests := []struct {
+		uri        string
+		connection string
+		ok         bool
+	}{
+		{tableResourceTemplate, "", true},
+		{"clickhouse://prod/{database}/{table}", "prod", true},
+		{"clickhouse://prod%2Feu/main/{table}", "prod/eu", true},
+		{"clickhouse://{conn}/{database}/{table}", "", false},
+		{"clickhouse://prod/main", "", false},
+		{"file:///etc/{table}", "", false},
+	}
+	for _, test := range tests {
+		if connection, ok := templateConnection(test.uri); connection != test.connection || ok != test.ok {
+			t.Errorf("templateConnection(%q) = %q, %v, want %q, %v", test.uri, connection, ok, test.connection, test.ok)
+		}
+	}
+}
@@ -0,0 +1,655 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sqlTokenKind classifies a lexical token of a ClickHouse SQL query.
+type sqlTokenKind int
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+// sqlToken is a single lexical token together with its byte offset in the query.
+type sqlToken struct {
+	Kind sqlTokenKind
+	Text string
+	Pos  int
+}
+
+// is reports whether the token is a bare word equal to keyword (case-insensitive).
+func (t sqlToken) is(keyword string) bool {
+	return t.Kind == tokenWord && strings.EqualFold(t.Text, keyword)
+}
+
+// isPunct reports whether the token is the given punctuation or operator.
+func (t sqlToken) isPunct(punct string) bool {
+	return t.Kind == tokenPunct && t.Text == punct
+}
+
+// unsafeQueryError explains why a query was rejected by the read-only validator.
+type unsafeQueryError struct {
+	Token  string
+	Pos    int
+	Reason string
+}
+
+func (e *unsafeQueryError) Error() string {
+	if e.Token == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s (token %q at position %d)", e.Reason, e.Token, e.Pos+1)
+}
+
+func newUnsafeQueryError(token sqlToken, reason string) *unsafeQueryError {
+	return &unsafeQueryError{Token: token.Text, Pos: token.Pos, Reason: reason}
+}
+
+// readOnlyStatements are the statement keywords accepted at the start of a query.
+var readOnlyStatements = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"EXPLAIN":  true,
+	"EXISTS":   true,
+}
+
+// writeStatements are statement keywords that modify data, schema or server state.
+var writeStatements = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"ALTER":    true,
+	"CREATE":   true,
+	"DROP":     true,
+	"TRUNCATE": true,
+	"RENAME":   true,
+	"EXCHANGE": true,
+	"ATTACH":   true,
+	"DETACH":   true,
+	"UNDROP":   true,
+	"OPTIMIZE": true,
+	"GRANT":    true,
+	"REVOKE":   true,
+	"KILL":     true,
+	"SYSTEM":   true,
+	"SET":      true,
+	"USE":      true,
+	"BACKUP":   true,
+	"RESTORE":  true,
+}
+
+// explainKinds are the words that may follow EXPLAIN before the explained statement.
+var explainKinds = map[string]bool{
+	"AST":      true,
+	"SYNTAX":   true,
+	"QUERY":    true,
+	"TREE":     true,
+	"PLAN":     true,
+	"PIPELINE": true,
+	"ESTIMATE": true,
+	"TABLE":    true,
+	"OVERRIDE": true,
+}
+
+// dangerousTableFunctions reach outside the database (files, network, processes)
+// and are rejected wherever they are called. Keys are lower-case.
+var dangerousTableFunctions = map[string]bool{
+	"url":                     true,
+	"urlcluster":              true,
+	"file":                    true,
+	"filecluster":             true,
+	"s3":                      true,
+	"s3cluster":               true,
+	"gcs":                     true,
+	"oss":                     true,
+	"cosn":                    true,
+	"azureblobstorage":        true,
+	"azureblobstoragecluster": true,
+	"hdfs":                    true,
+	"hdfscluster":             true,
+	"hive":                    true,
+	"remote":                  true,
+	"remotesecure":            true,
+	"executable":              true,
+	"mysql":                   true,
+	"postgresql":              true,
+	"mongodb":                 true,
+	"redis":                   true,
+	"sqlite":                  true,
+	"jdbc":                    true,
+	"odbc":                    true,
+	"arrowflight":             true,
+	"iceberg":                 true,
+	"icebergcluster":          true,
+	"iceberglocal":            true,
+	"icebergs3":               true,
+	"icebergs3cluster":        true,
+	"icebergazure":            true,
+	"icebergazurecluster":     true,
+	"iceberghdfs":             true,
+	"iceberghdfscluster":      true,
+	"deltalake":               true,
+	"deltalakecluster":        true,
+	"deltalakelocal":          true,
+	"deltalakes3":             true,
+	"deltalakes3cluster":      true,
+	"deltalakeazure":          true,
+	"deltalakeazurecluster":   true,
+	"hudi":                    true,
+	"hudicluster":             true,
+}
+
+// allowedTableFunctions are the only table functions accepted where a table
+// is expected, so that table functions added by newer servers are refused
+// until they are known to stay inside the database. Keys are lower-case.
+var allowedTableFunctions = map[string]bool{
+	"numbers":            true,
+	"numbers_mt":         true,
+	"zeros":              true,
+	"zeros_mt":           true,
+	"generaterandom":     true,
+	"generate_series":    true,
+	"generateseries":     true,
+	"values":             true,
+	"null":               true,
+	"merge":              true,
+	"view":               true,
+	"viewifpermitted":    true,
+	"viewexplain":        true,
+	"dictionary":         true,
+	"format":             true,
+	"cluster":            true,
+	"clusterallreplicas": true,
+	"loop":               true,
+}
+
+// multiCharOperators lists operators longer than one character, longest first.
+var multiCharOperators = []string{"::", "->", "<=", ">=", "!=", "<>", "==", "||"}
+
+// tokenizeSQL splits a ClickHouse query into tokens. Whitespace and comments
+// (--, #, and nested /* */) are dropped; string literals, quoted identifiers
+// and heredocs are kept as single tokens.
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case isSQLSpace(c):
+			i++
+
+		case c == '-' && strings.HasPrefix(query[i:], "--"), c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end, ok := skipBlockComment(query, i)
+			if !ok {
+				return nil, &unsafeQueryError{Token: "/*", Pos: i, Reason: "unterminated block comment"}
+			}
+			i = end
+
+		case c == '\'' || c == '"' || c == '`':
+			end, ok := skipQuoted(query, i, c)
+			if !ok {
+				return nil, &unsafeQueryError{Token: string(c), Pos: i, Reason: "unterminated quoted literal"}
+			}
+			kind := tokenQuotedIdent
+			if c == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, sqlToken{Kind: kind, Text: query[i:end], Pos: i})
+			i = end
+
+		case c == '$':
+			end, ok := skipHeredoc(query, i)
+			if !ok {
+				return nil, &unsafeQueryError{Token: "$", Pos: i, Reason: "unterminated heredoc literal"}
+			}
+			tokens = append(tokens, sqlToken{Kind: tokenString, Text: query[i:end], Pos: i})
+			i = end
+
+		case isSQLDigit(c) || (c == '.' && i+1 < len(query) && isSQLDigit(query[i+1]) && !followsWord(tokens)):
+			end := skipNumber(query, i)
+			tokens = append(tokens, sqlToken{Kind: tokenNumber, Text: query[i:end], Pos: i})
+			i = end
+
+		case isSQLWordStart(c):
+			end := i + 1
+			for end < len(query) && isSQLWordPart(query[end]) {
+				end++
+			}
+			tokens = append(tokens, sqlToken{Kind: tokenWord, Text: query[i:end], Pos: i})
+			i = end
+
+		default:
+			text := query[i : i+1]
+			for _, op := range multiCharOperators {
+				if strings.HasPrefix(query[i:], op) {
+					text = op
+					break
+				}
+			}
+			tokens = append(tokens, sqlToken{Kind: tokenPunct, Text: text, Pos: i})
+			i += len(text)
+		}
+	}
+	return tokens, nil
+}
+
+// validateReadOnlyQuery checks that query is a single read-only statement.
+// It returns an *unsafeQueryError naming the offending token otherwise.
+func validateReadOnlyQuery(query string) error {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return err
+	}
+
+	statements := splitStatements(tokens)
+	if len(statements) == 0 {
+		return &unsafeQueryError{Reason: "query is empty"}
+	}
+	if len(statements) > 1 {
+		return newUnsafeQueryError(statements[1][0], "multiple statements are not allowed")
+	}
+
+	if err := checkForbiddenConstructs(statements[0]); err != nil {
+		return err
+	}
+	if err := checkQuerySettings(statements[0]); err != nil {
+		return err
+	}
+	return validateStatement(statements[0])
+}
+
+// splitStatements splits tokens on top-level semicolons, dropping empty statements.
+func splitStatements(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	start := 0
+	for i, tok := range tokens {
+		if tok.isPunct(";") {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// fromClauseEnds are the keywords that end the table list of a FROM clause.
+var fromClauseEnds = map[string]bool{
+	"WHERE":     true,
+	"PREWHERE":  true,
+	"GROUP":     true,
+	"ORDER":     true,
+	"LIMIT":     true,
+	"HAVING":    true,
+	"WINDOW":    true,
+	"QUALIFY":   true,
+	"SETTINGS":  true,
+	"FORMAT":    true,
+	"UNION":     true,
+	"EXCEPT":    true,
+	"INTERSECT": true,
+	"ON":        true,
+	"USING":     true,
+	"SELECT":    true,
+	"ARRAY":     true,
+	"INTO":      true,
+}
+
+// checkForbiddenConstructs rejects INTO OUTFILE, dangerous table functions
+// anywhere in the statement, including subqueries, and table functions
+// outside allowedTableFunctions where a table is expected. Function names
+// are compared unquoted, as ClickHouse accepts quoted identifiers as names.
+func checkForbiddenConstructs(tokens []sqlToken) error {
+	// Per parenthesis depth: whether a SELECT has started at that depth, and
+	// whether its FROM clause is listing tables.
+	selects, tables := []bool{false}, []bool{false}
+	for i, tok := range tokens {
+		depth := len(tables) - 1
+		switch {
+		case tok.isPunct("("):
+			selects, tables = append(selects, false), append(tables, false)
+			continue
+		case tok.isPunct(")"):
+			if depth > 0 {
+				selects, tables = selects[:depth], tables[:depth]
+			}
+			continue
+		case tok.Kind != tokenWord && tok.Kind != tokenQuotedIdent:
+			continue
+		}
+
+		var before, prev, next sqlToken
+		if i > 1 {
+			before = tokens[i-2]
+		}
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		if tok.is("INTO") && next.is("OUTFILE") {
+			return newUnsafeQueryError(tok, "INTO OUTFILE is not allowed")
+		}
+
+		if next.isPunct("(") && !prev.isPunct(".") {
+			name := identifierName(tok)
+			if dangerousTableFunctions[strings.ToLower(name)] {
+				return newUnsafeQueryError(tok, fmt.Sprintf("function %s() accesses external resources and is not allowed", name))
+			}
+			described := prev.is("DESCRIBE") || prev.is("DESC") ||
+				(prev.is("TABLE") && (before.is("DESCRIBE") || before.is("DESC") || before.is("EXISTS")))
+			tablePosition := described || (prev.is("JOIN") && !before.is("ARRAY")) || (tables[depth] && (prev.is("FROM") || prev.isPunct(",")))
+			if tablePosition && !allowedTableFunctions[strings.ToLower(name)] {
+				return newUnsafeQueryError(tok, fmt.Sprintf("table function %s() is not allowed", name))
+			}
+		}
+
+		switch {
+		case tok.is("SELECT"):
+			selects[depth] = true
+			tables[depth] = false
+		case tok.is("FROM"):
+			// FROM also appears inside EXTRACT(... FROM ...) and the like.
+			tables[depth] = selects[depth]
+		case tok.is("JOIN"):
+			tables[depth] = !prev.is("ARRAY")
+		case tok.Kind == tokenWord && fromClauseEnds[strings.ToUpper(tok.Text)]:
+			tables[depth] = false
+		}
+	}
+	return nil
+}
+
+// identifierName returns the name a word or quoted identifier token stands
+// for, with quotes removed and escape sequences decoded.
+func identifierName(tok sqlToken) string {
+	if tok.Kind != tokenQuotedIdent || len(tok.Text) < 2 {
+		return tok.Text
+	}
+	quote := tok.Text[0]
+	text := tok.Text[1 : len(tok.Text)-1]
+	var name strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote && i+1 < len(text) && text[i+1] == quote:
+			i++
+		case c == '\\' && i+1 < len(text):
+			i++
+			c = text[i]
+			if c == 'x' && i+2 < len(text) {
+				if value, err := strconv.ParseUint(text[i+1:i+3], 16, 8); err == nil {
+					c = byte(value)
+					i += 2
+				}
+			} else if decoded, ok := sqlEscapes[c]; ok {
+				c = decoded
+			}
+		}
+		name.WriteByte(c)
+	}
+	return name.String()
+}
+
+// sqlEscapes decodes the single-character escape sequences of quoted literals.
+var sqlEscapes = map[byte]byte{
+	'0': 0, 'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+}
+
+// serverEnforcedSettings are the settings a query's SETTINGS clause may not
+// change. Connections use readonly=2 so that every query can carry its
+// log_comment, which also lets queries override any other setting; these
+// ones hold the server-side limits and the read-only mode in place.
+var serverEnforcedSettings = map[string]bool{
+	"readonly":    true,
+	"allow_ddl":   true,
+	"profile":     true,
+	"log_comment": true,
+	// Paging sets limit and offset itself.
+	"limit":  true,
+	"offset": true,
+}
+
+// isServerEnforcedSetting reports whether name is one of
+// serverEnforcedSettings or a limit: a max_, min_ or timeout_ setting other
+// than max_threads, or an overflow mode.
+func isServerEnforcedSetting(name string) bool {
+	name = strings.ToLower(name)
+	switch {
+	case serverEnforcedSettings[name]:
+		return true
+	case name == "max_threads":
+		return false
+	}
+	return strings.HasPrefix(name, "max_") || strings.HasPrefix(name, "min_") ||
+		strings.HasPrefix(name, "timeout_") || strings.HasSuffix(name, "_overflow_mode")
+}
+
+// checkQuerySettings rejects SETTINGS clauses, in the statement or any of its
+// subqueries, that change a server-enforced setting.
+func checkQuerySettings(tokens []sqlToken) error {
+	for i, tok := range tokens {
+		// A clause starts with "SETTINGS name =", which tells it apart from
+		// a column or table called settings.
+		if !tok.is("SETTINGS") || i+2 >= len(tokens) || !tokens[i+2].isPunct("=") {
+			continue
+		}
+		depth := 0
+		expectName := true
+	clause:
+		for j := i + 1; j < len(tokens); j++ {
+			t := tokens[j]
+			switch {
+			case t.isPunct("("), t.isPunct("["):
+				depth++
+			case t.isPunct(")"), t.isPunct("]"):
+				depth--
+				if depth < 0 {
+					break clause
+				}
+			case depth != 0:
+			case t.isPunct(","):
+				expectName = true
+			case expectName:
+				if (t.Kind != tokenWord && t.Kind != tokenQuotedIdent) || j+1 >= len(tokens) || !tokens[j+1].isPunct("=") {
+					break clause
+				}
+				if isServerEnforcedSetting(strings.Trim(t.Text, "`\"")) {
+					return newUnsafeQueryError(t, fmt.Sprintf("setting %s is enforced by the server and cannot be changed by a query", strings.Trim(t.Text, "`\"")))
+				}
+				expectName = false
+			}
+		}
+	}
+	return nil
+}
+
+// validateStatement checks the statement keyword of a single statement.
+func validateStatement(tokens []sqlToken) error {
+	// Parenthesised selects such as "(SELECT 1) UNION ALL (SELECT 2)".
+	start := 0
+	for start < len(tokens) && tokens[start].isPunct("(") {
+		start++
+	}
+	if start == len(tokens) {
+		return &unsafeQueryError{Reason: "query does not contain a statement"}
+	}
+
+	first := tokens[start]
+	keyword := strings.ToUpper(first.Text)
+	if first.Kind != tokenWord || !readOnlyStatements[keyword] {
+		return newUnsafeQueryError(first, "only SELECT, WITH, SHOW, DESCRIBE, EXPLAIN and EXISTS statements are allowed")
+	}
+
+	switch keyword {
+	case "WITH":
+		return validateWithStatement(tokens[start:])
+	case "EXPLAIN":
+		return validateExplainStatement(tokens[start:])
+	}
+	return nil
+}
+
+// validateWithStatement requires the main statement after a CTE list to be a SELECT.
+func validateWithStatement(tokens []sqlToken) error {
+	depth := 0
+	for _, tok := range tokens[1:] {
+		switch {
+		case tok.isPunct("("), tok.isPunct("["):
+			depth++
+		case tok.isPunct(")"), tok.isPunct("]"):
+			depth--
+		case depth == 0 && tok.is("SELECT"):
+			return nil
+		case depth == 0 && tok.Kind == tokenWord && writeStatements[strings.ToUpper(tok.Text)]:
+			return newUnsafeQueryError(tok, "WITH clause must be followed by SELECT")
+		}
+	}
+	return newUnsafeQueryError(tokens[0], "WITH clause must be followed by SELECT")
+}
+
+// validateExplainStatement skips the EXPLAIN kind and settings and validates
+// the explained statement.
+func validateExplainStatement(tokens []sqlToken) error {
+	i := 1
+	for i < len(tokens) {
+		tok := tokens[i]
+		switch {
+		case tok.Kind == tokenWord && explainKinds[strings.ToUpper(tok.Text)]:
+			i++
+		case tok.Kind == tokenWord && i+2 < len(tokens) && tokens[i+1].isPunct("="):
+			// EXPLAIN setting such as "indexes = 1"
+			i += 3
+		case tok.isPunct(","):
+			i++
+		default:
+			return validateStatement(tokens[i:])
+		}
+	}
+	return newUnsafeQueryError(tokens[0], "EXPLAIN must be followed by a statement")
+}
+
+// followsWord reports whether the previous token makes a leading dot a member
+// access (t.1) rather than the start of a number (.5).
+func followsWord(tokens []sqlToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.Kind == tokenWord || last.Kind == tokenQuotedIdent || last.isPunct(")")
+}
+
+func skipBlockComment(query string, start int) (int, bool) {
+	depth := 0
+	i := start
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, true
+			}
+		default:
+			i++
+		}
+	}
+	return i, false
+}
+
+// skipQuoted returns the offset just past a quoted literal starting at start.
+// Both backslash escapes and doubled quotes are supported.
+func skipQuoted(query string, start int, quote byte) (int, bool) {
+	i := start + 1
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			i += 2
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1, true
+		default:
+			i++
+		}
+	}
+	return i, false
+}
+
+// skipHeredoc returns the offset just past a $tag$...$tag$ literal. A lone $
+// that does not open a heredoc is treated as a one-character token.
+func skipHeredoc(query string, start int) (int, bool) {
+	end := start + 1
+	for end < len(query) && isSQLWordPart(query[end]) && query[end] != '$' {
+		end++
+	}
+	if end >= len(query) || query[end] != '$' {
+		return start + 1, true
+	}
+	tag := query[start : end+1]
+	closing := strings.Index(query[end+1:], tag)
+	if closing < 0 {
+		return len(query), false
+	}
+	return end + 1 + closing + len(tag), true
+}
+
+func skipNumber(query string, start int) int {
+	i := start
+	if strings.HasPrefix(query[i:], "0x") || strings.HasPrefix(query[i:], "0X") ||
+		strings.HasPrefix(query[i:], "0b") || strings.HasPrefix(query[i:], "0B") {
+		i += 2
+	}
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case isSQLWordPart(c) && c != '$', c == '.':
+			i++
+		case (c == '+' || c == '-') && (query[i-1] == 'e' || query[i-1] == 'E'):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isSQLWordPart(c byte) bool {
+	return isSQLWordStart(c) || isSQLDigit(c) || c == '$'
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestTokenizeSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"simple select", "SELECT a, b FROM t", []string{"SELECT", "a", ",", "b", "FROM", "t"}},
+		{"line comments", "SELECT 1 -- one\n# two\n, 2", []string{"SELECT", "1", ",", "2"}},
+		{"block comment", "SELECT /* x; y */ 1", []string{"SELECT", "1"}},
+		{"string with escapes", `SELECT 'it''s \'ok\''`, []string{"SELECT", `'it''s \'ok\''`}},
+		{"quoted identifiers", "SELECT `a b`, \"c\"", []string{"SELECT", "`a b`", ",", `"c"`}},
+		{"operators", "a::Int32 != b->c", []string{"a", "::", "Int32", "!=", "b", "->", "c"}},
+		{"numbers", "1.5e-3 + 0x1F - .5", []string{"1.5e-3", "+", "0x1F", "-", ".5"}},
+		{"tuple access", "t.1", []string{"t", ".", "1"}},
+		{"heredoc", "SELECT $tag$a;b$tag$", []string{"SELECT", "$tag$a;b$tag$"}},
+		{"semicolons", "SELECT 1;;", []string{"SELECT", "1", ";", ";"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizeSQL(tt.input)
+			if err != nil {
+				t.Fatalf("tokenizeSQL(%q) returned error: %v", tt.input, err)
+			}
+			if len(tokens) != len(tt.expected) {
+				t.Fatalf("tokenizeSQL(%q) returned %d tokens, want %d: %v", tt.input, len(tokens), len(tt.expected), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.Text != tt.expected[i] {
+					t.Errorf("token %d = %q, want %q", i, tok.Text, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizeSQL_Unterminated(t *testing.T) {
+	inputs := []string{
+		"SELECT 'abc",
+		"SELECT `abc",
+		"SELECT /* abc",
+		"SELECT $x$abc",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			if _, err := tokenizeSQL(input); err == nil {
+				t.Errorf("Expected error for unterminated input: %s", input)
+			}
+		})
+	}
+}
+
+func TestUnsafeQueryErrorPosition(t *testing.T) {
+	err := validateReadOnlyQuery("SELECT 1; DROP TABLE x")
+	if err == nil {
+		t.Fatal("Expected error for multi-statement query")
+	}
+
+	expected := `multiple statements are not allowed (token "DROP" at position 11)`
+	if err.Error() != expected {
+		t.Errorf("Error() = %q, want %q", err.Error(), expected)
+	}
+}
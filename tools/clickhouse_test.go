@@ -1,32 +1,83 @@
 package tools
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
 )
 
 // Tests for environment-based ClickHouse configuration are handled separately
 // since the new implementation uses environment variables instead of explicit parameters
 
-func TestIsQuerySafe(t *testing.T) {
-	unsafeQueries := []string{
-		"DROP TABLE test",
-		"DELETE FROM users",
-		"INSERT INTO logs VALUES (1, 'test')",
-		"UPDATE users SET name = 'hacker'",
-		"CREATE TABLE malicious (id Int32)",
-		"ALTER TABLE users ADD COLUMN evil String",
+func TestValidateReadOnlyQuery_UnsafeQueries(t *testing.T) {
+	tests := []struct {
+		query string
+		token string
+	}{
+		{"DROP TABLE test", "DROP"},
+		{"DELETE FROM users", "DELETE"},
+		{"INSERT INTO logs VALUES (1, 'test')", "INSERT"},
+		{"UPDATE users SET name = 'hacker'", "UPDATE"},
+		{"CREATE TABLE malicious (id Int32)", "CREATE"},
+		{"ALTER TABLE users ADD COLUMN evil String", "ALTER"},
+		{"SELECT 1; DROP TABLE x", "DROP"},
+		{"SELECT 1;\n-- trailing\nSELECT 2", "SELECT"},
+		{"-- looks harmless\nDROP TABLE x", "DROP"},
+		{"/* SELECT */ TRUNCATE TABLE x", "TRUNCATE"},
+		{"SELECT * FROM t INTO OUTFILE '/tmp/x.csv'", "INTO"},
+		{"SELECT * FROM url('http://169.254.169.254/', CSV, 'a String')", "url"},
+		{"SELECT * FROM file('/etc/passwd', 'LineAsString')", "file"},
+		{"SELECT count() FROM s3('https://bucket/key', 'Parquet')", "s3"},
+		{"SELECT * FROM remote('other:9000', db.t)", "remote"},
+		{"SELECT * FROM (SELECT * FROM executable('rm -rf /', TSV, 'x String'))", "executable"},
+		{"SELECT * FROM `url`('http://169.254.169.254/', CSV, 'a String')", "`url`"},
+		{`SELECT * FROM "file"('/etc/passwd', LineAsString)`, `"file"`},
+		{"SELECT * FROM `\\x75rl`('http://169.254.169.254/', CSV, 'a String')", "`\\x75rl`"},
+		{"SELECT * FROM icebergLocal('/var/lib/clickhouse/user_files/t')", "icebergLocal"},
+		{"SELECT * FROM t1 JOIN deltaLakeAzure('conn', 'container', 'path') AS d USING id", "deltaLakeAzure"},
+		{"SELECT * FROM numbers(10) AS n, someNewTableFunction('x') AS s", "someNewTableFunction"},
+		{"DESCRIBE TABLE someNewTableFunction('x')", "someNewTableFunction"},
+		{"SELECT 1 WHERE 1 IN (SELECT * FROM hive('thrift://host:9083', 'db', 't', 'x String', 'x'))", "hive"},
+		{"WITH 1 AS x INSERT INTO t SELECT x", "INSERT"},
+		{"EXPLAIN ALTER TABLE t DELETE WHERE 1", "ALTER"},
+		{"SET readonly = 0", "SET"},
+		{"KILL QUERY WHERE 1", "KILL"},
+		{"SYSTEM SHUTDOWN", "SYSTEM"},
+		{"SELECT * FROM t SETTINGS max_execution_time = 0", "max_execution_time"},
+		{"SELECT * FROM t SETTINGS max_threads = 1, max_result_rows = 0, max_memory_usage = 0", "max_result_rows"},
+		{"SELECT * FROM t SETTINGS `readonly` = 0", "`readonly`"},
+		{"SELECT * FROM t SETTINGS result_overflow_mode = 'break'", "result_overflow_mode"},
+		{"SELECT * FROM (SELECT * FROM t SETTINGS MAX_MEMORY_USAGE = 0) ORDER BY x", "MAX_MEMORY_USAGE"},
+		{"WITH c AS (SELECT 1 SETTINGS log_comment = 'x') SELECT * FROM c", "log_comment"},
+		{"EXPLAIN SELECT 1 SETTINGS max_rows_to_read = 0", "max_rows_to_read"},
 	}
 
-	for _, query := range unsafeQueries {
-		t.Run(query, func(t *testing.T) {
-			if isQuerySafe(query) {
-				t.Errorf("Expected query to be unsafe: %s", query)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			err := validateReadOnlyQuery(tt.query)
+			if err == nil {
+				t.Fatalf("Expected query to be unsafe: %s", tt.query)
+			}
+			unsafeErr, ok := err.(*unsafeQueryError)
+			if !ok {
+				t.Fatalf("Expected *unsafeQueryError, got %T", err)
+			}
+			if unsafeErr.Token != tt.token {
+				t.Errorf("Expected offending token %q, got %q (%v)", tt.token, unsafeErr.Token, err)
 			}
 		})
 	}
 }
 
-func TestIsQuerySafe_SafeQueries(t *testing.T) {
+func TestValidateReadOnlyQuery_SafeQueries(t *testing.T) {
 	safeQueries := []string{
 		"SELECT 1",
 		"select * from users limit 10",
@@ -34,12 +85,40 @@ func TestIsQuerySafe_SafeQueries(t *testing.T) {
 		"show databases",
 		"DESCRIBE users",
 		"describe table_name",
+		"DESC users",
+		"SELECT 1;",
+		"  -- leading comment\nSELECT 1",
+		"/* block /* nested */ comment */ SELECT 1",
+		"# hash comment\nSELECT 1",
+		"WITH t AS (SELECT 1 AS x) SELECT x FROM t",
+		"WITH 10 AS n SELECT number FROM numbers(n)",
+		"EXPLAIN SELECT 1",
+		"EXPLAIN indexes = 1 SELECT * FROM t WHERE id = 1",
+		"EXPLAIN PIPELINE (SELECT 1)",
+		"EXISTS TABLE db.t",
+		"(SELECT 1) UNION ALL (SELECT 2)",
+		"SELECT 'DROP TABLE x; DELETE FROM y' AS s",
+		"SELECT `drop`, \"insert\" FROM t",
+		"SELECT url, file FROM access_log",
+		"SELECT t.url FROM t",
+		"SELECT $$; DROP TABLE x$$",
+		"SELECT * FROM t SETTINGS max_threads = 1, join_use_nulls = 1",
+		"SELECT * FROM (SELECT * FROM t SETTINGS use_skip_indexes = 0) SETTINGS optimize_read_in_order = 1",
+		"SELECT name, value FROM system.settings WHERE name = 'max_execution_time'",
+		"SELECT Settings['max_execution_time'] FROM system.query_log",
+		"SELECT * FROM numbers(10) AS a, `numbers`(5) AS b",
+		"SELECT * FROM generateRandom('a UInt8', 1) LIMIT 3",
+		"SELECT * FROM merge(currentDatabase(), '^hits') JOIN view(SELECT 1 AS x) AS v ON 1",
+		"SELECT EXTRACT(YEAR FROM toDate(now())), substring(s FROM position(s, 'x')) FROM t",
+		"SELECT a, toString(b) FROM t ARRAY JOIN splitByChar(',', c) AS b",
+		"SELECT `toDate`('2024-01-01')",
+		"DESCRIBE TABLE numbers(10)",
 	}
 
 	for _, query := range safeQueries {
 		t.Run(query, func(t *testing.T) {
-			if !isQuerySafe(query) {
-				t.Errorf("Expected query to be safe: %s", query)
+			if err := validateReadOnlyQuery(query); err != nil {
+				t.Errorf("Expected query to be safe: %s (%v)", query, err)
 			}
 		})
 	}
@@ -67,3 +146,245 @@ func TestParseClickHouseLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestClickHouseSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ClickHouseConfig
+		expected clickhouse.Settings
+	}{
+		{
+			name:     "no limits",
+			config:   ClickHouseConfig{},
+			expected: clickhouse.Settings{"readonly": 2},
+		},
+		{
+			name:   "execution time only",
+			config: ClickHouseConfig{MaxExecutionTime: 60},
+			expected: clickhouse.Settings{
+				"max_execution_time": 60,
+				"readonly":           2,
+			},
+		},
+		{
+			name: "all limits",
+			config: ClickHouseConfig{
+				MaxExecutionTime:   30,
+				MaxResultRows:      10000,
+				MaxResultBytes:     1 << 20,
+				MaxMemoryUsage:     1 << 30,
+				ResultOverflowMode: "break",
+				SettingsProfile:    "mcp_readonly",
+			},
+			expected: clickhouse.Settings{
+				"profile":              "mcp_readonly",
+				"max_execution_time":   30,
+				"max_result_rows":      10000,
+				"max_result_bytes":     1 << 20,
+				"max_memory_usage":     1 << 30,
+				"result_overflow_mode": "break",
+				"readonly":             2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := clickHouseSettings(tt.config)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("clickHouseSettings() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDescribeQueryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "readonly",
+			err:      fmt.Errorf("query execution failed: %w", &clickhouse.Exception{Code: chErrReadonly, Message: "Cannot execute query in readonly mode"}),
+			expected: "Query blocked by server read-only mode: Cannot execute query in readonly mode",
+		},
+		{
+			name:     "other exception",
+			err:      &clickhouse.Exception{Code: 60, Message: "Table default.x does not exist"},
+			expected: "Query execution failed: code: 60, message: Table default.x does not exist",
+		},
+		{
+			name:     "plain error",
+			err:      errors.New("connection reset"),
+			expected: "Query execution failed: connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := describeQueryError(tt.err)
+			if result != tt.expected {
+				t.Errorf("describeQueryError() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// fakeConn is a driver.Conn that records the query text and serves fixed rows.
+type fakeConn struct {
+	driver.Conn
+	rows  *fakeRows
+	query string
+	// execs records the statements run with Exec and their arguments.
+	execs [][]any
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.execs = append(c.execs, append([]any{query}, args...))
+	return nil
+}
+
+func (c *fakeConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.query = query
+	c.rows.ctx = ctx
+	return c.rows, nil
+}
+
+func TestExecuteQuery_Limit(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		rows          int
+		limit         int
+		wantRows      int
+		wantTruncated bool
+	}{
+		{"plain select", "SELECT number FROM numbers(10)", 10, 3, 3, true},
+		{"union all", "SELECT 1 AS n UNION ALL SELECT 2 UNION ALL SELECT 3", 3, 2, 2, true},
+		{"settings clause", "SELECT number FROM numbers(10) SETTINGS max_threads = 1", 10, 5, 5, true},
+		{"limit by", "SELECT k, v FROM t ORDER BY v LIMIT 1 BY k", 4, 10, 4, false},
+		{"format suffix", "SELECT number FROM numbers(10) FORMAT JSONEachRow", 10, 4, 4, true},
+		{"trailing comment", "SELECT number FROM numbers(10) -- no limit here", 10, 2, 2, true},
+		{"limit in literal", "SELECT 'no limit' FROM numbers(10)", 10, 2, 2, true},
+		{"fits exactly", "SELECT number FROM numbers(3);", 3, 3, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := &fakeRows{columns: []fakeColumnType{{"n", "UInt64"}}}
+			for i := 0; i < tt.rows; i++ {
+				rows.data = append(rows.data, []interface{}{uint64(i)})
+			}
+			conn := &fakeConn{rows: rows}
+			record := &AuditRecord{}
+
+			result, err := executeQuery(withAuditRecord(context.Background(), record), conn, tt.query, tt.limit)
+			if err != nil {
+				t.Fatalf("executeQuery() returned error: %v", err)
+			}
+			if conn.query != tt.query {
+				t.Errorf("executeQuery() sent %q, want the query unchanged", conn.query)
+			}
+			if len(result.Rows) != tt.wantRows || result.Truncated != tt.wantTruncated {
+				t.Errorf("executeQuery() = %d rows (truncated %v), want %d rows (truncated %v)",
+					len(result.Rows), result.Truncated, tt.wantRows, tt.wantTruncated)
+			}
+			if !rows.closed {
+				t.Error("Expected rows to be closed")
+			}
+			if rows.cancelled != tt.wantTruncated {
+				t.Errorf("query cancelled before close = %v, want %v", rows.cancelled, tt.wantTruncated)
+			}
+			if rows.pos > tt.limit+1 {
+				t.Errorf("read %d rows from the stream, want at most %d", rows.pos, tt.limit+1)
+			}
+			if len(conn.execs) != 0 {
+				t.Errorf("executeQuery() ran %v, want no KILL QUERY for a query that was not cancelled", conn.execs)
+			}
+			if len(record.QueryIDs) != 1 || record.Rows == nil || *record.Rows != tt.wantRows {
+				t.Errorf("audit record = %v query IDs, %v rows, want one query ID and %d rows", record.QueryIDs, record.Rows, tt.wantRows)
+			} else if result.QueryID != record.QueryIDs[0] {
+				t.Errorf("executeQuery() query ID = %q, want %q as audited", result.QueryID, record.QueryIDs[0])
+			}
+		})
+	}
+}
+
+func TestQueryLogComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     *toolCall
+		expected string
+	}{
+		{"outside a tool call", nil, `{"app":"local-mcp"}`},
+		{"tool call", &toolCall{Client: "claude-ai", Tool: "clickhouse-query", Session: "s-1"},
+			`{"app":"local-mcp","client":"claude-ai","tool":"clickhouse-query","session":"s-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.call != nil {
+				ctx = context.WithValue(ctx, toolCallKey{}, tt.call)
+			}
+			if result := queryLogComment(ctx); result != tt.expected {
+				t.Errorf("queryLogComment() = %s, want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryErrorResult(t *testing.T) {
+	err := &queryError{QueryID: "q-1", LogComment: `{"app":"local-mcp"}`, Err: errors.New("boom")}
+	result := queryErrorResult(describeQueryError(err), err)
+
+	text := result.Content[0].(mcp.TextContent).Text
+	if text != "Query execution failed: boom\nQuery ID: q-1" {
+		t.Errorf("queryErrorResult() text = %q, want the message and query ID", text)
+	}
+	if result.Meta["query_id"] != "q-1" || result.Meta["log_comment"] != `{"app":"local-mcp"}` {
+		t.Errorf("queryErrorResult() _meta = %v, want the query ID and log_comment", result.Meta)
+	}
+
+	if result := queryErrorResult("Failed to connect", errors.New("refused")); result.Meta != nil {
+		t.Errorf("queryErrorResult() _meta = %v for an error without a query, want none", result.Meta)
+	}
+}
+
+func TestExecuteQuery_KillsCancelledQuery(t *testing.T) {
+	rows := &fakeRows{columns: []fakeColumnType{{"n", "UInt64"}}, data: [][]interface{}{{uint64(1)}}}
+	conn := &fakeConn{rows: rows}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = executeQuery(ctx, conn, "SELECT count() FROM huge", 10)
+
+	if len(conn.execs) != 1 {
+		t.Fatalf("executeQuery() ran %v, want one KILL QUERY", conn.execs)
+	}
+	kill := conn.execs[0]
+	if !strings.HasPrefix(kill[0].(string), "KILL QUERY WHERE query_id = ?") {
+		t.Errorf("executeQuery() ran %q, want KILL QUERY", kill[0])
+	}
+	if id, ok := kill[1].(string); !ok || uuid.Validate(id) != nil {
+		t.Errorf("KILL QUERY query_id = %v, want the generated query ID", kill[1])
+	}
+}
+
+func TestClickHouseTablesHandler_QuotesDatabase(t *testing.T) {
+	conn := &pagingConn{}
+	handler := clickHouseTablesHandler(newExplainTestClient(conn))
+
+	for database, expected := range map[string]string{
+		"logs":           "SHOW TABLES FROM `logs`",
+		"db FORMAT JSON": "SHOW TABLES FROM `db FORMAT JSON`",
+		"we`ird":         "SHOW TABLES FROM `we\\`ird`",
+	} {
+		conn.queries = nil
+		handler(context.Background(), map[string]interface{}{"database": database})
+		if len(conn.queries) != 1 || conn.queries[0] != expected {
+			t.Errorf("clickHouseTablesHandler(%q) ran %q, want %q", database, conn.queries, expected)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// chType is a parsed ClickHouse type name such as
+// Map(String, Array(Nullable(DateTime64(3, 'UTC')))).
+type chType struct {
+	Name string
+	// Params holds the raw non-type parameters, e.g. ["3", "'UTC'"] for DateTime64(3, 'UTC').
+	Params []string
+	// Elems holds nested types of Array, Nullable, LowCardinality, Map, Tuple and friends.
+	Elems []chType
+	// Fields holds the element names of a named Tuple, parallel to Elems.
+	Fields []string
+}
+
+// parseCHType parses a type name as reported by DatabaseTypeName.
+func parseCHType(typeName string) chType {
+	typeName = strings.TrimSpace(typeName)
+	open := strings.IndexByte(typeName, '(')
+	if open < 0 || !strings.HasSuffix(typeName, ")") {
+		return chType{Name: typeName}
+	}
+
+	t := chType{Name: strings.TrimSpace(typeName[:open])}
+	args := splitTypeArgs(typeName[open+1 : len(typeName)-1])
+
+	switch t.Name {
+	case "Array", "Nullable", "LowCardinality", "Map", "Variant":
+		for _, arg := range args {
+			t.Elems = append(t.Elems, parseCHType(arg))
+		}
+	case "Tuple", "Nested":
+		for _, arg := range args {
+			name, elem := splitTupleElement(arg)
+			if name != "" {
+				t.Fields = append(t.Fields, name)
+			}
+			t.Elems = append(t.Elems, parseCHType(elem))
+		}
+		if len(t.Fields) != len(t.Elems) {
+			t.Fields = nil
+		}
+	case "SimpleAggregateFunction":
+		if len(args) == 2 {
+			t.Params = args[:1]
+			t.Elems = []chType{parseCHType(args[1])}
+		}
+	default:
+		t.Params = args
+	}
+	return t
+}
+
+// splitTypeArgs splits a parameter list on top-level commas, skipping commas
+// inside nested parentheses and quoted strings.
+func splitTypeArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '`' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		args = append(args, rest)
+	}
+	return args
+}
+
+// splitTupleElement separates the name of a named tuple element ("a UInt8",
+// "`my col` String") from its type. Unnamed elements return an empty name.
+func splitTupleElement(arg string) (string, string) {
+	if strings.HasPrefix(arg, "`") {
+		if end := strings.IndexByte(arg[1:], '`'); end >= 0 {
+			return arg[1 : end+1], strings.TrimSpace(arg[end+2:])
+		}
+		return "", arg
+	}
+	space := strings.IndexByte(arg, ' ')
+	if space < 0 {
+		return "", arg
+	}
+	if paren := strings.IndexByte(arg, '('); paren >= 0 && paren < space {
+		return "", arg
+	}
+	return arg[:space], strings.TrimSpace(arg[space+1:])
+}
+
+// elem returns the i-th nested type, or an unknown type if there is none.
+func (t chType) elem(i int) chType {
+	if i < len(t.Elems) {
+		return t.Elems[i]
+	}
+	return chType{}
+}
+
+// base strips the wrappers that do not change how values are scanned.
+func (t chType) base() chType {
+	for (t.Name == "LowCardinality" || t.Name == "SimpleAggregateFunction") && len(t.Elems) > 0 {
+		t = t.Elems[0]
+	}
+	return t
+}
+
+// param returns the i-th raw parameter with surrounding quotes removed.
+func (t chType) param(i int) string {
+	if i >= len(t.Params) {
+		return ""
+	}
+	return strings.Trim(t.Params[i], "'")
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	ipType      = reflect.TypeOf(net.IP{})
+	anyType     = reflect.TypeOf((*interface{})(nil)).Elem()
+	anyMapType  = reflect.TypeOf(map[string]interface{}{})
+	anySlice    = reflect.TypeOf([]interface{}{})
+)
+
+var chScanTypes = map[string]reflect.Type{
+	"UInt8":   reflect.TypeOf(uint8(0)),
+	"UInt16":  reflect.TypeOf(uint16(0)),
+	"UInt32":  reflect.TypeOf(uint32(0)),
+	"UInt64":  reflect.TypeOf(uint64(0)),
+	"Int8":    reflect.TypeOf(int8(0)),
+	"Int16":   reflect.TypeOf(int16(0)),
+	"Int32":   reflect.TypeOf(int32(0)),
+	"Int64":   reflect.TypeOf(int64(0)),
+	"Float32": reflect.TypeOf(float32(0)),
+	"Float64": reflect.TypeOf(float64(0)),
+	"Bool":    reflect.TypeOf(false),
+	"Boolean": reflect.TypeOf(false),
+
+	"String":      reflect.TypeOf(""),
+	"FixedString": reflect.TypeOf(""),
+	"Enum8":       reflect.TypeOf(""),
+	"Enum16":      reflect.TypeOf(""),
+
+	"Int128":  bigIntType,
+	"Int256":  bigIntType,
+	"UInt128": bigIntType,
+	"UInt256": bigIntType,
+
+	"Date":       timeType,
+	"Date32":     timeType,
+	"DateTime":   timeType,
+	"DateTime64": timeType,
+
+	"Decimal":    decimalType,
+	"Decimal32":  decimalType,
+	"Decimal64":  decimalType,
+	"Decimal128": decimalType,
+	"Decimal256": decimalType,
+
+	"UUID": uuidType,
+	"IPv4": ipType,
+	"IPv6": ipType,
+
+	"JSON":   anyMapType,
+	"Object": anyMapType,
+}
+
+// scanType returns the Go type the driver scans t into, or nil if the type is
+// not known here and the driver's own ScanType should be used.
+func scanType(t chType) reflect.Type {
+	t = t.base()
+	if st, ok := chScanTypes[t.Name]; ok {
+		return st
+	}
+	if strings.HasPrefix(t.Name, "Interval") {
+		return reflect.TypeOf("")
+	}
+
+	switch t.Name {
+	case "Nullable":
+		inner := scanType(t.elem(0))
+		if inner == nil {
+			return nil
+		}
+		if inner.Kind() == reflect.Ptr {
+			return inner
+		}
+		return reflect.PointerTo(inner)
+	case "Array":
+		inner := scanType(t.elem(0))
+		if inner == nil {
+			return nil
+		}
+		return reflect.SliceOf(inner)
+	case "Map":
+		key, value := scanType(t.elem(0)), scanType(t.elem(1))
+		if key == nil || value == nil || !key.Comparable() {
+			return nil
+		}
+		return reflect.MapOf(key, value)
+	case "Tuple":
+		if len(t.Fields) > 0 {
+			return anyMapType
+		}
+		return anySlice
+	case "Nothing":
+		return reflect.PointerTo(anyType)
+	}
+	return nil
+}
+
+// createValueSlice allocates scan targets matching the column types.
+func createValueSlice(columnTypes []driver.ColumnType) []interface{} {
+	values := make([]interface{}, len(columnTypes))
+	for i, colType := range columnTypes {
+		st := scanType(parseCHType(colType.DatabaseTypeName()))
+		if st == nil {
+			st = colType.ScanType()
+		}
+		if st == nil {
+			st = anyType
+		}
+		values[i] = reflect.New(st).Interface()
+	}
+	return values
+}
+
+// parseColumnTypes parses the type of every result column.
+func parseColumnTypes(columns []queryColumn) []chType {
+	types := make([]chType, len(columns))
+	for i, col := range columns {
+		types[i] = parseCHType(col.Type)
+	}
+	return types
+}
+
+// convertValuesToStrings renders scanned values as text, using the column types
+// to format dates, decimals and nested values the way ClickHouse does.
+func convertValuesToStrings(values []interface{}, types []chType) []string {
+	stringValues := make([]string, len(values))
+	for i, val := range values {
+		stringValues[i] = formatCHValue(reflect.ValueOf(val), typeAt(types, i), false)
+	}
+	return stringValues
+}
+
+func typeAt(types []chType, i int) chType {
+	if i < len(types) {
+		return types[i]
+	}
+	return chType{}
+}
+
+// formatCHValue renders v of ClickHouse type t. Strings, dates, UUIDs and IPs
+// nested in arrays, maps and tuples are quoted like ClickHouse literals so that
+// element boundaries stay unambiguous.
+func formatCHValue(v reflect.Value, t chType, nested bool) string {
+	t = t.base()
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return "NULL"
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "NULL"
+	}
+	if t.Name == "Nullable" {
+		t = t.elem(0).base()
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return quoteIfNested(formatCHTime(x, t), nested)
+	case decimal.Decimal:
+		if scale, ok := decimalScale(t); ok {
+			return x.StringFixed(scale)
+		}
+		return x.String()
+	case big.Int:
+		return x.String()
+	case uuid.UUID:
+		return quoteIfNested(x.String(), nested)
+	case net.IP:
+		return quoteIfNested(x.String(), nested)
+	case string:
+		return quoteIfNested(x, nested)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Name == "Tuple" {
+			return formatCHTuple(v, t)
+		}
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatCHValue(v.Index(i), t.elem(0), true)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		if t.Name == "Tuple" && len(t.Fields) > 0 {
+			return formatCHNamedTuple(v, t)
+		}
+		if t.Name != "Map" {
+			if data, err := json.Marshal(v.Interface()); err == nil {
+				return string(data)
+			}
+		}
+		return formatCHMap(v, t)
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func formatCHTuple(v reflect.Value, t chType) string {
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = formatCHValue(v.Index(i), t.elem(i), true)
+	}
+	return "(" + strings.Join(items, ", ") + ")"
+}
+
+func formatCHNamedTuple(v reflect.Value, t chType) string {
+	items := make([]string, len(t.Fields))
+	for i, name := range t.Fields {
+		items[i] = name + ": " + formatCHValue(v.MapIndex(reflect.ValueOf(name)), t.elem(i), true)
+	}
+	return "(" + strings.Join(items, ", ") + ")"
+}
+
+// formatCHMap renders a map as {k: v, ...}, sorted by key for stable output.
+func formatCHMap(v reflect.Value, t chType) string {
+	type entry struct{ key, value string }
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, entry{
+			key:   formatCHValue(iter.Key(), t.elem(0), true),
+			value: formatCHValue(iter.Value(), t.elem(1), true),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	items := make([]string, len(entries))
+	for i, e := range entries {
+		items[i] = e.key + ": " + e.value
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// formatCHTime renders dates without a time part and DateTime64 with its
+// sub-second precision and time zone.
+func formatCHTime(ts time.Time, t chType) string {
+	switch t.Name {
+	case "Date", "Date32":
+		return ts.Format("2006-01-02")
+	case "DateTime64":
+		layout := "2006-01-02 15:04:05"
+		if precision, err := strconv.Atoi(t.param(0)); err == nil && precision > 0 {
+			layout += "." + strings.Repeat("0", min(precision, 9))
+		}
+		return ts.Format(layout) + " " + ts.Location().String()
+	case "DateTime":
+		if t.param(0) != "" {
+			return ts.Format("2006-01-02 15:04:05") + " " + ts.Location().String()
+		}
+	}
+	return ts.Format("2006-01-02 15:04:05")
+}
+
+// decimalScale returns the scale of Decimal(P, S) and DecimalN(S).
+func decimalScale(t chType) (int32, bool) {
+	param := t.param(1)
+	if t.Name != "Decimal" {
+		param = t.param(0)
+	}
+	scale, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, false
+	}
+	return int32(scale), true
+}
+
+var chStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func quoteIfNested(s string, nested bool) string {
+	if !nested {
+		return s
+	}
+	return "'" + chStringEscaper.Replace(s) + "'"
+}
+
+// jsonValues converts scanned values into JSON-friendly typed values.
+func jsonValues(values []interface{}, types []chType) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = jsonValue(reflect.ValueOf(v), typeAt(types, i))
+	}
+	return result
+}
+
+// jsonValue keeps numbers and booleans typed, renders values JSON cannot
+// represent exactly (128/256-bit integers, decimals) as strings, and converts
+// nested arrays, maps and tuples recursively.
+func jsonValue(v reflect.Value, t chType) interface{} {
+	t = t.base()
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if t.Name == "Nullable" {
+		t = t.elem(0).base()
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		if t.Name == "Date" || t.Name == "Date32" {
+			return x.Format("2006-01-02")
+		}
+		return x.Format(time.RFC3339Nano)
+	case decimal.Decimal, big.Int, uuid.UUID, net.IP:
+		return formatCHValue(v, t, false)
+	case float32:
+		return jsonFloat(float64(x))
+	case float64:
+		return jsonFloat(x)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			elemType := t.elem(0)
+			if t.Name == "Tuple" {
+				elemType = t.elem(i)
+			}
+			items[i] = jsonValue(v.Index(i), elemType)
+		}
+		return items
+	case reflect.Map:
+		object := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := formatCHValue(iter.Key(), t.elem(0), false)
+			valueType := t.elem(1)
+			if t.Name == "Tuple" {
+				valueType = tupleFieldType(t, key)
+			} else if t.Name != "Map" {
+				valueType = chType{}
+			}
+			object[key] = jsonValue(iter.Value(), valueType)
+		}
+		return object
+	}
+	return v.Interface()
+}
+
+func tupleFieldType(t chType, name string) chType {
+	for i, field := range t.Fields {
+		if field == name {
+			return t.elem(i)
+		}
+	}
+	return chType{}
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"encoding/json"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseCHType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected chType
+	}{
+		{"UInt64", chType{Name: "UInt64"}},
+		{"DateTime64(3, 'Europe/Berlin')", chType{Name: "DateTime64", Params: []string{"3", "'Europe/Berlin'"}}},
+		{"Nullable(String)", chType{Name: "Nullable", Elems: []chType{{Name: "String"}}}},
+		{"Map(String, Array(Nullable(Int32)))", chType{Name: "Map", Elems: []chType{
+			{Name: "String"},
+			{Name: "Array", Elems: []chType{{Name: "Nullable", Elems: []chType{{Name: "Int32"}}}}},
+		}}},
+		{"Tuple(a UInt8, `b c` Decimal(18, 4))", chType{Name: "Tuple", Fields: []string{"a", "b c"}, Elems: []chType{
+			{Name: "UInt8"},
+			{Name: "Decimal", Params: []string{"18", "4"}},
+		}}},
+		{"Tuple(String, DateTime64(6))", chType{Name: "Tuple", Elems: []chType{
+			{Name: "String"},
+			{Name: "DateTime64", Params: []string{"6"}},
+		}}},
+		{"Enum8('a, b' = 1, 'c' = 2)", chType{Name: "Enum8", Params: []string{"'a, b' = 1", "'c' = 2"}}},
+		{"SimpleAggregateFunction(sum, UInt64)", chType{Name: "SimpleAggregateFunction",
+			Params: []string{"sum"}, Elems: []chType{{Name: "UInt64"}}}},
+	}
+
+	for _, test := range tests {
+		result := parseCHType(test.input)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseCHType(%q) = %+v, want %+v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestScanType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected reflect.Type
+	}{
+		{"UInt8", reflect.TypeOf(uint8(0))},
+		{"LowCardinality(String)", reflect.TypeOf("")},
+		{"Nullable(Int64)", reflect.TypeOf((*int64)(nil))},
+		{"Nullable(UInt256)", reflect.TypeOf((*big.Int)(nil))},
+		{"LowCardinality(Nullable(String))", reflect.TypeOf((*string)(nil))},
+		{"Array(Nullable(Float64))", reflect.TypeOf([]*float64{})},
+		{"Map(String, Array(UInt32))", reflect.TypeOf(map[string][]uint32{})},
+		{"Decimal(18, 4)", reflect.TypeOf(decimal.Decimal{})},
+		{"DateTime64(3, 'UTC')", reflect.TypeOf(time.Time{})},
+		{"UUID", reflect.TypeOf(uuid.UUID{})},
+		{"IPv6", reflect.TypeOf(net.IP{})},
+		{"Tuple(a UInt8, b String)", reflect.TypeOf(map[string]interface{}{})},
+		{"Tuple(UInt8, String)", reflect.TypeOf([]interface{}{})},
+		{"Enum16('a' = 1)", reflect.TypeOf("")},
+		{"IntervalDay", reflect.TypeOf("")},
+		{"Point", nil},
+	}
+
+	for _, test := range tests {
+		result := scanType(parseCHType(test.input))
+		if result != test.expected {
+			t.Errorf("scanType(%q) = %v, want %v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestCreateValueSlice_FallsBackToScanType(t *testing.T) {
+	rows := &fakeRows{columns: []fakeColumnType{{"p", "Point"}, {"n", "Nullable(UInt8)"}}}
+	values := createValueSlice(rows.ColumnTypes())
+
+	if _, ok := values[0].(*string); !ok {
+		t.Errorf("createValueSlice() Point target = %T, want *string", values[0])
+	}
+	if _, ok := values[1].(**uint8); !ok {
+		t.Errorf("createValueSlice() Nullable(UInt8) target = %T, want **uint8", values[1])
+	}
+}
+
+func TestConvertValuesToStrings(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, berlin)
+	var nullInt *int64
+
+	tests := []struct {
+		typeName string
+		value    interface{}
+		expected string
+	}{
+		{"Nullable(Int64)", &nullInt, "NULL"},
+		{"Nullable(String)", ptr("x"), "x"},
+		{"Float64", 0.1, "0.1"},
+		{"Bool", true, "true"},
+		{"Date", ts, "2024-01-02"},
+		{"DateTime", ts, "2024-01-02 03:04:05"},
+		{"DateTime('Europe/Berlin')", ts, "2024-01-02 03:04:05 Europe/Berlin"},
+		{"DateTime64(3, 'Europe/Berlin')", ts, "2024-01-02 03:04:05.123 Europe/Berlin"},
+		{"DateTime64(6)", ts.UTC(), "2024-01-02 02:04:05.123456 UTC"},
+		{"Decimal(18, 4)", decimal.RequireFromString("1.5"), "1.5000"},
+		{"Decimal32(2)", decimal.RequireFromString("-3"), "-3.00"},
+		{"UInt256", new(big.Int).Lsh(big.NewInt(1), 100), "1267650600228229401496703205376"},
+		{"UUID", uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{"IPv4", net.IPv4(10, 0, 0, 1), "10.0.0.1"},
+		{"Array(String)", []string{"a", "it's"}, `['a', 'it\'s']`},
+		{"Array(Nullable(UInt8))", []*uint8{ptr(uint8(1)), nil}, "[1, NULL]"},
+		{"Array(Array(UInt8))", [][]uint8{{1, 2}, {}}, "[[1, 2], []]"},
+		{"Map(String, UInt64)", map[string]uint64{"b": 2, "a": 1}, "{'a': 1, 'b': 2}"},
+		{"Map(UInt8, Array(Date))", map[uint8][]time.Time{1: {ts}}, "{1: ['2024-01-02']}"},
+		{"Tuple(UInt8, String)", []interface{}{uint8(1), "x"}, "(1, 'x')"},
+		{"Tuple(id UInt8, name String)", map[string]interface{}{"name": "x", "id": uint8(1)}, "(id: 1, name: 'x')"},
+		{"LowCardinality(Nullable(String))", ptr("lc"), "lc"},
+	}
+
+	for _, test := range tests {
+		types := []chType{parseCHType(test.typeName)}
+		result := convertValuesToStrings([]interface{}{test.value}, types)[0]
+		if result != test.expected {
+			t.Errorf("convertValuesToStrings(%s) = %q, want %q", test.typeName, result, test.expected)
+		}
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	columns := []queryColumn{
+		{Name: "d", Type: "Date"},
+		{Name: "big", Type: "Int128"},
+		{Name: "dec", Type: "Decimal(10, 2)"},
+		{Name: "m", Type: "Map(UInt8, Array(Nullable(Float64)))"},
+		{Name: "t", Type: "Tuple(a IPv4, b DateTime)"},
+	}
+	values := []interface{}{
+		ts,
+		big.NewInt(-5),
+		decimal.RequireFromString("2.5"),
+		map[uint8][]*float64{7: {ptr(1.5), nil}},
+		map[string]interface{}{"a": net.IPv4(1, 2, 3, 4), "b": ts},
+	}
+
+	data, err := json.Marshal(jsonValues(values, parseColumnTypes(columns)))
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %v", err)
+	}
+	expected := `["2024-01-02","-5","2.50",{"7":[1.5,null]},{"a":"1.2.3.4","b":"2024-01-02T03:04:05Z"}]`
+	if string(data) != expected {
+		t.Errorf("jsonValues() = %s, want %s", data, expected)
+	}
+}
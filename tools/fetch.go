@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	envFetchAllowPrivate = "LOCAL_MCP_FETCH_ALLOW_PRIVATE"
+
+	defaultFetchMaxChars = 20000
+	maxFetchRedirects    = 10
+	// maxFetchResponseSize bounds the page read from the server.
+	maxFetchResponseSize = 10 << 20
+)
+
+// nonPublicPrefixes are the ranges, besides those recognised by netip, that
+// do not belong to the public internet.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// fetchedPage is a page downloaded by fetch-url and converted to text.
+type fetchedPage struct {
+	// URL is the address of the page after redirects.
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"`
+}
+
+// NewFetchURLTool creates a tool that downloads a web page and returns its
+// main content as Markdown. Pages are cached in cache, so that reading a long
+// page chunk by chunk downloads it once.
+func NewFetchURLTool(cache *ResultCache) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "fetch-url",
+			Description: ptr("Fetch a web page, such as a search-web result, and return its main content as Markdown without navigation, scripts and other boilerplate. Plain text and JSON are returned as they are. Long pages are returned in chunks: pass start_index to continue reading."),
+			InputSchema: mcp.ToolInputSchema{
+				Type: "object",
+				Properties: map[string]map[string]interface{}{
+					"url": {
+						"type":        "string",
+						"description": "The http or https URL to fetch",
+					},
+					"max_chars": {
+						"type":        "integer",
+						"description": fmt.Sprintf("Maximum number of characters of content to return (default: %d)", defaultFetchMaxChars),
+						"minimum":     1,
+						"default":     defaultFetchMaxChars,
+					},
+					"start_index": {
+						"type":        "integer",
+						"description": "Character offset to start reading the content from, to continue a truncated page (default: 0)",
+						"minimum":     0,
+						"default":     0,
+					},
+					"bypass_cache": {
+						"type":        "boolean",
+						"description": "Download the page again instead of using a cached copy (default: false)",
+						"default":     false,
+					},
+				},
+				Required: []string{"url"},
+			},
+		},
+		fetchURLHandler(cache),
+	)
+}
+
+func fetchURLHandler(cache *ResultCache) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		rawURL, ok := args["url"].(string)
+		if !ok || strings.TrimSpace(rawURL) == "" {
+			return errorResult("URL parameter is required and must be a non-empty string")
+		}
+
+		maxChars := defaultFetchMaxChars
+		if value, ok := args["max_chars"].(float64); ok {
+			if value < 1 {
+				return errorResult("max_chars must be at least 1")
+			}
+			// No page has more characters than bytes, so larger values are
+			// clamped before they can overflow int.
+			maxChars = int(min(value, maxFetchResponseSize))
+		}
+		startIndex := 0
+		if value, ok := args["start_index"].(float64); ok {
+			if value < 0 {
+				return errorResult("start_index must not be negative")
+			}
+			startIndex = int(min(value, maxFetchResponseSize))
+		}
+
+		bypass, _ := args["bypass_cache"].(bool)
+
+		allowPrivate := parseEnvBool(envFetchAllowPrivate)
+		page, info, err := cachedResult(cache, fetchCacheKey(rawURL, allowPrivate), bypass, func() (*fetchedPage, error) {
+			return fetchPage(ctx, newFetchClient(allowPrivate), rawURL)
+		})
+		if err != nil {
+			return errorResult(fmt.Sprintf("Fetch failed: %v", err))
+		}
+
+		content := []rune(page.Content)
+		if startIndex > 0 && startIndex >= len(content) {
+			return errorResult(fmt.Sprintf("start_index %d is past the end of the content (%d characters)", startIndex, len(content)))
+		}
+		end := startIndex + min(maxChars, len(content)-startIndex)
+
+		result := successResult(formatFetchedPage(page, string(content[startIndex:end]), startIndex, end, len(content), info))
+		result.Meta = info.meta(mcp.CallToolResultMeta{"url": page.URL, "total_chars": len(content)})
+		if end < len(content) {
+			result.Meta["next_start_index"] = end
+		}
+		return result
+	}
+}
+
+// fetchCacheKey identifies a page in the cache. Pages fetched while private
+// networks were allowed are kept apart.
+func fetchCacheKey(rawURL string, allowPrivate bool) string {
+	if target, err := url.Parse(strings.TrimSpace(rawURL)); err == nil {
+		target.Host = strings.ToLower(target.Host)
+		target.Fragment = ""
+		rawURL = target.String()
+	}
+	return fmt.Sprintf("fetch\x00%s\x00%t", rawURL, allowPrivate)
+}
+
+// checkFetchURL refuses URLs other than http and https ones.
+func checkFetchURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs can be fetched, got %q", target.Redacted())
+	}
+	if target.Hostname() == "" {
+		return fmt.Errorf("URL %q has no host", target.Redacted())
+	}
+	return nil
+}
+
+// newFetchClient returns the HTTP client of fetch-url. Unless allowPrivate is
+// set, it refuses to connect to loopback, private and other non-public
+// addresses. The address is checked when dialing, after name resolution, so
+// that neither a redirect nor a host name resolving to such an address can
+// get around the check.
+func newFetchClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+		// Through a proxy only the address of the proxy would be checked.
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   requestTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return checkFetchURL(req.URL)
+		},
+	}
+}
+
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("unexpected address %q: %w", address, err)
+	}
+	if !isPublicAddress(ip) {
+		return fmt.Errorf("%s is not a public address (set %s=true to allow private networks)", ip, envFetchAllowPrivate)
+	}
+	return nil
+}
+
+// isPublicAddress reports whether ip can belong to a host on the internet.
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchPage downloads rawURL and converts it to text: HTML to Markdown, in
+// UTF-8 whatever the charset of the page.
+func fetchPage(ctx context.Context, client *http.Client, rawURL string) (*fetchedPage, error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkFetchURL(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to fetch %s: %w", target.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %s", resp.Request.URL.Redacted(), resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if len(body) > maxFetchResponseSize {
+		return nil, fmt.Errorf("the page is larger than %s", formatBytes(maxFetchResponseSize))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q", contentType)
+	}
+	if !isTextMediaType(mediaType) {
+		return nil, fmt.Errorf("unsupported content type %s, only HTML and text can be read", mediaType)
+	}
+
+	decoded, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the page: %w", err)
+	}
+	text, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the page: %w", err)
+	}
+
+	page := &fetchedPage{URL: resp.Request.URL.String(), ContentType: mediaType}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		doc, err := html.Parse(bytes.NewReader(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the page: %w", err)
+		}
+		page.Title, page.Content = htmlToMarkdown(doc, resp.Request.URL)
+	} else {
+		page.Content = strings.TrimSpace(string(text))
+	}
+	return page, nil
+}
+
+// isTextMediaType reports whether fetch-url can return content of mediaType.
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-ndjson", "application/yaml":
+		return true
+	}
+	return false
+}
+
+func formatFetchedPage(page *fetchedPage, content string, start, end, total int, info cacheInfo) string {
+	var output strings.Builder
+	if page.Title != "" {
+		output.WriteString(fmt.Sprintf("Title: %s\n", page.Title))
+	}
+	output.WriteString(fmt.Sprintf("URL: %s\n", page.URL))
+	output.WriteString(fmt.Sprintf("Content type: %s\n", page.ContentType))
+	if note := info.describe(); note != "" {
+		output.WriteString(fmt.Sprintf("Cache: %s\n", note))
+	}
+	output.WriteString("\n")
+
+	if total == 0 {
+		output.WriteString("(the page has no readable content)\n")
+		return output.String()
+	}
+	output.WriteString(content)
+	output.WriteString("\n")
+
+	if start > 0 || end < total {
+		output.WriteString(fmt.Sprintf("\n[Characters %d-%d of %d.", start, end, total))
+		if end < total {
+			output.WriteString(fmt.Sprintf(" Call fetch-url again with start_index=%d to read more.", end))
+		}
+		output.WriteString("]\n")
+	}
+	return output.String()
+}
@@ -0,0 +1,430 @@
+package tools
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// skippedElements never hold content worth reading.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true, "embed": true,
+	"nav": true, "aside": true, "form": true, "button": true, "input": true,
+	"select": true, "textarea": true, "dialog": true,
+}
+
+// skippedRoles mark navigation and other page furniture.
+var skippedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "dialog": true, "alertdialog": true, "menu": true, "menubar": true,
+}
+
+// blockElements start a Markdown block of their own.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "body": true, "dd": true,
+	"details": true, "div": true, "dl": true, "dt": true, "figcaption": true,
+	"figure": true, "footer": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "html": true, "li": true, "main": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true,
+	"table": true, "ul": true,
+}
+
+// htmlToMarkdown returns the title of doc and its main content as Markdown,
+// with links resolved against base. The main content is the <main> element,
+// or the only <article>, or else the whole body without its header and
+// footer; navigation, scripts, forms and hidden elements are left out.
+func htmlToMarkdown(doc *html.Node, base *url.URL) (string, string) {
+	title := ""
+	if n := findElement(doc, func(n *html.Node) bool { return n.Data == "title" }); n != nil {
+		title = nodeText(n)
+	}
+
+	root := findElement(doc, func(n *html.Node) bool { return n.Data == "main" || htmlAttr(n, "role") == "main" })
+	if root == nil {
+		if articles := findElements(doc, "article"); len(articles) == 1 {
+			root = articles[0]
+		}
+	}
+	if root == nil {
+		root = doc
+	}
+
+	content := (&markdownConverter{base: base}).blocks(root)
+	if title == "" {
+		if n := findElement(root, func(n *html.Node) bool { return n.Data == "h1" }); n != nil {
+			title = nodeText(n)
+		}
+	}
+	return title, content
+}
+
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findElements(n *html.Node, name string) []*html.Node {
+	var found []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == name {
+			found = append(found, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// markdownConverter renders HTML nodes as Markdown.
+type markdownConverter struct {
+	base *url.URL
+	// sectioning counts the enclosing main, article and section elements,
+	// inside which header and footer belong to the content.
+	sectioning int
+}
+
+func (c *markdownConverter) skip(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode, html.DoctypeNode:
+		return true
+	case html.ElementNode:
+	default:
+		return false
+	}
+	if skippedElements[n.Data] || skippedRoles[htmlAttr(n, "role")] {
+		return true
+	}
+	if htmlAttr(n, "aria-hidden") == "true" || hasAttr(n, "hidden") {
+		return true
+	}
+	return (n.Data == "header" || n.Data == "footer") && c.sectioning == 0
+}
+
+// blocks renders the children of n as Markdown blocks separated by blank
+// lines. Runs of inline content between block elements form paragraphs.
+func (c *markdownConverter) blocks(n *html.Node) string {
+	if n.Type == html.ElementNode && (n.Data == "main" || n.Data == "article" || n.Data == "section") {
+		c.sectioning++
+		defer func() { c.sectioning-- }()
+	}
+
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if text := cleanInline(inline.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if c.skip(child) {
+			continue
+		}
+		if child.Type == html.ElementNode && blockElements[child.Data] {
+			flush()
+			if block := c.block(child); block != "" {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+// block renders the block element n.
+func (c *markdownConverter) block(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := cleanInline(c.inlineChildren(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", int(n.Data[1]-'0')) + " " + strings.ReplaceAll(text, "\n", " ")
+	case "hr":
+		return "---"
+	case "pre":
+		return c.codeBlock(n)
+	case "blockquote":
+		return prefixLines(c.blocks(n), "> ", "> ")
+	case "ul", "ol":
+		return c.list(n)
+	case "table":
+		return c.table(n)
+	case "dt":
+		if text := cleanInline(c.inlineChildren(n)); text != "" {
+			return "**" + text + "**"
+		}
+		return ""
+	case "dd":
+		return prefixLines(c.blocks(n), ": ", "  ")
+	default:
+		return c.blocks(n)
+	}
+}
+
+func (c *markdownConverter) codeBlock(n *html.Node) string {
+	language := ""
+	if code := findElement(n, func(n *html.Node) bool { return n.Data == "code" }); code != nil {
+		for _, class := range strings.Fields(htmlAttr(code, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				language = lang
+				break
+			}
+		}
+	}
+	code := strings.Trim(rawText(n), "\n")
+	if strings.TrimSpace(code) == "" {
+		return ""
+	}
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+func (c *markdownConverter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.Data != "li" || c.skip(item) {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		content := c.blocks(item)
+		if content == "" {
+			continue
+		}
+		items = append(items, prefixLines(content, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders a table with a header row, taking its first row as the
+// header.
+func (c *markdownConverter) table(n *html.Node) string {
+	var rows [][]string
+	for _, row := range findElements(n, "tr") {
+		var cells []string
+		for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+				text := cleanInline(c.inlineChildren(cell))
+				text = strings.ReplaceAll(strings.ReplaceAll(text, "\n", " "), "|", `\|`)
+				cells = append(cells, text)
+			}
+		}
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inline renders n as inline Markdown. Block elements nested inside inline
+// ones are flattened.
+func (c *markdownConverter) inline(n *html.Node) string {
+	if c.skip(n) {
+		return ""
+	}
+	switch n.Type {
+	case html.TextNode:
+		return collapseSpace(n.Data)
+	case html.ElementNode:
+	default:
+		return c.inlineChildren(n)
+	}
+
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "a":
+		text := cleanInline(c.inlineChildren(n))
+		href := c.resolve(htmlAttr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return "[" + strings.ReplaceAll(text, "\n", " ") + "](" + href + ")"
+	case "img":
+		alt := strings.TrimSpace(htmlAttr(n, "alt"))
+		src := c.resolve(htmlAttr(n, "src"))
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+	case "strong", "b":
+		return wrapInline(c.inlineChildren(n), "**")
+	case "em", "i":
+		return wrapInline(c.inlineChildren(n), "*")
+	case "del", "s":
+		return wrapInline(c.inlineChildren(n), "~~")
+	case "code", "kbd", "samp":
+		text := strings.Join(strings.Fields(rawText(n)), " ")
+		if text == "" {
+			return ""
+		}
+		fence := "`"
+		for strings.Contains(text, fence) {
+			fence += "`"
+		}
+		return fence + text + fence
+	default:
+		text := c.inlineChildren(n)
+		if blockElements[n.Data] || n.Data == "td" || n.Data == "th" {
+			text = " " + text + " "
+		}
+		return text
+	}
+}
+
+func (c *markdownConverter) inlineChildren(n *html.Node) string {
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(c.inline(child))
+	}
+	return text.String()
+}
+
+// resolve returns the absolute form of the link href, or "" for links that
+// lead nowhere outside the page.
+func (c *markdownConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	link, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		link = c.base.ResolveReference(link)
+	}
+	if link.Scheme != "http" && link.Scheme != "https" && link.Scheme != "mailto" {
+		return ""
+	}
+	return link.String()
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rawText returns the text inside n as it is, for preformatted content.
+func rawText(n *html.Node) string {
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			text.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "br":
+			text.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return text.String()
+}
+
+// collapseSpace replaces each run of whitespace in s with a single space.
+func collapseSpace(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s == "" {
+			return ""
+		}
+		return " "
+	}
+	text := strings.Join(fields, " ")
+	if strings.TrimLeft(s, " \t\n\r\f") != s {
+		text = " " + text
+	}
+	if strings.TrimRight(s, " \t\n\r\f") != s {
+		text += " "
+	}
+	return text
+}
+
+// cleanInline collapses the spaces left between inline elements and trims
+// every line, keeping the line breaks of <br>.
+func cleanInline(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// wrapInline surrounds text with the emphasis mark, keeping the surrounding
+// spaces outside of it.
+func wrapInline(text, mark string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + mark + trimmed + mark + text[start+len(trimmed):]
+}
+
+// prefixLines starts the first line of text with first and the other
+// non-empty lines with rest.
+func prefixLines(text, first, rest string) string {
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line == "":
+			lines[i] = strings.TrimRight(rest, " ")
+		default:
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,255 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCheckFetchURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectError bool
+	}{
+		{"https://clickhouse.com/docs", false},
+		{"http://example.com:8080/a?b=c", false},
+		{"file:///etc/passwd", true},
+		{"ftp://example.com/file", true},
+		{"javascript:alert(1)", true},
+		{"gopher://example.com", true},
+		{"http:///path", true},
+	}
+
+	for _, tt := range tests {
+		target, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkFetchURL(target); (err != nil) != tt.expectError {
+			t.Errorf("checkFetchURL(%q) = %v, want error %v", tt.url, err, tt.expectError)
+		}
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:4700::6810:85e5", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range tests {
+		if result := isPublicAddress(netip.MustParseAddr(tt.ip)); result != tt.expected {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name          string
+		page          string
+		expectedTitle string
+		expected      string
+	}{
+		{
+			name: "main element",
+			page: `<html><head><title>Guide | Docs</title><style>p {}</style></head><body>
+<header><a href="/">Home</a></header>
+<nav><ul><li><a href="/a">A</a></li></ul></nav>
+<main>
+  <header><h1>The   <em>Guide</em></h1></header>
+  <p>Read the <a href="../intro.html">introduction</a> and
+     <strong>then</strong> run <code>make  build</code>.<br>Next line.</p>
+  <script>track()</script>
+  <ul><li>One</li><li>Two<ol><li>Nested</li></ol></li></ul>
+  <pre><code class="language-sql">SELECT 1
+FROM t</code></pre>
+  <blockquote><p>Quoted</p><p>Twice</p></blockquote>
+  <table><tr><th>Name</th><th>Type</th></tr><tr><td>id</td><td>UInt64 | Null</td></tr></table>
+  <div hidden>Hidden</div>
+  <p><img src="/logo.png" alt="Logo"> <a href="#top">Top</a> <a href="javascript:void(0)">Menu</a></p>
+</main>
+<footer>Copyright</footer>
+</body></html>`,
+			expectedTitle: "Guide | Docs",
+			expected: "# The *Guide*\n\n" +
+				"Read the [introduction](https://example.com/intro.html) and **then** run `make build`.\nNext line.\n\n" +
+				"- One\n- Two\n\n  1. Nested\n\n" +
+				"```sql\nSELECT 1\nFROM t\n```\n\n" +
+				"> Quoted\n>\n> Twice\n\n" +
+				"| Name | Type |\n| --- | --- |\n| id | UInt64 \\| Null |\n\n" +
+				"![Logo](https://example.com/logo.png) Top Menu",
+		},
+		{
+			name: "body without main",
+			page: `<body><div class="menu" role="navigation">Menu</div><header>Site</header>
+<div><h2>Article</h2>Some <b>bold</b> text<div>Second block</div></div>
+<aside>Related</aside><footer>Footer</footer></body>`,
+			expectedTitle: "",
+			expected:      "## Article\n\nSome **bold** text\n\nSecond block",
+		},
+		{
+			name:          "single article",
+			page:          `<body><div>Sidebar</div><article><header><h1>Post</h1></header><p>Body</p><footer>By me</footer></article></body>`,
+			expectedTitle: "Post",
+			expected:      "# Post\n\nBody\n\nBy me",
+		},
+	}
+
+	base, _ := url.Parse("https://example.com/docs/guide.html")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			title, content := htmlToMarkdown(doc, base)
+			if title != tt.expectedTitle {
+				t.Errorf("htmlToMarkdown() title = %q, want %q", title, tt.expectedTitle)
+			}
+			if content != tt.expected {
+				t.Errorf("htmlToMarkdown() content =\n%s\nwant\n%s", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchURLHandler(t *testing.T) {
+	var agent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=windows-1252")
+			w.Write([]byte("<title>Caf\xe9</title><main><p>Cr\xe8me br\xfbl\xe9e</p></main>"))
+		case "/meta":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<meta charset=\"iso-8859-1\"><p>Stra\xdfe</p>"))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("0123456789abcdefghij"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv(envFetchAllowPrivate, "")
+	result := fetchURLHandler(nil)(context.Background(), map[string]interface{}{"url": server.URL + "/page"})
+	if !strings.Contains(resultText(result), "not a public address") {
+		t.Errorf("fetchURLHandler() for a loopback server = %q, want it refused", resultText(result))
+	}
+
+	t.Setenv(envFetchAllowPrivate, "true")
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		expected []string
+		isError  bool
+	}{
+		{
+			name:     "redirect and charset",
+			args:     map[string]interface{}{"url": server.URL + "/old"},
+			expected: []string{"Title: Café\n", "URL: " + server.URL + "/page\n", "Crème brûlée"},
+		},
+		{
+			name:     "meta charset",
+			args:     map[string]interface{}{"url": server.URL + "/meta"},
+			expected: []string{"Straße"},
+		},
+		{
+			name:     "first chunk",
+			args:     map[string]interface{}{"url": server.URL + "/text", "max_chars": float64(8)},
+			expected: []string{"Content type: text/plain\n\n01234567\n", "Characters 0-8 of 20", "start_index=8"},
+		},
+		{
+			name:     "last chunk",
+			args:     map[string]interface{}{"url": server.URL + "/text", "max_chars": float64(15), "start_index": float64(8)},
+			expected: []string{"\n\n89abcdefghij\n", "Characters 8-20 of 20.]"},
+		},
+		{
+			name:     "huge max_chars",
+			args:     map[string]interface{}{"url": server.URL + "/text", "max_chars": float64(1e19), "start_index": float64(18)},
+			expected: []string{"\n\nij\n", "Characters 18-20 of 20.]"},
+		},
+		{
+			name:    "huge start_index",
+			args:    map[string]interface{}{"url": server.URL + "/text", "start_index": float64(1e19), "max_chars": float64(1e19)},
+			isError: true,
+		},
+		{
+			name:    "past the end",
+			args:    map[string]interface{}{"url": server.URL + "/text", "start_index": float64(20)},
+			isError: true,
+		},
+		{
+			name:     "binary content",
+			args:     map[string]interface{}{"url": server.URL + "/image"},
+			expected: []string{"unsupported content type image/png"},
+			isError:  true,
+		},
+		{
+			name:     "not found",
+			args:     map[string]interface{}{"url": server.URL + "/missing"},
+			expected: []string{"404"},
+			isError:  true,
+		},
+		{
+			name:     "redirect to another scheme",
+			args:     map[string]interface{}{"url": server.URL + "/ftp"},
+			expected: []string{"only http and https"},
+			isError:  true,
+		},
+		{
+			name:    "file URL",
+			args:    map[string]interface{}{"url": "file:///etc/passwd"},
+			isError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fetchURLHandler(nil)(context.Background(), tt.args)
+			if isError := result.IsError != nil && *result.IsError; isError != tt.isError {
+				t.Fatalf("fetchURLHandler() = %q, want error %v", resultText(result), tt.isError)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(resultText(result), expected) {
+					t.Errorf("fetchURLHandler() = %q, want it to contain %q", resultText(result), expected)
+				}
+			}
+		})
+	}
+
+	if agent != userAgent {
+		t.Errorf("fetch-url sent User-Agent %q, want %q", agent, userAgent)
+	}
+}
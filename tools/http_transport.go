@@ -0,0 +1,461 @@
+package tools
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/sse"
+)
+
+const (
+	httpEndpointPath   = "/mcp"
+	httpMaxRequestBody = 10 << 20
+	sessionIDHeader    = "Mcp-Session-Id"
+
+	// httpSessionIdleTimeout is how long a session is kept without requests.
+	httpSessionIdleTimeout = 30 * time.Minute
+	// httpMaxSessionsPerCaller bounds the sessions of one caller; starting
+	// another one ends the caller's least recently used session.
+	httpMaxSessionsPerCaller = 16
+)
+
+// HTTPTransportConfig configures the authenticated Streamable HTTP listener.
+type HTTPTransportConfig struct {
+	// Address is the host:port to listen on.
+	Address string
+	// AuthFile lists the callers with their bearer tokens or client
+	// certificate names and scopes.
+	AuthFile string
+	// TLSCertFile and TLSKeyFile serve the listener over HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientCAFile enables mutual TLS: client certificates signed by this CA
+	// authenticate their callers.
+	ClientCAFile string
+	// AllowedOrigins are the origins, such as https://app.example.com, of
+	// web pages allowed to call the endpoint besides loopback ones.
+	AllowedOrigins []string
+}
+
+// httpTransport serves MCP Streamable HTTP like the library's transport, but
+// authenticates every request before it reaches the server and passes the
+// caller to handlers through the request context.
+type httpTransport struct {
+	server         *http.Server
+	config         HTTPTransportConfig
+	authenticator  Authenticator
+	sessionManager *session.SessionManager
+
+	// listenHost and allowedOrigins guard against DNS rebinding.
+	listenHost     string
+	allowedOrigins map[string]bool
+
+	idleTimeout          time.Duration
+	maxSessionsPerCaller int
+	now                  func() time.Time
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*httpSession
+}
+
+type httpSession struct {
+	server server.Server
+	// caller is nil when authentication is disabled.
+	caller *Caller
+	// lastUsed is when the session last received a request, guarded by the
+	// transport's mutex.
+	lastUsed time.Time
+}
+
+// NewHTTPTransport creates the HTTP transport. Listening on anything but a
+// loopback address requires TLS and at least one authentication method.
+func NewHTTPTransport(config HTTPTransportConfig) (server.Transport, error) {
+	host, _, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", config.Address, err)
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return nil, errors.New("a TLS certificate and key must be given together")
+	}
+	if config.ClientCAFile != "" && config.TLSCertFile == "" {
+		return nil, errors.New("client certificate authentication requires a TLS certificate and key")
+	}
+
+	chain, err := loadAuthenticators(config.AuthFile, config.ClientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopbackHost(host) && (len(chain) == 0 || config.TLSCertFile == "") {
+		return nil, fmt.Errorf("listening on %s requires TLS and an auth file or client CA", config.Address)
+	}
+
+	t := &httpTransport{
+		config:               config,
+		sessionManager:       session.NewSessionManager(),
+		listenHost:           strings.ToLower(host),
+		allowedOrigins:       map[string]bool{},
+		idleTimeout:          httpSessionIdleTimeout,
+		maxSessionsPerCaller: httpMaxSessionsPerCaller,
+		now:                  time.Now,
+		sessions:             map[uuid.UUID]*httpSession{},
+		server: &http.Server{
+			Addr:              config.Address,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+	if len(chain) > 0 {
+		t.authenticator = chain
+	}
+	for _, origin := range config.AllowedOrigins {
+		t.allowedOrigins[normalizeOrigin(origin)] = true
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+		}
+		// Bearer tokens still work without a client certificate; requests
+		// with neither are rejected by the authenticator.
+		t.server.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return t, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (t *httpTransport) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	serverOptions ...server.ServerOption,
+) error {
+	t.server.Handler = t.handler(capabilities, serverInfo, serverOptions...)
+
+	if t.config.TLSCertFile != "" {
+		return t.server.ListenAndServeTLS(t.config.TLSCertFile, t.config.TLSKeyFile)
+	}
+	return t.server.ListenAndServe()
+}
+
+// handler serves the MCP endpoint, creating a server for each new session.
+func (t *httpTransport) handler(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	serverOptions ...server.ServerOption,
+) http.Handler {
+	serverOptions = append(serverOptions, server.MinimalProtocolVersionOption{
+		Version: server.MINIMAL_FOR_STREAMABLE_HTTP,
+	})
+	newServer := func(id uuid.UUID) server.Server {
+		return newRequestServer(server.NewServer(capabilities, serverInfo, serverOptions...), nil, id.String())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+httpEndpointPath, func(w http.ResponseWriter, r *http.Request) {
+		t.handlePost(w, r, newServer)
+	})
+	mux.HandleFunc("DELETE "+httpEndpointPath, t.handleDelete)
+	return t.checkOrigin(t.authenticate(mux))
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests.
+func (t *httpTransport) Shutdown(ctx context.Context) error {
+	return t.server.Shutdown(ctx)
+}
+
+func (t *httpTransport) GetSessionManager() *session.SessionManager {
+	return t.sessionManager
+}
+
+// authenticate rejects requests without valid credentials and stores the
+// caller of the others in their context.
+func (t *httpTransport) authenticate(next http.Handler) http.Handler {
+	if t.authenticator == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := t.authenticator.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="local-mcp"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withCaller(r.Context(), caller)))
+	})
+}
+
+// checkOrigin rejects requests from web pages that may not call the server,
+// which the Streamable HTTP transport requires against DNS rebinding: a page
+// whose name was rebound to the listen address still sends its own Origin,
+// and its own name in Host.
+func (t *httpTransport) checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !t.allowsHost(r.Host) {
+			http.Error(w, "host not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !t.allowsOrigin(origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowsHost reports whether the Host header names the listen address. Any
+// name is accepted when listening on all interfaces, which requires TLS and
+// authentication, and any loopback name when listening on loopback.
+func (t *httpTransport) allowsHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if t.listenHost == "" || net.ParseIP(t.listenHost).IsUnspecified() || host == t.listenHost {
+		return true
+	}
+	return isLoopbackHost(t.listenHost) && isLoopbackHost(host)
+}
+
+// allowsOrigin reports whether origin is a loopback or an allowed origin.
+func (t *httpTransport) allowsOrigin(origin string) bool {
+	origin = normalizeOrigin(origin)
+	if t.allowedOrigins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && isLoopbackHost(u.Hostname())
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+// session returns the session named by the request header. Sessions are
+// bound to the caller that created them, and other callers get 404 as if the
+// session did not exist. So do sessions that have been idle for too long.
+func (t *httpTransport) session(r *http.Request) (uuid.UUID, *httpSession, error) {
+	id, err := uuid.Parse(r.Header.Get(sessionIDHeader))
+	if err != nil {
+		return uuid.Nil, nil, errors.New("wrong session id format, expected UUID")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s, ok := t.sessions[id]
+	if ok && now.Sub(s.lastUsed) > t.idleTimeout {
+		t.removeSession(id)
+		ok = false
+	}
+	if !ok || !sameCaller(s.caller, callerFromContext(r.Context())) {
+		return uuid.Nil, nil, errors.New("requested session id not found")
+	}
+	s.lastUsed = now
+	return id, s, nil
+}
+
+// addSession registers a new session, first dropping idle sessions and, if
+// its caller has too many, the caller's least recently used one.
+func (t *httpTransport) addSession(id uuid.UUID, s *httpSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s.lastUsed = now
+
+	var own []uuid.UUID
+	for otherID, other := range t.sessions {
+		switch {
+		case now.Sub(other.lastUsed) > t.idleTimeout:
+			t.removeSession(otherID)
+		case sameCaller(other.caller, s.caller):
+			own = append(own, otherID)
+		}
+	}
+	for len(own) >= t.maxSessionsPerCaller {
+		oldest := 0
+		for i, otherID := range own {
+			if t.sessions[otherID].lastUsed.Before(t.sessions[own[oldest]].lastUsed) {
+				oldest = i
+			}
+		}
+		t.removeSession(own[oldest])
+		own = append(own[:oldest], own[oldest+1:]...)
+	}
+	t.sessions[id] = s
+}
+
+// removeSession ends a session. The caller must hold t.mu.
+func (t *httpTransport) removeSession(id uuid.UUID) {
+	delete(t.sessions, id)
+	t.sessionManager.DeleteSession(id)
+}
+
+// isInitializeRequest reports whether body is a single initialize request,
+// the only message that may start a session.
+func isInitializeRequest(body []byte) bool {
+	var request struct {
+		Method string `json:"method"`
+	}
+	return json.Unmarshal(body, &request) == nil && request.Method == "initialize"
+}
+
+func sameCaller(a, b *Caller) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name
+}
+
+func (t *httpTransport) handlePost(w http.ResponseWriter, r *http.Request, newServer func(uuid.UUID) server.Server) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxRequestBody))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		id uuid.UUID
+		s  *httpSession
+	)
+	if r.Header.Get(sessionIDHeader) != "" {
+		if id, s, err = t.session(r); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	} else {
+		if !isInitializeRequest(body) {
+			http.Error(w, "missing "+sessionIDHeader+" header: only an initialize request may start a session", http.StatusBadRequest)
+			return
+		}
+		id = uuid.New()
+		s = &httpSession{server: newServer(id), caller: callerFromContext(r.Context())}
+		t.addSession(id, s)
+	}
+	w.Header().Set(sessionIDHeader, id.String())
+
+	// The library's session manager is not safe for concurrent use, so it
+	// is guarded by the transport's mutex.
+	t.mu.Lock()
+	ctx, _, err := t.sessionManager.ResolveSessionOrCreateNew(r.Context(), id)
+	t.mu.Unlock()
+	if err != nil {
+		http.Error(w, "failed to resolve session", http.StatusNotFound)
+		return
+	}
+
+	// Progress notifications turn the response into an event stream, so that
+	// they reach the client before the result.
+	stream := &eventStream{w: w}
+	ctx = withNotify(ctx, stream.notify)
+
+	var responses [][]byte
+	for _, response := range s.server.HandleAndGetResponses(ctx, body) {
+		if response == nil {
+			continue // notification
+		}
+		data, err := json.Marshal(response)
+		if err != nil {
+			continue
+		}
+		responses = append(responses, data)
+	}
+
+	switch {
+	case stream.isStarted() || len(responses) > 1:
+		// Responses to a batch are sent as an event stream too.
+		for _, data := range responses {
+			if err := stream.send(data); err != nil {
+				return
+			}
+		}
+	case len(responses) == 1:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(responses[0])
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// eventStream writes the response to a POST as server-sent events.
+type eventStream struct {
+	w http.ResponseWriter
+
+	mu      sync.Mutex
+	started bool
+}
+
+func (e *eventStream) send(data []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.started {
+		e.w.Header().Set("Content-Type", "text/event-stream")
+		e.w.WriteHeader(http.StatusOK)
+		e.started = true
+	}
+	if err := (&sse.Event{Data: data}).MarshalTo(e.w); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (e *eventStream) notify(method string, params interface{}) error {
+	data, err := encodeNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return e.send(data)
+}
+
+func (e *eventStream) isStarted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.started
+}
+
+func (t *httpTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, _, err := t.session(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	t.mu.Lock()
+	t.removeSession(id)
+	t.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
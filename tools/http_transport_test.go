@@ -0,0 +1,288 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+
+func newTestHTTPServer(t *testing.T) (*httptest.Server, *httpTransport) {
+	t.Helper()
+	path := writeAuthFile(t, `{"callers": [
+		{"name": "admin", "token": "admin-token"},
+		{"name": "reader", "token": "reader-token", "tools": ["echo"]}
+	]}`)
+	transport, err := NewHTTPTransport(HTTPTransportConfig{Address: "127.0.0.1:0", AuthFile: path})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() returned error: %v", err)
+	}
+
+	var tools []fxctx.Tool
+	for _, name := range []string{"echo", "secret"} {
+		tools = append(tools, fxctx.NewTool(&mcp.Tool{Name: name}, func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			return successResult(name + " called by " + callerFromContext(ctx).Name)
+		}))
+	}
+	mux := DecorateToolMux(fxctx.NewToolMux(tools), nil)
+
+	handler := transport.(*httpTransport).handler(
+		&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}},
+		&mcp.Implementation{Name: "test", Version: "1"},
+		server.ServerStartCallbackOption{Callback: mux.RegisterHandlers},
+	)
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts, transport.(*httpTransport)
+}
+
+func postMCP(t *testing.T, url, token, session, body string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+httpEndpointPath, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if session != "" {
+		req.Header.Set(sessionIDHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestHTTPTransport_RejectsUnauthenticated(t *testing.T) {
+	ts, _ := newTestHTTPServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		resp, _ := postMCP(t, ts.URL, token, "", initializeRequest)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want %d", token, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: missing WWW-Authenticate header", token)
+		}
+	}
+}
+
+func TestHTTPTransport_ToolScope(t *testing.T) {
+	ts, _ := newTestHTTPServer(t)
+
+	resp, _ := postMCP(t, ts.URL, "reader-token", "", initializeRequest)
+	session := resp.Header.Get(sessionIDHeader)
+	if resp.StatusCode != http.StatusOK || session == "" {
+		t.Fatalf("initialize: status = %d, session = %q", resp.StatusCode, session)
+	}
+
+	_, body := postMCP(t, ts.URL, "reader-token", session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if !strings.Contains(body, `"echo"`) || strings.Contains(body, `"secret"`) {
+		t.Errorf("tools/list = %s, want only echo", body)
+	}
+
+	_, body = postMCP(t, ts.URL, "reader-token", session, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo"}}`)
+	if !strings.Contains(body, "echo called by reader") {
+		t.Errorf("tools/call echo = %s", body)
+	}
+
+	_, body = postMCP(t, ts.URL, "reader-token", session, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"secret"}}`)
+	if !strings.Contains(body, "not permitted") || strings.Contains(body, "secret called") {
+		t.Errorf("tools/call secret = %s, want a permission error", body)
+	}
+}
+
+func TestHTTPTransport_SessionBoundToCaller(t *testing.T) {
+	ts, _ := newTestHTTPServer(t)
+
+	resp, _ := postMCP(t, ts.URL, "reader-token", "", initializeRequest)
+	session := resp.Header.Get(sessionIDHeader)
+
+	resp, _ = postMCP(t, ts.URL, "admin-token", session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("another caller's session: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+httpEndpointPath, nil)
+	req.Header.Set("Authorization", "Bearer reader-token")
+	req.Header.Set(sessionIDHeader, session)
+	deleteResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteResp.Body.Close()
+	if deleteResp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE: status = %d, want %d", deleteResp.StatusCode, http.StatusNoContent)
+	}
+
+	resp, _ = postMCP(t, ts.URL, "reader-token", session, `{"jsonrpc":"2.0","id":3,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted session: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHTTPTransport_SessionStart(t *testing.T) {
+	ts, transport := newTestHTTPServer(t)
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		"[" + initializeRequest + "]",
+		"not json",
+	} {
+		resp, _ := postMCP(t, ts.URL, "reader-token", "", body)
+		if resp.StatusCode != http.StatusBadRequest || resp.Header.Get(sessionIDHeader) != "" {
+			t.Errorf("%s without a session: status = %d, session = %q, want %d and none", body, resp.StatusCode, resp.Header.Get(sessionIDHeader), http.StatusBadRequest)
+		}
+	}
+	if len(transport.sessions) != 0 {
+		t.Errorf("requests other than initialize created %d sessions", len(transport.sessions))
+	}
+}
+
+func TestHTTPTransport_SessionExpiry(t *testing.T) {
+	ts, transport := newTestHTTPServer(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	transport.now = func() time.Time { return now }
+	transport.maxSessionsPerCaller = 2
+
+	initialize := func(token string) string {
+		t.Helper()
+		resp, _ := postMCP(t, ts.URL, token, "", initializeRequest)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("initialize: status = %d", resp.StatusCode)
+		}
+		return resp.Header.Get(sessionIDHeader)
+	}
+	status := func(token, session string) int {
+		t.Helper()
+		resp, _ := postMCP(t, ts.URL, token, session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		return resp.StatusCode
+	}
+
+	admin := initialize("admin-token")
+	first := initialize("reader-token")
+	now = now.Add(time.Minute)
+	second := initialize("reader-token")
+	now = now.Add(time.Minute)
+	if status("reader-token", first) != http.StatusOK {
+		t.Fatal("first session: want it usable")
+	}
+	now = now.Add(time.Minute)
+	third := initialize("reader-token")
+	for _, tt := range []struct {
+		name, token, session string
+		expected             int
+	}{
+		{"least recently used", "reader-token", second, http.StatusNotFound},
+		{"recently used", "reader-token", first, http.StatusOK},
+		{"new", "reader-token", third, http.StatusOK},
+		{"another caller's", "admin-token", admin, http.StatusOK},
+	} {
+		if result := status(tt.token, tt.session); result != tt.expected {
+			t.Errorf("%s session over the limit: status = %d, want %d", tt.name, result, tt.expected)
+		}
+	}
+
+	now = now.Add(httpSessionIdleTimeout + time.Second)
+	if result := status("reader-token", first); result != http.StatusNotFound {
+		t.Errorf("idle session: status = %d, want %d", result, http.StatusNotFound)
+	}
+	initialize("admin-token")
+	if len(transport.sessions) != 1 {
+		t.Errorf("after the idle timeout %d sessions are kept, want only the new one", len(transport.sessions))
+	}
+}
+
+func TestHTTPTransport_Origin(t *testing.T) {
+	ts, transport := newTestHTTPServer(t)
+	transport.allowedOrigins["https://app.example.com"] = true
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		status int
+	}{
+		{"no origin", "", "", http.StatusOK},
+		{"loopback origin", "", "http://localhost:3000", http.StatusOK},
+		{"allowed origin", "", "https://App.example.com/", http.StatusOK},
+		{"foreign origin", "", "http://attacker.example", http.StatusForbidden},
+		{"opaque origin", "", "null", http.StatusForbidden},
+		{"loopback host", "localhost:8080", "", http.StatusOK},
+		{"rebound host", "attacker.example:8080", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+httpEndpointPath, strings.NewReader(initializeRequest))
+		req.Header.Set("Authorization", "Bearer reader-token")
+		if test.host != "" {
+			req.Host = test.host
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: status = %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+		if test.status == http.StatusForbidden && resp.Header.Get(sessionIDHeader) != "" {
+			t.Errorf("%s: a rejected request started a session", test.name)
+		}
+	}
+}
+
+func TestHTTPTransport_AllowsHost(t *testing.T) {
+	tests := []struct {
+		listen   string
+		host     string
+		expected bool
+	}{
+		{"127.0.0.1", "127.0.0.1:8080", true},
+		{"127.0.0.1", "[::1]:8080", true},
+		{"localhost", "LOCALHOST", true},
+		{"127.0.0.1", "rebind.attacker.example:8080", false},
+		{"10.0.0.5", "10.0.0.5:8443", true},
+		{"10.0.0.5", "localhost:8443", false},
+		{"0.0.0.0", "mcp.example.com", true},
+	}
+	for _, test := range tests {
+		transport := &httpTransport{listenHost: test.listen}
+		if result := transport.allowsHost(test.host); result != test.expected {
+			t.Errorf("allowsHost(%q) listening on %s = %v, want %v", test.host, test.listen, result, test.expected)
+		}
+	}
+}
+
+func TestNewHTTPTransport_Validation(t *testing.T) {
+	authFile := writeAuthFile(t, `{"callers": [{"name": "ci", "token": "t"}]}`)
+
+	tests := []struct {
+		name   string
+		config HTTPTransportConfig
+	}{
+		{"public address without auth", HTTPTransportConfig{Address: "0.0.0.0:8080"}},
+		{"public address without TLS", HTTPTransportConfig{Address: "0.0.0.0:8080", AuthFile: authFile}},
+		{"certificate without key", HTTPTransportConfig{Address: "127.0.0.1:8080", TLSCertFile: "cert.pem"}},
+		{"client CA without TLS", HTTPTransportConfig{Address: "127.0.0.1:8080", ClientCAFile: "ca.pem"}},
+		{"missing auth file", HTTPTransportConfig{Address: "127.0.0.1:8080", AuthFile: "/nonexistent/callers.json"}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewHTTPTransport(test.config); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
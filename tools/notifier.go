@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Notifier sends server-initiated JSON-RPC notifications to the client. The
+// transport in use has no API for notifications, so Notifier owns its output
+// instead: it is passed to the transport as its writer and interleaves
+// notifications between complete response lines.
+type Notifier struct {
+	mu      sync.Mutex
+	out     io.Writer
+	pending []byte
+}
+
+// NewNotifier creates a Notifier writing to out.
+func NewNotifier(out io.Writer) *Notifier {
+	return &Notifier{out: out}
+}
+
+// Write buffers transport output and forwards it one complete line at a time,
+// so that a notification never ends up in the middle of a response.
+func (n *Notifier) Write(p []byte) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.pending = append(n.pending, p...)
+	end := bytes.LastIndexByte(n.pending, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	_, err := n.out.Write(n.pending[:end+1])
+	n.pending = append(n.pending[:0], n.pending[end+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Notify sends a notification with the given method and params.
+func (n *Notifier) Notify(method string, params interface{}) error {
+	data, err := encodeNotification(method, params)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.out.Write(append(data, '\n'))
+	return err
+}
+
+func encodeNotification(method string, params interface{}) ([]byte, error) {
+	data, err := json.Marshal(struct {
+		JsonRpc string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{
+		JsonRpc: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return data, nil
+}
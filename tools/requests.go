@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+const (
+	methodInitialize    = "initialize"
+	methodToolsCall     = "tools/call"
+	methodCancelled     = "notifications/cancelled"
+	methodProgress      = "notifications/progress"
+	minProgressInterval = 500 * time.Millisecond
+)
+
+// notifyFunc sends a notification to the client that made the current request.
+type notifyFunc func(method string, params interface{}) error
+
+type notifyKey struct{}
+
+// withNotify sets where notifications about the request of ctx are sent,
+// overriding the server's default.
+func withNotify(ctx context.Context, notify notifyFunc) context.Context {
+	return context.WithValue(ctx, notifyKey{}, notify)
+}
+
+// requestServer wraps an MCP server so that tool calls can be cancelled with
+// notifications/cancelled and can report progress. The library handles
+// messages one at a time, which over stdio means a cancellation would only be
+// read after the call it cancels has finished, so tool calls run concurrently.
+// It also tells tool calls which client and session they belong to.
+type requestServer struct {
+	server.Server
+	notify    notifyFunc
+	sessionID string
+
+	mu sync.Mutex
+	// client is the name the client gave in initialize.
+	client string
+	// inflight maps the JSON encoding of a tool call's request ID to the
+	// cancel function of its context.
+	inflight map[string]context.CancelFunc
+}
+
+// NewRequestServer returns a server constructor for stdio.WithNewServerFunc
+// that sends progress notifications through notifier. The stdio transport has
+// a single session, which gets a generated ID.
+func NewRequestServer(notifier *Notifier) func(*mcp.ServerCapabilities, *mcp.Implementation, ...server.ServerOption) server.Server {
+	return func(capabilities *mcp.ServerCapabilities, serverInfo *mcp.Implementation, options ...server.ServerOption) server.Server {
+		return newRequestServer(server.NewServer(capabilities, serverInfo, options...), notifier.Notify, uuid.NewString())
+	}
+}
+
+func newRequestServer(srv server.Server, notify notifyFunc, sessionID string) *requestServer {
+	return &requestServer{Server: srv, notify: notify, sessionID: sessionID, inflight: map[string]context.CancelFunc{}}
+}
+
+// requestEnvelope holds the parts of a message needed to track it. IDs and
+// progress tokens may be strings or numbers, so they are kept as raw JSON.
+type requestEnvelope struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+		RequestID  json.RawMessage `json:"requestId"`
+		Name       string          `json:"name"`
+		ClientInfo struct {
+			Name string `json:"name"`
+		} `json:"clientInfo"`
+	} `json:"params"`
+}
+
+// parseEnvelope decodes a single message. Batches and malformed messages are
+// left to the library, which reports the errors.
+func parseEnvelope(b []byte) (*requestEnvelope, bool) {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var env requestEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, false
+	}
+	return &env, true
+}
+
+func (s *requestServer) Handle(ctx context.Context, b []byte) {
+	env, ok := parseEnvelope(b)
+	switch {
+	case ok && env.Method == methodInitialize:
+		s.setClient(env.Params.ClientInfo.Name)
+		s.Server.Handle(ctx, b)
+	case ok && env.Method == methodCancelled:
+		s.cancel(env.Params.RequestID)
+	case ok && env.Method == methodToolsCall && len(env.ID) > 0:
+		go func() {
+			for _, response := range s.handleToolCall(ctx, env, b) {
+				s.GetResponses() <- *response
+			}
+		}()
+	default:
+		s.Server.Handle(ctx, b)
+	}
+}
+
+func (s *requestServer) HandleAndGetResponses(ctx context.Context, b []byte) []*jsonrpc2.JsonRpcResponse {
+	env, ok := parseEnvelope(b)
+	switch {
+	case ok && env.Method == methodInitialize:
+		s.setClient(env.Params.ClientInfo.Name)
+		return s.Server.HandleAndGetResponses(ctx, b)
+	case ok && env.Method == methodCancelled:
+		s.cancel(env.Params.RequestID)
+		return nil
+	case ok && env.Method == methodToolsCall && len(env.ID) > 0:
+		return s.handleToolCall(ctx, env, b)
+	default:
+		return s.Server.HandleAndGetResponses(ctx, b)
+	}
+}
+
+// handleToolCall runs a tool call with a context that notifications/cancelled
+// can cancel. A cancelled call gets no response, as the protocol asks.
+func (s *requestServer) handleToolCall(ctx context.Context, env *requestEnvelope, b []byte) []*jsonrpc2.JsonRpcResponse {
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(env.ID)
+	s.mu.Lock()
+	s.inflight[key] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	s.mu.Lock()
+	ctx = context.WithValue(ctx, toolCallKey{}, &toolCall{Client: s.client, Tool: env.Params.Name, Session: s.sessionID})
+	s.mu.Unlock()
+
+	if token := env.Params.Meta.ProgressToken; len(token) > 0 && !bytes.Equal(token, []byte("null")) {
+		notify, _ := ctx.Value(notifyKey{}).(notifyFunc)
+		if notify == nil {
+			notify = s.notify
+		}
+		if notify != nil {
+			ctx = context.WithValue(ctx, progressKey{}, &progressReporter{token: token, notify: notify})
+		}
+	}
+
+	responses := s.Server.HandleAndGetResponses(ctx, b)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return responses
+}
+
+func (s *requestServer) setClient(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = name
+}
+
+func (s *requestServer) cancel(id json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.inflight[string(id)]; ok {
+		cancel()
+	}
+}
+
+type toolCallKey struct{}
+
+// toolCall identifies the tool call a request belongs to.
+type toolCall struct {
+	Client  string `json:"client,omitempty"`
+	Tool    string `json:"tool,omitempty"`
+	Session string `json:"session,omitempty"`
+}
+
+// toolCallFromContext returns the tool call of ctx, or nil outside of one.
+func toolCallFromContext(ctx context.Context) *toolCall {
+	call, _ := ctx.Value(toolCallKey{}).(*toolCall)
+	return call
+}
+
+type progressKey struct{}
+
+// progressReporter sends notifications/progress for a request that asked for
+// them with a progress token.
+type progressReporter struct {
+	token  json.RawMessage
+	notify notifyFunc
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         *float64        `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// reportProgress notifies the client of the progress of the request of ctx,
+// if it asked for progress. Updates are sent at most every
+// minProgressInterval; total is left out when it is zero.
+func reportProgress(ctx context.Context, progress, total float64, message string) {
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	now := time.Now()
+	if now.Sub(reporter.last) < minProgressInterval {
+		return
+	}
+	reporter.last = now
+
+	params := progressParams{ProgressToken: reporter.token, Progress: progress, Message: message}
+	if total > 0 {
+		params.Total = &total
+	}
+	_ = reporter.notify(methodProgress, params)
+}
@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+type recordedNotification struct {
+	method string
+	params interface{}
+}
+
+// newTestRequestServer serves tools/call with handler and records notifications.
+func newTestRequestServer(handler func(ctx context.Context) (jsonrpc2.Result, *jsonrpc2.Error)) (*requestServer, func() []recordedNotification) {
+	srv := server.NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "test", Version: "1"})
+	srv.SetRequestHandler(&mcp.CallToolRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		return handler(ctx)
+	})
+
+	var (
+		mu            sync.Mutex
+		notifications []recordedNotification
+	)
+	notify := func(method string, params interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, recordedNotification{method, params})
+		return nil
+	}
+	recorded := func() []recordedNotification {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedNotification(nil), notifications...)
+	}
+	return newRequestServer(srv, notify, "session-1"), recorded
+}
+
+func TestRequestServer_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s, _ := newTestRequestServer(func(ctx context.Context) (jsonrpc2.Result, *jsonrpc2.Error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return &mcp.CallToolResult{}, nil
+	})
+
+	// Over stdio the transport reads the next message only after Handle
+	// returns, so a tool call must not block it.
+	s.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","id":"call-1","method":"tools/call","params":{"name":"slow"}}`))
+	<-started
+	s.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"call-1"}}`))
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("notifications/cancelled did not cancel the tool call")
+	}
+	select {
+	case response := <-s.GetResponses():
+		t.Errorf("a cancelled tool call sent a response: %+v", response)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRequestServer_CancelUnknownRequest(t *testing.T) {
+	s, _ := newTestRequestServer(func(ctx context.Context) (jsonrpc2.Result, *jsonrpc2.Error) {
+		return &mcp.CallToolResult{}, nil
+	})
+
+	responses := s.HandleAndGetResponses(context.Background(),
+		[]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":42}}`))
+	if len(responses) != 0 {
+		t.Errorf("cancelling an unknown request returned %v, want no response", responses)
+	}
+
+	responses = s.HandleAndGetResponses(context.Background(),
+		[]byte(`{"jsonrpc":"2.0","id":42,"method":"tools/call","params":{"name":"fast"}}`))
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Errorf("tools/call returned %v, want one result", responses)
+	}
+}
+
+func TestRequestServer_Progress(t *testing.T) {
+	s, recorded := newTestRequestServer(func(ctx context.Context) (jsonrpc2.Result, *jsonrpc2.Error) {
+		reportProgress(ctx, 10, 100, "Read 10 rows")
+		// Updates within minProgressInterval of the last one are dropped.
+		reportProgress(ctx, 20, 100, "Read 20 rows")
+		return &mcp.CallToolResult{}, nil
+	})
+
+	s.HandleAndGetResponses(context.Background(),
+		[]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"q","_meta":{"progressToken":"tok-1"}}}`))
+	s.HandleAndGetResponses(context.Background(),
+		[]byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"q"}}`))
+
+	notifications := recorded()
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1: %v", len(notifications), notifications)
+	}
+	if notifications[0].method != methodProgress {
+		t.Errorf("method = %s, want %s", notifications[0].method, methodProgress)
+	}
+	data, _ := json.Marshal(notifications[0].params)
+	expected := `{"progressToken":"tok-1","progress":10,"total":100,"message":"Read 10 rows"}`
+	if string(data) != expected {
+		t.Errorf("params = %s, want %s", data, expected)
+	}
+}
+
+func TestRequestServer_ToolCallContext(t *testing.T) {
+	var call *toolCall
+	s, _ := newTestRequestServer(func(ctx context.Context) (jsonrpc2.Result, *jsonrpc2.Error) {
+		call = toolCallFromContext(ctx)
+		return &mcp.CallToolResult{}, nil
+	})
+
+	s.HandleAndGetResponses(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"claude-ai","version":"1"}}}`))
+	s.HandleAndGetResponses(context.Background(), []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"clickhouse-query"}}`))
+
+	expected := toolCall{Client: "claude-ai", Tool: "clickhouse-query", Session: "session-1"}
+	if call == nil || *call != expected {
+		t.Errorf("tool call context = %+v, want %+v", call, expected)
+	}
+}
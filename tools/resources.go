@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	resourcePageSize     = 100
+	resourcePollInterval = 30 * time.Second
+	resourcePollTimeout  = 10 * time.Second
+
+	methodResourceUpdated     = "notifications/resources/updated"
+	methodResourceListChanged = "notifications/resources/list_changed"
+
+	errCodeInvalidParams = -32602
+)
+
+// resourceMux extends the library's resource mux, which lists everything in one
+// response and has no templates or subscriptions.
+type resourceMux struct {
+	fxctx.ResourceMux
+	watcher   *ResourceWatcher
+	completer *ClickHouseCompleter
+}
+
+// DecorateResourceMux adds cursor pagination to resources/list, handles
+// resources/templates/list, resources/subscribe and resources/unsubscribe,
+// and completes the arguments of the table resource template.
+func DecorateResourceMux(mux fxctx.ResourceMux, watcher *ResourceWatcher, completer *ClickHouseCompleter) fxctx.ResourceMux {
+	return &resourceMux{ResourceMux: mux, watcher: watcher, completer: completer}
+}
+
+// Complete completes the arguments of the table resource template. Clients
+// may send the template with the connection already filled in, as in
+// clickhouse://prod/{database}/{table}, to complete from that profile.
+func (m *resourceMux) Complete(ctx context.Context, req *mcp.CompleteRequest, uri string) (*mcp.CompleteResult, error) {
+	profile, ok := templateConnection(uri)
+	if !ok {
+		return m.ResourceMux.Complete(ctx, req, uri)
+	}
+	return m.completer.Complete(ctx, profile, req.Params.Argument.Name, req.Params.Argument.Value)
+}
+
+func (m *resourceMux) RegisterHandlers(s server.Server) {
+	m.ResourceMux.RegisterHandlers(s)
+
+	s.SetRequestHandler(&mcp.ListResourcesRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		var cursor string
+		if params := req.(*mcp.ListResourcesRequest).Params; params != nil && params.Cursor != nil {
+			cursor = *params.Cursor
+		}
+
+		resources, err := m.GetResources(ctx)
+		if err != nil {
+			return nil, jsonrpc2.NewServerError(fxctx.ListResourcesFailed, fmt.Sprintf("failed to get resources: %v", err))
+		}
+		m.watcher.setListed(resources)
+
+		page, next, err := paginateResources(resources, cursor, resourcePageSize)
+		if err != nil {
+			return nil, &jsonrpc2.Error{Code: errCodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+		}
+		return &mcp.ListResourcesResult{Resources: page, NextCursor: next}, nil
+	})
+
+	s.SetRequestHandler(&mcp.ListResourceTemplatesRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		return &mcp.ListResourceTemplatesResult{ResourceTemplates: clickHouseResourceTemplates}, nil
+	})
+
+	s.SetRequestHandler(&mcp.SubscribeRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		uri := req.(*mcp.SubscribeRequest).Params.Uri
+		if err := m.watcher.Subscribe(ctx, uri); err != nil {
+			return nil, &jsonrpc2.Error{Code: errCodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+		}
+		return struct{}{}, nil
+	})
+
+	s.SetRequestHandler(&mcp.UnsubscribeRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		m.watcher.Unsubscribe(req.(*mcp.UnsubscribeRequest).Params.Uri)
+		return struct{}{}, nil
+	})
+}
+
+// paginateResources returns the page of resources after cursor, ordered by
+// URI. The cursor encodes the last URI of the previous page, so pages stay
+// consistent when resources are added or removed in between.
+func paginateResources(resources []mcp.Resource, cursor string, pageSize int) ([]mcp.Resource, *string, error) {
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Uri < resources[j].Uri })
+
+	start := 0
+	if cursor != "" {
+		last, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cursor %q", cursor)
+		}
+		start = sort.Search(len(resources), func(i int) bool { return resources[i].Uri > string(last) })
+	}
+
+	end := min(start+pageSize, len(resources))
+	page := resources[start:end]
+	if end == len(resources) {
+		return page, nil, nil
+	}
+	return page, ptr(base64.RawURLEncoding.EncodeToString([]byte(page[len(page)-1].Uri))), nil
+}
+
+// ResourceWatcher polls subscribed table resources and notifies the client
+// when their structure changes, and when tables are created or dropped after
+// the client has listed resources.
+type ResourceWatcher struct {
+	client   *ClickHouseClient
+	notifier *Notifier
+	logger   *zap.Logger
+
+	mu sync.Mutex
+	// subscriptions maps subscribed URIs to the last seen table structure.
+	subscriptions map[string]string
+	// listed holds the URIs last returned by resources/list, nil until then.
+	listed map[string]bool
+}
+
+// NewResourceWatcher creates the watcher and runs its polling loop for the
+// lifetime of the fx app.
+func NewResourceWatcher(lc fx.Lifecycle, client *ClickHouseClient, notifier *Notifier, logger *zap.Logger) *ResourceWatcher {
+	w := newResourceWatcher(client, notifier, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				w.run(ctx, resourcePollInterval)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-stopCtx.Done():
+			}
+			return nil
+		},
+	})
+	return w
+}
+
+func newResourceWatcher(client *ClickHouseClient, notifier *Notifier, logger *zap.Logger) *ResourceWatcher {
+	return &ResourceWatcher{
+		client:        client,
+		notifier:      notifier,
+		logger:        logger,
+		subscriptions: map[string]string{},
+	}
+}
+
+// Subscribe starts watching the table behind uri.
+func (w *ResourceWatcher) Subscribe(ctx context.Context, uri string) error {
+	resource, ok := parseTableResourceURI(uri)
+	if !ok {
+		return fmt.Errorf("unsupported resource URI %q, expected %s", uri, tableResourceTemplate)
+	}
+
+	structure, err := tableStructure(ctx, w.client, resource)
+	if err != nil {
+		return fmt.Errorf("failed to read table %s.%s: %w", resource.Database, resource.Table, err)
+	}
+	if structure == "" {
+		return fmt.Errorf("table %s.%s does not exist", resource.Database, resource.Table)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscriptions[uri] = structure
+	return nil
+}
+
+// Unsubscribe stops watching uri.
+func (w *ResourceWatcher) Unsubscribe(uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.subscriptions, uri)
+}
+
+// setListed records the tables last listed to the client. Other resources
+// are static and not watched.
+func (w *ResourceWatcher) setListed(resources []mcp.Resource) {
+	listed := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		if strings.HasPrefix(r.Uri, tableResourceScheme) {
+			listed[r.Uri] = true
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listed = listed
+}
+
+func (w *ResourceWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pollCtx, cancel := context.WithTimeout(ctx, resourcePollTimeout)
+			w.poll(pollCtx)
+			cancel()
+		}
+	}
+}
+
+// poll checks subscribed tables and the table list once.
+func (w *ResourceWatcher) poll(ctx context.Context) {
+	w.mu.Lock()
+	subscriptions := make(map[string]string, len(w.subscriptions))
+	for uri, structure := range w.subscriptions {
+		subscriptions[uri] = structure
+	}
+	watchList := w.listed != nil
+	w.mu.Unlock()
+
+	for uri, previous := range subscriptions {
+		resource, _ := parseTableResourceURI(uri)
+		structure, err := tableStructure(ctx, w.client, resource)
+		if err != nil {
+			w.logger.Debug("failed to check resource", zap.String("uri", uri), zap.Error(err))
+			continue
+		}
+		if structure == previous {
+			continue
+		}
+
+		w.mu.Lock()
+		_, subscribed := w.subscriptions[uri]
+		if subscribed {
+			w.subscriptions[uri] = structure
+		}
+		w.mu.Unlock()
+
+		if subscribed {
+			w.notify(methodResourceUpdated, mcp.ResourceUpdatedNotificationParams{Uri: uri})
+		}
+	}
+
+	if !watchList {
+		return
+	}
+	resources, err := listTableResources(ctx, w.client)
+	if err != nil {
+		w.logger.Debug("failed to list resources", zap.Error(err))
+		return
+	}
+	if w.listChanged(resources) {
+		w.setListed(resources)
+		w.notify(methodResourceListChanged, nil)
+	}
+}
+
+func (w *ResourceWatcher) listChanged(resources []mcp.Resource) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(resources) != len(w.listed) {
+		return true
+	}
+	for _, r := range resources {
+		if !w.listed[r.Uri] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *ResourceWatcher) notify(method string, params interface{}) {
+	if err := w.notifier.Notify(method, params); err != nil {
+		w.logger.Error("failed to send notification", zap.String("method", method), zap.Error(err))
+	}
+}
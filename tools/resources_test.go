@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestPaginateResources(t *testing.T) {
+	var resources []mcp.Resource
+	for i := 4; i >= 0; i-- {
+		resources = append(resources, mcp.Resource{Uri: fmt.Sprintf("clickhouse://default/db/t%d", i)})
+	}
+
+	var uris []string
+	cursor, pages := "", 0
+	for {
+		page, next, err := paginateResources(resources, cursor, 2)
+		if err != nil {
+			t.Fatalf("paginateResources() returned error: %v", err)
+		}
+		pages++
+		for _, r := range page {
+			uris = append(uris, r.Uri)
+		}
+		if next == nil {
+			break
+		}
+		cursor = *next
+	}
+
+	if pages != 3 {
+		t.Errorf("got %d pages, want 3", pages)
+	}
+	expected := "clickhouse://default/db/t0 clickhouse://default/db/t1 clickhouse://default/db/t2 clickhouse://default/db/t3 clickhouse://default/db/t4"
+	if got := strings.Join(uris, " "); got != expected {
+		t.Errorf("paginated URIs = %s, want %s", got, expected)
+	}
+
+	if _, _, err := paginateResources(resources, "not base64!", 2); err == nil {
+		t.Error("Expected an invalid cursor to be rejected")
+	}
+}
+
+func TestResourceWatcher_ListChanged(t *testing.T) {
+	w := newResourceWatcher(nil, nil, nil)
+	table := mcp.Resource{Uri: "clickhouse://default/db/hits"}
+	w.setListed([]mcp.Resource{table, {Uri: searchResultsSchemaURI}})
+
+	if w.listChanged([]mcp.Resource{table}) {
+		t.Error("listChanged() = true for the same tables, want static resources ignored")
+	}
+	if !w.listChanged([]mcp.Resource{table, {Uri: "clickhouse://default/db/visits"}}) {
+		t.Error("listChanged() = false with a new table, want true")
+	}
+}
+
+func TestNotifier_LineAtomic(t *testing.T) {
+	var out strings.Builder
+	notifier := NewNotifier(&out)
+
+	// The transport writes a response and its newline separately.
+	if _, err := notifier.Write([]byte(`{"id":1}`)); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	if err := notifier.Notify(methodResourceListChanged, nil); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+	if _, err := notifier.Write([]byte("\n")); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	expected := `{"jsonrpc":"2.0","method":"notifications/resources/list_changed"}` + "\n" + `{"id":1}` + "\n"
+	if out.String() != expected {
+		t.Errorf("output = %q, want %q", out.String(), expected)
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -20,20 +20,50 @@ const (
 	requestTimeout     = 30 * time.Second
 	userAgent          = "local-mcp/1.0"
 	titleMaxLength     = 60
+
+	// maxSearchResponseSize bounds the response body read from a provider.
+	maxSearchResponseSize = 5 << 20
+
+	envSearchProvider = "LOCAL_MCP_SEARCH_PROVIDER"
+)
+
+// Search provider names, accepted by LOCAL_MCP_SEARCH_PROVIDER and the
+// provider argument of search-web.
+const (
+	providerDuckDuckGo        = "duckduckgo"
+	providerDuckDuckGoInstant = "duckduckgo-instant"
+	providerSearXNG           = "searxng"
+	providerBrave             = "brave"
+	providerJSON              = "json"
 )
 
+var searchProviderNames = []string{providerDuckDuckGo, providerDuckDuckGoInstant, providerSearXNG, providerBrave, providerJSON}
+
+// SearchProvider runs web searches against one search backend.
+type SearchProvider interface {
+	// Name identifies the provider in results and in the provider argument.
+	Name() string
+	// Search returns at most limit results for query.
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
 // SearchResult represents a single search result.
 type SearchResult struct {
 	Title       string `json:"title"`
 	URL         string `json:"url"`
 	Description string `json:"description"`
+	// Source and Published are the site name and publication date, for
+	// providers that report them.
+	Source    string `json:"source,omitempty"`
+	Published string `json:"published,omitempty"`
 }
 
 // SearchResponse contains the complete search response.
 type SearchResponse struct {
-	Results []SearchResult `json:"results"`
-	Query   string         `json:"query"`
-	Total   int            `json:"total"`
+	Results  []SearchResult `json:"results"`
+	Query    string         `json:"query"`
+	Total    int            `json:"total"`
+	Provider string         `json:"provider"`
 }
 
 // DuckDuckGoResponse represents the API response from DuckDuckGo.
@@ -52,12 +82,13 @@ type duckDuckGoResponse struct {
 	} `json:"Results"`
 }
 
-// NewSearchTool creates a new web search tool using DuckDuckGo.
-func NewSearchTool() fxctx.Tool {
+// NewSearchTool creates a new web search tool backed by the configured search
+// provider, with its results cached in cache.
+func NewSearchTool(cache *ResultCache) fxctx.Tool {
 	return fxctx.NewTool(
 		&mcp.Tool{
 			Name:        "search-web",
-			Description: ptr("Search the web using DuckDuckGo. Returns a list of search results with titles, URLs, and descriptions."),
+			Description: ptr("Search the web (DuckDuckGo by default, or SearXNG, Brave Search or a custom JSON search API when configured). Returns a list of search results with titles, URLs, and descriptions."),
 			InputSchema: mcp.ToolInputSchema{
 				Type: "object",
 				Properties: map[string]map[string]interface{}{
@@ -72,32 +103,98 @@ func NewSearchTool() fxctx.Tool {
 						"maximum":     maxSearchLimit,
 						"default":     defaultSearchLimit,
 					},
+					"provider": {
+						"type":        "string",
+						"description": "Search provider to use instead of the configured default (it must be configured on the server)",
+						"enum":        searchProviderNames,
+					},
+					"bypass_cache": {
+						"type":        "boolean",
+						"description": "Search again instead of returning cached results (default: false)",
+						"default":     false,
+					},
+					"format": {
+						"type":        "string",
+						"description": "text for a readable list (default), or json for a payload conforming to the schema at " + searchResultsSchemaURI,
+						"enum":        searchFormats,
+						"default":     searchFormatText,
+					},
+					"links": {
+						"type":        "string",
+						"description": "Content item to add for each result URL: none (default), or embedded for a resource holding the title and snippet",
+						"enum":        searchLinks,
+						"default":     searchLinksNone,
+					},
 				},
 				Required: []string{"query"},
 			},
 		},
-		searchHandler,
+		searchHandler(cache),
 	)
 }
 
-func searchHandler(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
-	query, ok := args["query"].(string)
-	if !ok || strings.TrimSpace(query) == "" {
-		return errorResult("Query parameter is required and must be a non-empty string")
-	}
+func searchHandler(cache *ResultCache) func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	return func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+		query, ok := args["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return errorResult("Query parameter is required and must be a non-empty string")
+		}
 
-	limit := parseLimit(args["limit"])
+		limit := parseLimit(args["limit"])
+		bypass, _ := args["bypass_cache"].(bool)
+		format, err := parseSearchOption(args, "format", searchFormats)
+		if err != nil {
+			return errorResult(err.Error())
+		}
+		links, err := parseSearchOption(args, "links", searchLinks)
+		if err != nil {
+			return errorResult(err.Error())
+		}
 
-	results, err := performSearch(ctx, query, limit)
-	if err != nil {
-		return errorResult(fmt.Sprintf("Search failed: %v", err))
-	}
+		name, _ := args["provider"].(string)
+		provider, err := newSearchProvider(name)
+		if err != nil {
+			return errorResult(fmt.Sprintf("Invalid provider: %v", err))
+		}
 
-	if len(results.Results) == 0 {
-		return successResult(fmt.Sprintf("No results found for query: %s", query))
+		results, info, err := cachedResult(cache, searchCacheKey(provider.Name(), query, limit), bypass, func() (*SearchResponse, error) {
+			return performSearch(ctx, provider, query, limit)
+		})
+		if err != nil {
+			return errorResult(fmt.Sprintf("Search failed: %v", err))
+		}
+		results.Query = query
+
+		var result *mcp.CallToolResult
+		switch {
+		case format == searchFormatJSON:
+			payload, err := searchResultsJSON(results, info)
+			if err != nil {
+				return errorResult(err.Error())
+			}
+			result = &mcp.CallToolResult{
+				IsError: ptr(false),
+				Content: append([]interface{}{payload}, searchResultLinks(results.Results, links)...),
+			}
+		case len(results.Results) == 0:
+			message := fmt.Sprintf("No results found for query: %s", query)
+			if note := info.describe(); note != "" {
+				message += " (" + note + ")"
+			}
+			result = successResult(message)
+		default:
+			result = formatSearchResults(results, info, links)
+		}
+		result.Meta = info.meta(result.Meta)
+		return result
 	}
+}
 
-	return formatSearchResults(results)
+// searchCacheKey identifies the results of a search in the cache. Searches
+// that differ only in case or spacing share their results.
+func searchCacheKey(provider, query string, limit int) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(query), " "))
+	return fmt.Sprintf("search\x00%s\x00%s\x00%d", provider, normalized, limit)
 }
 
 func parseLimit(limitArg interface{}) int {
@@ -114,32 +211,78 @@ func parseLimit(limitArg interface{}) int {
 	return limit
 }
 
-func performSearch(ctx context.Context, query string, limit int) (*SearchResponse, error) {
-	client := &http.Client{Timeout: requestTimeout}
-
-	searchURL := fmt.Sprintf("https://api.duckduckgo.com/?q=%s&format=json&no_html=1&skip_disambig=1",
-		url.QueryEscape(query))
+// newSearchProvider creates the provider called name from its environment
+// configuration, or the one selected by LOCAL_MCP_SEARCH_PROVIDER (by default
+// DuckDuckGo) if name is empty.
+func newSearchProvider(name string) (SearchProvider, error) {
+	if name == "" {
+		name = getEnvOrDefault(envSearchProvider, providerDuckDuckGo)
+	}
+	name = strings.ToLower(name)
+
+	switch name {
+	case providerDuckDuckGo:
+		return &duckDuckGoHTMLProvider{endpoint: duckDuckGoHTMLEndpoint, client: sharedSearchClient(name)}, nil
+	case providerDuckDuckGoInstant:
+		return &duckDuckGoInstantProvider{endpoint: duckDuckGoInstantEndpoint, client: sharedSearchClient(name)}, nil
+	case providerSearXNG:
+		endpoint := os.Getenv(envSearXNGURL)
+		if endpoint == "" {
+			return nil, fmt.Errorf("%s is not configured (set %s)", providerSearXNG, envSearXNGURL)
+		}
+		return &searXNGProvider{endpoint: endpoint, client: sharedSearchClient(name)}, nil
+	case providerBrave:
+		apiKey := os.Getenv(envBraveAPIKey)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%s is not configured (set %s)", providerBrave, envBraveAPIKey)
+		}
+		return &braveProvider{endpoint: braveEndpoint, apiKey: apiKey, client: sharedSearchClient(name)}, nil
+	case providerJSON:
+		return newJSONSearchProviderFromEnv(sharedSearchClient(name))
+	default:
+		return nil, fmt.Errorf("unknown search provider %q (supported: %s)", name, strings.Join(searchProviderNames, ", "))
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+func performSearch(ctx context.Context, provider SearchProvider, query string, limit int) (*SearchResponse, error) {
+	results, err := provider.Search(ctx, query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
+	}
+	if len(results) > limit {
+		results = results[:limit]
 	}
 
-	req.Header.Set("User-Agent", userAgent)
+	return &SearchResponse{
+		Results:  results,
+		Query:    query,
+		Total:    len(results),
+		Provider: provider.Name(),
+	}, nil
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute search request: %w", err)
-	}
-	defer resp.Body.Close()
+const duckDuckGoInstantEndpoint = "https://api.duckduckgo.com/"
+
+// duckDuckGoInstantProvider uses the DuckDuckGo Instant Answer API, which
+// only answers queries with an abstract or related topics.
+type duckDuckGoInstantProvider struct {
+	endpoint string
+	client   *searchClient
+}
+
+func (p *duckDuckGoInstantProvider) Name() string { return providerDuckDuckGoInstant }
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search API returned status %d", resp.StatusCode)
+func (p *duckDuckGoInstantProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	searchURL := fmt.Sprintf("%s?q=%s&format=json&no_html=1&skip_disambig=1", p.endpoint, url.QueryEscape(query))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := p.client.fetch(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
 	var ddgResponse duckDuckGoResponse
@@ -147,16 +290,7 @@ func performSearch(ctx context.Context, query string, limit int) (*SearchRespons
 		return nil, fmt.Errorf("failed to parse search response: %w", err)
 	}
 
-	results := extractSearchResults(&ddgResponse, limit)
-	if len(results) == 0 {
-		return createFallbackResponse(query, searchURL), nil
-	}
-
-	return &SearchResponse{
-		Results: results,
-		Query:   query,
-		Total:   len(results),
-	}, nil
+	return extractSearchResults(&ddgResponse, limit), nil
 }
 
 func extractSearchResults(ddgResponse *duckDuckGoResponse, limit int) []SearchResult {
@@ -168,6 +302,7 @@ func extractSearchResults(ddgResponse *duckDuckGoResponse, limit int) []SearchRe
 			Title:       ddgResponse.AbstractSource,
 			URL:         ddgResponse.AbstractURL,
 			Description: ddgResponse.AbstractText,
+			Source:      ddgResponse.AbstractSource,
 		})
 	}
 
@@ -198,20 +333,6 @@ func extractSearchResults(ddgResponse *duckDuckGoResponse, limit int) []SearchRe
 	return results
 }
 
-func createFallbackResponse(query, searchURL string) *SearchResponse {
-	return &SearchResponse{
-		Results: []SearchResult{
-			{
-				Title:       "DuckDuckGo Search",
-				URL:         searchURL,
-				Description: fmt.Sprintf("No instant answers found for '%s'. Please visit DuckDuckGo directly for web search results.", query),
-			},
-		},
-		Query: query,
-		Total: 1,
-	}
-}
-
 func extractTitle(text string) string {
 	text = strings.TrimSpace(text)
 
@@ -231,15 +352,28 @@ func extractTitle(text string) string {
 	return text
 }
 
-func formatSearchResults(results *SearchResponse) *mcp.CallToolResult {
+// formatSearchResults lists the results as text, or with links set as the
+// content items of searchResultLinks.
+func formatSearchResults(results *SearchResponse, info cacheInfo, links string) *mcp.CallToolResult {
 	var content []interface{}
 
 	// Add summary
+	cached := ""
+	if note := info.describe(); note != "" {
+		cached = ", " + note
+	}
 	content = append(content, mcp.TextContent{
 		Type: "text",
-		Text: fmt.Sprintf("Search results for '%s' (%d results):\n", results.Query, len(results.Results)),
+		Text: fmt.Sprintf("Search results for '%s' from %s (%d results%s):\n", results.Query, results.Provider, len(results.Results), cached),
 	})
 
+	if links != searchLinksNone {
+		return &mcp.CallToolResult{
+			IsError: ptr(false),
+			Content: append(content, searchResultLinks(results.Results, links)...),
+		}
+	}
+
 	// Add each result
 	for i, result := range results.Results {
 		resultText := fmt.Sprintf("%d. **%s**\n   URL: %s\n   %s\n",
@@ -0,0 +1,350 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	envSearchRateLimit  = "LOCAL_MCP_SEARCH_RATE_LIMIT"
+	envSearchMaxRetries = "LOCAL_MCP_SEARCH_MAX_RETRIES"
+
+	// defaultSearchRateLimit is the number of requests per minute sent to
+	// each provider.
+	defaultSearchRateLimit  = 30
+	defaultSearchMaxRetries = 3
+	searchRateBurst         = 5
+
+	searchRetryBaseDelay = 500 * time.Millisecond
+	searchRetryMaxDelay  = 10 * time.Second
+	// searchMaxRetryAfter is the longest Retry-After that is waited for;
+	// a provider asking for more fails the search instead.
+	searchMaxRetryAfter = 30 * time.Second
+
+	searchBreakerThreshold = 5
+	searchBreakerCooldown  = 30 * time.Second
+)
+
+// searchHTTPClient is shared by all providers, so that connections to them
+// are reused across searches.
+var searchHTTPClient = &http.Client{Timeout: requestTimeout}
+
+var (
+	searchClientsMu sync.Mutex
+	searchClients   = map[string]*searchClient{}
+)
+
+// providerUnavailableError is returned while the circuit breaker of a
+// provider is open.
+type providerUnavailableError struct {
+	Provider string
+	Failures int
+	RetryIn  time.Duration
+}
+
+func (e *providerUnavailableError) Error() string {
+	return fmt.Sprintf("search provider %s is temporarily unavailable after %d consecutive failures, try again in %s",
+		e.Provider, e.Failures, e.RetryIn.Round(time.Second))
+}
+
+// rateLimitedError is returned when a request would have to wait longer than
+// requestTimeout for the provider's rate limit.
+type rateLimitedError struct {
+	Provider string
+	RetryIn  time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("search provider %s is rate limited, retry in %s", e.Provider, e.RetryIn.Round(time.Second))
+}
+
+// searchClient sends the requests of one provider: it spaces them with a
+// token bucket, retries rate-limited and failed requests with exponential
+// backoff, and stops calling the provider for a while after repeated
+// failures.
+type searchClient struct {
+	name       string
+	http       *http.Client
+	limiter    *tokenBucket
+	breaker    *circuitBreaker
+	maxRetries int
+	// sleep waits for d unless ctx ends first.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// sharedSearchClient returns the client of the provider called name, creating
+// it from the environment on first use. Its rate limit and circuit breaker
+// thus apply across searches.
+func sharedSearchClient(name string) *searchClient {
+	searchClientsMu.Lock()
+	defer searchClientsMu.Unlock()
+	client, ok := searchClients[name]
+	if !ok {
+		client = newSearchClient(name, searchHTTPClient, parseEnvInt(envSearchRateLimit, defaultSearchRateLimit), parseEnvInt(envSearchMaxRetries, defaultSearchMaxRetries))
+		searchClients[name] = client
+	}
+	return client
+}
+
+// newSearchClient creates a client sending at most ratePerMinute requests
+// per minute, or any number if it is not positive.
+func newSearchClient(name string, httpClient *http.Client, ratePerMinute, maxRetries int) *searchClient {
+	client := &searchClient{
+		name:       name,
+		http:       httpClient,
+		breaker:    &circuitBreaker{threshold: searchBreakerThreshold, cooldown: searchBreakerCooldown, now: time.Now},
+		maxRetries: max(maxRetries, 0),
+		sleep:      sleepContext,
+	}
+	if ratePerMinute > 0 {
+		client.limiter = newTokenBucket(float64(ratePerMinute)/60, searchRateBurst, time.Now)
+	}
+	return client
+}
+
+// fetch sends req with the tool's user agent and returns the body of a
+// successful response.
+func (c *searchClient) fetch(req *http.Request) ([]byte, error) {
+	if err := c.breaker.allow(c.name); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	body, err := c.fetchWithRetries(req)
+	var (
+		retryErr *retryableError
+		rateErr  *rateLimitedError
+	)
+	switch {
+	case req.Context().Err() != nil || errors.As(err, &rateErr):
+		c.breaker.abort()
+	case errors.As(err, &retryErr):
+		c.breaker.record(false)
+	default:
+		// The provider answered, so it is healthy even if the request
+		// was refused.
+		c.breaker.record(true)
+	}
+	return body, err
+}
+
+func (c *searchClient) fetchWithRetries(req *http.Request) ([]byte, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		body, retryAfter, err := c.do(req.Clone(ctx))
+		var retryErr *retryableError
+		if err == nil || !errors.As(err, &retryErr) || ctx.Err() != nil {
+			return body, err
+		}
+
+		delay := backoffDelay(attempt)
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		if attempt >= c.maxRetries || delay > searchMaxRetryAfter {
+			if attempt > 0 {
+				return nil, fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return nil, err
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait waits for the rate limit to allow a request. A wait longer than
+// requestTimeout fails at once, and a wait that is cancelled hands its token
+// back, so that abandoned searches do not delay later ones.
+func (c *searchClient) wait(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	delay, ok := c.limiter.reserve(requestTimeout)
+	if !ok {
+		return &rateLimitedError{Provider: c.name, RetryIn: delay}
+	}
+	if err := c.sleep(ctx, delay); err != nil {
+		c.limiter.refund()
+		return err
+	}
+	return nil
+}
+
+// retryableError is a failure worth retrying: a network error or a status
+// that says the provider is overloaded or rate limiting.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// do sends req once. Along with retryable failures it returns how long the
+// provider asked to wait in Retry-After, if it did.
+func (c *searchClient) do(req *http.Request) ([]byte, time.Duration, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, &retryableError{fmt.Errorf("failed to execute search request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			&retryableError{fmt.Errorf("search API returned status %d", resp.StatusCode)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("search API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSearchResponseSize))
+	if err != nil {
+		return nil, 0, &retryableError{fmt.Errorf("failed to read response body: %w", err)}
+	}
+	return body, 0, nil
+}
+
+// backoffDelay returns the wait before retry attempt+1: an exponentially
+// growing delay, of which a random half is taken off so that clients do not
+// retry in step.
+func backoffDelay(attempt int) time.Duration {
+	delay := searchRetryMaxDelay
+	if attempt < 10 {
+		delay = min(searchRetryBaseDelay<<attempt, searchRetryMaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an HTTP
+// date, and returns 0 if there is none.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tokenBucket allows rate requests per second on average, and bursts of up
+// to burst requests.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now func() time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now(), now: now}
+}
+
+// reserve takes a token and returns how long to wait before using it. Tokens
+// are handed out in order, so a waiting request is never overtaken. If the
+// wait would be longer than maxWait, no token is taken and reserve returns
+// the wait and false.
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// refund returns a reserved token that was not used.
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// circuitBreaker opens after threshold consecutive failures and then refuses
+// requests for cooldown. After that it lets one request through: its success
+// closes the breaker, its failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func (b *circuitBreaker) allow(provider string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.openUntil) || b.probing {
+		return &providerUnavailableError{Provider: provider, Failures: b.failures, RetryIn: max(b.openUntil.Sub(now), time.Second)}
+	}
+	b.probing = true
+	return nil
+}
+
+// abort ends a request that was cancelled, which says nothing about the
+// provider.
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
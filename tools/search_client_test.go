@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFreshSearchClients gives the test its own provider clients, without a
+// rate limit.
+func useFreshSearchClients(t *testing.T) {
+	t.Setenv(envSearchRateLimit, "0")
+	searchClientsMu.Lock()
+	saved := searchClients
+	searchClients = map[string]*searchClient{}
+	searchClientsMu.Unlock()
+	t.Cleanup(func() {
+		searchClientsMu.Lock()
+		searchClients = saved
+		searchClientsMu.Unlock()
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"Fri, 02 Jan 2026 03:04:15 GMT", 10 * time.Second},
+		{"Fri, 02 Jan 2026 03:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if result := parseRetryAfter(tt.value, now); result != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, result, tt.expected)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, ceiling := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		for range 20 {
+			if delay := backoffDelay(attempt); delay < ceiling/2 || delay > ceiling {
+				t.Errorf("backoffDelay(%d) = %v, want between %v and %v", attempt, delay, ceiling/2, ceiling)
+			}
+		}
+	}
+	if delay := backoffDelay(100); delay > searchRetryMaxDelay {
+		t.Errorf("backoffDelay(100) = %v, want at most %v", delay, searchRetryMaxDelay)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	bucket := newTokenBucket(1, 2, func() time.Time { return now })
+
+	for i, expected := range []time.Duration{0, 0, time.Second, 2 * time.Second} {
+		if delay, ok := bucket.reserve(time.Minute); delay != expected || !ok {
+			t.Errorf("reserve() #%d = %v, %v, want %v", i+1, delay, ok, expected)
+		}
+	}
+	now = now.Add(3 * time.Second)
+	if delay, _ := bucket.reserve(time.Minute); delay != 0 {
+		t.Errorf("reserve() after refilling = %v, want 0", delay)
+	}
+	now = now.Add(time.Hour)
+	for i, expected := range []time.Duration{0, 0, time.Second} {
+		if delay, _ := bucket.reserve(time.Minute); delay != expected {
+			t.Errorf("reserve() #%d after an hour = %v, want %v (burst is capped)", i+1, delay, expected)
+		}
+	}
+
+	// Waits over the maximum take no token, and refunded tokens are
+	// available again.
+	for range 3 {
+		if delay, ok := bucket.reserve(time.Second); delay != 2*time.Second || ok {
+			t.Errorf("reserve() over the maximum wait = %v, %v, want 2s and no token", delay, ok)
+		}
+	}
+	bucket.refund()
+	bucket.refund()
+	if delay, ok := bucket.reserve(time.Second); delay != 0 || !ok {
+		t.Errorf("reserve() after refunds = %v, %v, want 0", delay, ok)
+	}
+}
+
+func TestSearchClient_RateLimit(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := newSearchClient("test", server.Client(), 60, 0)
+	client.limiter = newTokenBucket(1, 1, func() time.Time { return now })
+	fetch := func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		_, err := client.fetch(req)
+		return err
+	}
+
+	// Searches cancelled while waiting give their token back.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fetch(context.Background()); err != nil {
+		t.Fatalf("fetch() = %v, want success", err)
+	}
+	for range 100 {
+		if err := fetch(cancelled); !errors.Is(err, context.Canceled) {
+			t.Fatalf("fetch() while cancelled = %v, want context.Canceled", err)
+		}
+	}
+	if delay, ok := client.limiter.reserve(requestTimeout); delay != time.Second || !ok {
+		t.Errorf("after cancelled searches the next waits %v, want 1s", delay)
+	}
+
+	// A search that would wait longer than requestTimeout fails at once.
+	for range int(requestTimeout / time.Second) {
+		client.limiter.reserve(requestTimeout)
+	}
+	err := fetch(context.Background())
+	var limited *rateLimitedError
+	if !errors.As(err, &limited) || !strings.Contains(err.Error(), "rate limited, retry in") || requests != 1 {
+		t.Errorf("fetch() over the rate limit = %v after %d requests, want a rate limit error without a request", err, requests)
+	}
+	if client.breaker.failures != 0 {
+		t.Errorf("rate limiting counted %d breaker failures, want none", client.breaker.failures)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	breaker := &circuitBreaker{threshold: 2, cooldown: 30 * time.Second, now: func() time.Time { return now }}
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		record  *bool
+		allowed bool
+	}{
+		{name: "closed", allowed: true},
+		{name: "one failure", record: ptr(false), allowed: true},
+		{name: "open", record: ptr(false), allowed: false},
+		{name: "still open", advance: 29 * time.Second, allowed: false},
+		{name: "probe", advance: time.Second, allowed: true},
+		{name: "during the probe", allowed: false},
+		{name: "failed probe", record: ptr(false), allowed: false},
+		{name: "second probe", advance: 30 * time.Second, allowed: true},
+		{name: "closed again", record: ptr(true), allowed: true},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.record != nil {
+			breaker.record(*step.record)
+		}
+		err := breaker.allow("test")
+		var unavailable *providerUnavailableError
+		if (err == nil) != step.allowed || (err != nil && !errors.As(err, &unavailable)) {
+			t.Errorf("%s: allow() = %v, want allowed %v", step.name, err, step.allowed)
+		}
+	}
+}
+
+func TestSearchClient_Fetch(t *testing.T) {
+	var statuses []int
+	var retryAfter string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("request sent User-Agent %q, want %q", r.Header.Get("User-Agent"), userAgent)
+		}
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(strconv.Itoa(status)))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	client := newSearchClient("test", server.Client(), 0, 2)
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	client.breaker.threshold = 2
+	fetch := func() ([]byte, error) {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+		return client.fetch(req)
+	}
+
+	statuses, retryAfter = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, "2"
+	body, err := fetch()
+	if err != nil || string(body) != "200" || requests != 3 {
+		t.Fatalf("fetch() = %q, %v after %d requests, want success after 3", body, err, requests)
+	}
+	if len(slept) != 2 || slept[0] < 250*time.Millisecond || slept[0] > 500*time.Millisecond || slept[1] != 2*time.Second {
+		t.Errorf("fetch() waited %v, want a backoff of 250-500ms, then the Retry-After of 2s", slept)
+	}
+
+	requests, slept = 0, nil
+	statuses = []int{http.StatusNotFound}
+	if _, err := fetch(); err == nil || requests != 1 {
+		t.Errorf("fetch() of a 404 = %v after %d requests, want an error without retrying", err, requests)
+	}
+
+	requests, slept = 0, nil
+	statuses, retryAfter = []int{http.StatusTooManyRequests}, "3600"
+	if _, err := fetch(); err == nil || requests != 1 || len(slept) != 0 {
+		t.Errorf("fetch() asked to retry in an hour = %v after %d requests, want an error without waiting", err, requests)
+	}
+
+	requests = 0
+	statuses = []int{500, 500, 500}
+	_, err = fetch()
+	if err == nil || !strings.Contains(err.Error(), "status 500 (after 3 attempts)") || requests != 3 {
+		t.Errorf("fetch() of a failing provider = %v after %d requests, want it to give up after 3", err, requests)
+	}
+
+	requests = 0
+	_, err = fetch()
+	var unavailable *providerUnavailableError
+	if !errors.As(err, &unavailable) || requests != 0 {
+		t.Errorf("fetch() after repeated failures = %v after %d requests, want the provider unavailable without a request", err, requests)
+	}
+	if !strings.Contains(err.Error(), "temporarily unavailable") {
+		t.Errorf("fetch() after repeated failures = %q, want it to say the provider is temporarily unavailable", err)
+	}
+}
@@ -0,0 +1,388 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	envSearXNGURL  = "LOCAL_MCP_SEARXNG_URL"
+	envBraveAPIKey = "LOCAL_MCP_BRAVE_API_KEY"
+
+	envSearchJSONURL         = "LOCAL_MCP_SEARCH_JSON_URL"
+	envSearchJSONHeaders     = "LOCAL_MCP_SEARCH_JSON_HEADERS"
+	envSearchJSONResults     = "LOCAL_MCP_SEARCH_JSON_RESULTS"
+	envSearchJSONTitle       = "LOCAL_MCP_SEARCH_JSON_TITLE"
+	envSearchJSONURLField    = "LOCAL_MCP_SEARCH_JSON_URL_FIELD"
+	envSearchJSONDescription = "LOCAL_MCP_SEARCH_JSON_DESCRIPTION"
+	envSearchJSONSource      = "LOCAL_MCP_SEARCH_JSON_SOURCE"
+	envSearchJSONPublished   = "LOCAL_MCP_SEARCH_JSON_PUBLISHED"
+
+	duckDuckGoHTMLEndpoint = "https://html.duckduckgo.com/html/"
+	braveEndpoint          = "https://api.search.brave.com/res/v1/web/search"
+	// braveMaxCount is the largest page the Brave Search API returns.
+	braveMaxCount = 20
+)
+
+// duckDuckGoHTMLProvider scrapes the results page of DuckDuckGo's HTML-only
+// interface, which returns ordinary web results without an API key.
+type duckDuckGoHTMLProvider struct {
+	endpoint string
+	client   *searchClient
+}
+
+func (p *duckDuckGoHTMLProvider) Name() string { return providerDuckDuckGo }
+
+func (p *duckDuckGoHTMLProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, err := p.client.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	return parseDuckDuckGoHTML(body)
+}
+
+// parseDuckDuckGoHTML extracts the results of a DuckDuckGo HTML results page,
+// skipping ads.
+func parseDuckDuckGoHTML(page []byte) ([]SearchResult, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	var results []SearchResult
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case hasClass(n, "result--ad"):
+				return
+			case n.Data == "a" && hasClass(n, "result__a"):
+				if target := duckDuckGoTarget(htmlAttr(n, "href")); target != "" {
+					results = append(results, SearchResult{Title: nodeText(n), URL: target})
+				}
+				return
+			case hasClass(n, "result__snippet"):
+				if len(results) > 0 {
+					results[len(results)-1].Description = nodeText(n)
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return results, nil
+}
+
+// duckDuckGoTarget returns the destination of a result link, which DuckDuckGo
+// wraps in a redirect through /l/?uddg=<url>.
+func duckDuckGoTarget(href string) string {
+	if strings.HasPrefix(href, "//") {
+		href = "https:" + href
+	}
+	link, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if strings.HasSuffix(link.Host, "duckduckgo.com") || link.Host == "" {
+		if target := link.Query().Get("uddg"); target != "" {
+			return target
+		}
+		return ""
+	}
+	return link.String()
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(htmlAttr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func htmlAttr(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the text inside n with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data + " ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// htmlText strips the markup, such as <strong> highlighting, from a snippet.
+func htmlText(s string) string {
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " ")
+		case html.TextToken:
+			text.WriteString(tokenizer.Token().Data)
+		}
+	}
+}
+
+// searXNGProvider queries a SearXNG instance, whose search.formats setting
+// must include json.
+type searXNGProvider struct {
+	endpoint string
+	client   *searchClient
+}
+
+func (p *searXNGProvider) Name() string { return providerSearXNG }
+
+func (p *searXNGProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	searchURL := strings.TrimSuffix(strings.TrimSuffix(p.endpoint, "/"), "/search") + "/search?format=json&q=" + url.QueryEscape(query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	body, err := p.client.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Results []struct {
+			Title         string  `json:"title"`
+			URL           string  `json:"url"`
+			Content       string  `json:"content"`
+			PublishedDate *string `json:"publishedDate"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response (is the json format enabled on the instance?): %w", err)
+	}
+
+	var results []SearchResult
+	for _, result := range response.Results {
+		if result.URL == "" {
+			continue
+		}
+		searchResult := SearchResult{Title: result.Title, URL: result.URL, Description: result.Content}
+		if result.PublishedDate != nil {
+			searchResult.Published = *result.PublishedDate
+		}
+		results = append(results, searchResult)
+	}
+	return results, nil
+}
+
+// braveProvider uses the Brave Search web search API.
+type braveProvider struct {
+	endpoint string
+	apiKey   string
+	client   *searchClient
+}
+
+func (p *braveProvider) Name() string { return providerBrave }
+
+func (p *braveProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	searchURL := fmt.Sprintf("%s?q=%s&count=%d", p.endpoint, url.QueryEscape(query), min(limit, braveMaxCount))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Subscription-Token", p.apiKey)
+
+	body, err := p.client.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+				PageAge     string `json:"page_age"`
+				Profile     struct {
+					Name string `json:"name"`
+				} `json:"profile"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	var results []SearchResult
+	for _, result := range response.Web.Results {
+		results = append(results, SearchResult{
+			Title:       htmlText(result.Title),
+			URL:         result.URL,
+			Description: htmlText(result.Description),
+			Source:      result.Profile.Name,
+			Published:   result.PageAge,
+		})
+	}
+	return results, nil
+}
+
+// jsonSearchProvider calls any HTTP search API that answers with JSON. The
+// URL template has {query} and {limit} placeholders, and the results are
+// read from the array and fields named by dot-separated paths. The source
+// and published fields are only read if configured.
+type jsonSearchProvider struct {
+	urlTemplate      string
+	headers          http.Header
+	resultsPath      string
+	titleField       string
+	urlField         string
+	descriptionField string
+	sourceField      string
+	publishedField   string
+	client           *searchClient
+}
+
+func newJSONSearchProviderFromEnv(client *searchClient) (*jsonSearchProvider, error) {
+	urlTemplate := os.Getenv(envSearchJSONURL)
+	if urlTemplate == "" {
+		return nil, fmt.Errorf("%s is not configured (set %s)", providerJSON, envSearchJSONURL)
+	}
+
+	headers := http.Header{}
+	for _, line := range strings.Split(os.Getenv(envSearchJSONHeaders), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q in %s, expected Name: value", line, envSearchJSONHeaders)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	return &jsonSearchProvider{
+		urlTemplate:      urlTemplate,
+		headers:          headers,
+		resultsPath:      getEnvOrDefault(envSearchJSONResults, "results"),
+		titleField:       getEnvOrDefault(envSearchJSONTitle, "title"),
+		urlField:         getEnvOrDefault(envSearchJSONURLField, "url"),
+		descriptionField: getEnvOrDefault(envSearchJSONDescription, "description"),
+		sourceField:      os.Getenv(envSearchJSONSource),
+		publishedField:   os.Getenv(envSearchJSONPublished),
+		client:           client,
+	}, nil
+}
+
+func (p *jsonSearchProvider) Name() string { return providerJSON }
+
+func (p *jsonSearchProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	searchURL := strings.NewReplacer("{query}", url.QueryEscape(query), "{limit}", strconv.Itoa(limit)).Replace(p.urlTemplate)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range p.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	body, err := p.client.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	items, ok := jsonPath(doc, p.resultsPath).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("search response has no result array at %q", p.resultsPath)
+	}
+
+	var results []SearchResult
+	for _, item := range items {
+		result := SearchResult{
+			Title:       jsonString(jsonPath(item, p.titleField)),
+			URL:         jsonString(jsonPath(item, p.urlField)),
+			Description: jsonString(jsonPath(item, p.descriptionField)),
+		}
+		if p.sourceField != "" {
+			result.Source = jsonString(jsonPath(item, p.sourceField))
+		}
+		if p.publishedField != "" {
+			result.Published = jsonString(jsonPath(item, p.publishedField))
+		}
+		if result.URL != "" {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// jsonPath follows a dot-separated path of object keys and array indexes in
+// a decoded JSON document. An empty path or "." is the document itself.
+func jsonPath(doc interface{}, path string) interface{} {
+	if path == "" || path == "." {
+		return doc
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			doc = node[i]
+		default:
+			return nil
+		}
+	}
+	return doc
+}
+
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const duckDuckGoHTMLPage = `<html><body><div id="links">
+<div class="result results_links result--ad">
+  <h2 class="result__title"><a class="result__a" href="https://duckduckgo.com/y.js?ad_provider=x">Sponsored</a></h2>
+  <a class="result__snippet" href="#">Buy now</a>
+</div>
+<div class="result results_links results_links_deep web-result">
+  <h2 class="result__title">
+    <a rel="nofollow" class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fclickhouse.com%2Fdocs%2Fen%2Fsql-reference&amp;rut=abc">SQL <b>Reference</b> | ClickHouse Docs</a>
+  </h2>
+  <a class="result__snippet" href="#">ClickHouse supports a <b>declarative</b> query language &amp; more.</a>
+</div>
+<div class="result results_links web-result">
+  <h2 class="result__title"><a class="result__a" href="https://go.dev/doc/">Documentation - The Go Programming Language</a></h2>
+</div>
+</div></body></html>`
+
+// searchStandIn serves body for every request and records the last one.
+func searchStandIn(t *testing.T, body string) (*httptest.Server, **http.Request) {
+	t.Helper()
+	var last *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &last
+}
+
+func TestSearchProviders(t *testing.T) {
+	ddg, ddgRequest := searchStandIn(t, duckDuckGoHTMLPage)
+	instant, instantRequest := searchStandIn(t, `{"AbstractText": "Go is a programming language.", "AbstractSource": "Wikipedia",
+		"AbstractURL": "https://en.wikipedia.org/wiki/Go", "RelatedTopics": [{"Text": "Gopher - The mascot", "FirstURL": "https://duckduckgo.com/Gopher"}]}`)
+	searx, searxRequest := searchStandIn(t, `{"results": [{"title": "ClickHouse", "url": "https://clickhouse.com/", "content": "Fast OLAP database", "publishedDate": "2026-01-02T00:00:00"}, {"title": "no url", "publishedDate": null}]}`)
+	brave, braveRequest := searchStandIn(t, `{"web": {"results": [{"title": "The <strong>Go</strong> Blog", "url": "https://go.dev/blog/", "description": "News &amp; articles about <strong>Go</strong>",
+		"page_age": "2026-01-02T10:00:00", "profile": {"name": "The Go Programming Language"}}]}}`)
+	custom, customRequest := searchStandIn(t, `{"data": {"items": [{"name": "Result", "link": {"href": "https://example.com/"}, "rank": 1, "site": "Example", "date": "2026-01-02"}]}}`)
+
+	tests := []struct {
+		name     string
+		provider SearchProvider
+		request  **http.Request
+		query    string
+		header   string
+		expected []SearchResult
+	}{
+		{
+			name:     "duckduckgo html",
+			provider: &duckDuckGoHTMLProvider{endpoint: ddg.URL + "/html/", client: newSearchClient("test", ddg.Client(), 0, 0)},
+			request:  ddgRequest,
+			query:    "q=clickhouse+sql",
+			expected: []SearchResult{
+				{Title: "SQL Reference | ClickHouse Docs", URL: "https://clickhouse.com/docs/en/sql-reference", Description: "ClickHouse supports a declarative query language & more."},
+				{Title: "Documentation - The Go Programming Language", URL: "https://go.dev/doc/"},
+			},
+		},
+		{
+			name:     "duckduckgo instant",
+			provider: &duckDuckGoInstantProvider{endpoint: instant.URL + "/", client: newSearchClient("test", instant.Client(), 0, 0)},
+			request:  instantRequest,
+			query:    "q=clickhouse+sql&format=json",
+			expected: []SearchResult{
+				{Title: "Wikipedia", URL: "https://en.wikipedia.org/wiki/Go", Description: "Go is a programming language.", Source: "Wikipedia"},
+				{Title: "Gopher", URL: "https://duckduckgo.com/Gopher", Description: "Gopher - The mascot"},
+			},
+		},
+		{
+			name:     "searxng",
+			provider: &searXNGProvider{endpoint: searx.URL + "/", client: newSearchClient("test", searx.Client(), 0, 0)},
+			request:  searxRequest,
+			query:    "format=json&q=clickhouse+sql",
+			expected: []SearchResult{{Title: "ClickHouse", URL: "https://clickhouse.com/", Description: "Fast OLAP database", Published: "2026-01-02T00:00:00"}},
+		},
+		{
+			name:     "brave",
+			provider: &braveProvider{endpoint: brave.URL, apiKey: "key-1", client: newSearchClient("test", brave.Client(), 0, 0)},
+			request:  braveRequest,
+			query:    "q=clickhouse+sql&count=5",
+			header:   "key-1",
+			expected: []SearchResult{{Title: "The Go Blog", URL: "https://go.dev/blog/", Description: "News & articles about Go", Source: "The Go Programming Language", Published: "2026-01-02T10:00:00"}},
+		},
+		{
+			name: "json",
+			provider: &jsonSearchProvider{
+				urlTemplate: custom.URL + "/api?search={query}&n={limit}", headers: http.Header{"X-Api-Key": {"key-1"}},
+				resultsPath: "data.items", titleField: "name", urlField: "link.href", descriptionField: "rank", sourceField: "site", publishedField: "date", client: newSearchClient("test", custom.Client(), 0, 0),
+			},
+			request:  customRequest,
+			query:    "search=clickhouse+sql&n=5",
+			header:   "key-1",
+			expected: []SearchResult{{Title: "Result", URL: "https://example.com/", Description: "1", Source: "Example", Published: "2026-01-02"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := tt.provider.Search(context.Background(), "clickhouse sql", 5)
+			if err != nil {
+				t.Fatalf("Search() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("Search() = %+v, want %+v", results, tt.expected)
+			}
+			req := *tt.request
+			if !strings.HasPrefix(req.URL.RawQuery, tt.query) {
+				t.Errorf("Search() requested %q, want query %q", req.URL.RawQuery, tt.query)
+			}
+			if tt.header != "" && req.Header.Get("X-Subscription-Token") != tt.header && req.Header.Get("X-Api-Key") != tt.header {
+				t.Errorf("Search() sent headers %v, want the API key", req.Header)
+			}
+		})
+	}
+}
+
+func TestNewSearchProvider(t *testing.T) {
+	t.Setenv(envSearchProvider, "")
+	t.Setenv(envSearXNGURL, "")
+	t.Setenv(envBraveAPIKey, "")
+	t.Setenv(envSearchJSONURL, "")
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		expected    string
+		expectError bool
+	}{
+		{"", nil, providerDuckDuckGo, false},
+		{"", map[string]string{envSearchProvider: providerDuckDuckGoInstant}, providerDuckDuckGoInstant, false},
+		{"Brave", map[string]string{envBraveAPIKey: "key"}, providerBrave, false},
+		{"brave", nil, "", true},
+		{"searxng", nil, "", true},
+		{"json", map[string]string{envSearchJSONURL: "http://localhost/?q={query}", envSearchJSONHeaders: "Authorization: Bearer x"}, providerJSON, false},
+		{"json", map[string]string{envSearchJSONURL: "http://localhost/?q={query}", envSearchJSONHeaders: "no colon"}, "", true},
+		{"google", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		for name, value := range tt.env {
+			t.Setenv(name, value)
+		}
+		provider, err := newSearchProvider(tt.name)
+		if (err != nil) != tt.expectError || (err == nil && provider.Name() != tt.expected) {
+			t.Errorf("newSearchProvider(%q) with %v = %v, %v, want %q (error %v)", tt.name, tt.env, provider, err, tt.expected, tt.expectError)
+		}
+		for name := range tt.env {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+func TestSearchHandler_Provider(t *testing.T) {
+	useFreshSearchClients(t)
+	searx, _ := searchStandIn(t, `{"results": [{"title": "ClickHouse", "url": "https://clickhouse.com/", "content": "Fast OLAP database"}]}`)
+	t.Setenv(envSearchProvider, providerDuckDuckGo)
+	t.Setenv(envSearXNGURL, searx.URL)
+
+	result := searchHandler(nil)(context.Background(), map[string]interface{}{"query": "clickhouse", "provider": "searxng"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("searchHandler() = %q, want success", resultText(result))
+	}
+	if text := resultText(result); !strings.Contains(text, "from searxng (1 results)") {
+		t.Errorf("searchHandler() = %q, want the searxng results", text)
+	}
+
+	result = searchHandler(nil)(context.Background(), map[string]interface{}{"query": "clickhouse", "provider": "bing"})
+	if result.IsError == nil || !*result.IsError {
+		t.Errorf("searchHandler() with an unknown provider = %q, want an error", resultText(result))
+	}
+}
@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+const (
+	searchResultsSchemaURI      = "local-mcp://schemas/search-results.json"
+	searchResultsSchemaMimeType = "application/schema+json"
+
+	// searchResultSummaryURI prefixes the escaped result URL in the URI of
+	// embedded result summaries, so that clients do not take them for the
+	// content of the page.
+	searchResultSummaryURI = "local-mcp://search-result?url="
+)
+
+// Output formats of search-web.
+const (
+	searchFormatText = "text"
+	searchFormatJSON = "json"
+)
+
+// Content items that search-web can add for each result URL. resource_link
+// items need MCP 2025-06-18, which the MCP library does not support yet.
+const (
+	searchLinksNone     = "none"
+	searchLinksEmbedded = "embedded"
+)
+
+var (
+	searchFormats = []string{searchFormatText, searchFormatJSON}
+	searchLinks   = []string{searchLinksNone, searchLinksEmbedded}
+)
+
+// searchResultsSchema is the JSON Schema of the payload of search-web with
+// format json, published as the resource searchResultsSchemaURI.
+//
+//go:embed search_results.schema.json
+var searchResultsSchema string
+
+// searchResultsPayload is the JSON output of search-web.
+type searchResultsPayload struct {
+	Schema   string              `json:"$schema"`
+	Query    string              `json:"query"`
+	Provider string              `json:"provider"`
+	Total    int                 `json:"total"`
+	CachedAt string              `json:"cached_at,omitempty"`
+	Results  []searchResultEntry `json:"results"`
+}
+
+// searchResultEntry is one result in searchResultsPayload.
+type searchResultEntry struct {
+	Rank          int    `json:"rank"`
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	Snippet       string `json:"snippet"`
+	Source        string `json:"source"`
+	Published     string `json:"published,omitempty"`
+	FaviconDomain string `json:"favicon_domain"`
+}
+
+// NewSearchResultsSchemaResource publishes the schema of the JSON output of
+// search-web.
+func NewSearchResultsSchemaResource() fxctx.Resource {
+	return fxctx.NewResource(
+		mcp.Resource{
+			Uri:         searchResultsSchemaURI,
+			Name:        "search-web results schema",
+			Description: ptr("JSON Schema of the results returned by search-web with format json"),
+			MimeType:    ptr(searchResultsSchemaMimeType),
+		},
+		func(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{
+				Contents: []interface{}{
+					mcp.TextResourceContents{
+						Uri:      searchResultsSchemaURI,
+						MimeType: ptr(searchResultsSchemaMimeType),
+						Text:     searchResultsSchema,
+					},
+				},
+			}, nil
+		},
+	)
+}
+
+// parseSearchOption validates an enum argument of search-web, defaulting to
+// the first value.
+func parseSearchOption(args map[string]interface{}, name string, values []string) (string, error) {
+	value, _ := args[name].(string)
+	if value == "" {
+		return values[0], nil
+	}
+	for _, allowed := range values {
+		if strings.EqualFold(value, allowed) {
+			return allowed, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q (supported: %s)", name, value, strings.Join(values, ", "))
+}
+
+// newSearchResultsPayload converts results to the published JSON structure.
+func newSearchResultsPayload(results *SearchResponse, info cacheInfo) searchResultsPayload {
+	payload := searchResultsPayload{
+		Schema:   searchResultsSchemaURI,
+		Query:    results.Query,
+		Provider: results.Provider,
+		Total:    len(results.Results),
+		Results:  make([]searchResultEntry, 0, len(results.Results)),
+	}
+	if info.Status == cacheHit {
+		payload.CachedAt = info.StoredAt.UTC().Format(time.RFC3339)
+	}
+	for i, result := range results.Results {
+		domain := faviconDomain(result.URL)
+		source := result.Source
+		if source == "" {
+			source = domain
+		}
+		payload.Results = append(payload.Results, searchResultEntry{
+			Rank:          i + 1,
+			Title:         result.Title,
+			URL:           result.URL,
+			Snippet:       result.Description,
+			Source:        source,
+			Published:     normalizePublished(result.Published),
+			FaviconDomain: domain,
+		})
+	}
+	return payload
+}
+
+// faviconDomain returns the host of a result URL without a leading www.
+func faviconDomain(rawURL string) string {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(link.Hostname()), "www.")
+}
+
+// normalizePublished converts the dates providers report to RFC 3339, or to
+// YYYY-MM-DD when there is no time of day. Anything else, such as "2 days
+// ago", is kept as it is.
+func normalizePublished(value string) string {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05", value); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return value
+}
+
+// searchResultLinks returns a content item for each result URL: an embedded
+// resource summarising the result with the provider's title and snippet. Its
+// URI is not the result URL, as the text is not the page.
+func searchResultLinks(results []SearchResult, links string) []interface{} {
+	var content []interface{}
+	for _, result := range results {
+		switch links {
+		case searchLinksEmbedded:
+			text := "# " + result.Title + "\n\nSearch result summary for " + result.URL +
+				" (title and snippet from the search provider, not the page content)"
+			if result.Description != "" {
+				text += "\n\n" + result.Description
+			}
+			content = append(content, mcp.EmbeddedResource{
+				Type: "resource",
+				Resource: mcp.TextResourceContents{
+					Uri:      searchResultSummaryURI + url.QueryEscape(result.URL),
+					MimeType: ptr("text/markdown"),
+					Text:     text,
+				},
+			})
+		}
+	}
+	return content
+}
+
+// searchResultsJSON returns the payload of results as a text content item.
+func searchResultsJSON(results *SearchResponse, info cacheInfo) (mcp.TextContent, error) {
+	data, err := json.MarshalIndent(newSearchResultsPayload(results, info), "", "  ")
+	if err != nil {
+		return mcp.TextContent{}, fmt.Errorf("failed to encode results: %w", err)
+	}
+	return mcp.TextContent{Type: "text", Text: string(data)}, nil
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+func TestNormalizePublished(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"2026-01-02T10:00:00", "2026-01-02T10:00:00Z"},
+		{"2026-01-02T10:00:00+02:00", "2026-01-02T10:00:00+02:00"},
+		{" 2026-01-02 ", "2026-01-02"},
+		{"2 days ago", "2 days ago"},
+	}
+
+	for _, tt := range tests {
+		if result := normalizePublished(tt.input); result != tt.expected {
+			t.Errorf("normalizePublished(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestFaviconDomain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.ClickHouse.com/docs", "clickhouse.com"},
+		{"https://go.dev:443/blog/", "go.dev"},
+		{"not a url", ""},
+	}
+
+	for _, tt := range tests {
+		if result := faviconDomain(tt.input); result != tt.expected {
+			t.Errorf("faviconDomain(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of a struct type, and
+// those without omitempty.
+func jsonFields(typ reflect.Type) (all, required []string) {
+	for i := range typ.NumField() {
+		name, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		all = append(all, name)
+		if options != "omitempty" && name != "$schema" {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(all)
+	sort.Strings(required)
+	return all, required
+}
+
+func TestSearchResultsSchema(t *testing.T) {
+	type object struct {
+		ID         string                     `json:"$id"`
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var schema struct {
+		object
+		Defs map[string]object `json:"$defs"`
+	}
+	if err := json.Unmarshal([]byte(searchResultsSchema), &schema); err != nil {
+		t.Fatalf("the schema is not valid JSON: %v", err)
+	}
+	if schema.ID != searchResultsSchemaURI {
+		t.Errorf("schema $id = %q, want %q", schema.ID, searchResultsSchemaURI)
+	}
+
+	for _, tt := range []struct {
+		object object
+		typ    reflect.Type
+	}{
+		{schema.object, reflect.TypeOf(searchResultsPayload{})},
+		{schema.Defs["result"], reflect.TypeOf(searchResultEntry{})},
+	} {
+		all, required := jsonFields(tt.typ)
+		var properties []string
+		for name := range tt.object.Properties {
+			properties = append(properties, name)
+		}
+		sort.Strings(properties)
+		sort.Strings(tt.object.Required)
+		if !reflect.DeepEqual(properties, all) || !reflect.DeepEqual(tt.object.Required, required) {
+			t.Errorf("schema of %s has properties %v, required %v, want %v, required %v", tt.typ.Name(), properties, tt.object.Required, all, required)
+		}
+	}
+}
+
+func TestSearchHandler_Format(t *testing.T) {
+	useFreshSearchClients(t)
+	searx, _ := searchStandIn(t, `{"results": [
+		{"title": "ClickHouse", "url": "https://www.clickhouse.com/", "content": "Fast OLAP database", "publishedDate": "2026-01-02T00:00:00"},
+		{"title": "Docs", "url": "https://clickhouse.com/docs"}]}`)
+	t.Setenv(envSearchProvider, providerSearXNG)
+	t.Setenv(envSearXNGURL, searx.URL)
+	handler := searchHandler(nil)
+
+	result := handler(context.Background(), map[string]interface{}{"query": "clickhouse", "format": "json"})
+	if result.IsError != nil && *result.IsError {
+		t.Fatalf("searchHandler() = %q, want success", resultText(result))
+	}
+	if len(result.Content) != 1 {
+		t.Fatalf("searchHandler() returned %d content items, want the payload", len(result.Content))
+	}
+	var payload searchResultsPayload
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &payload); err != nil {
+		t.Fatalf("searchHandler() payload is not JSON: %v", err)
+	}
+	expected := searchResultsPayload{
+		Schema: searchResultsSchemaURI, Query: "clickhouse", Provider: providerSearXNG, Total: 2,
+		Results: []searchResultEntry{
+			{Rank: 1, Title: "ClickHouse", URL: "https://www.clickhouse.com/", Snippet: "Fast OLAP database", Source: "clickhouse.com", Published: "2026-01-02T00:00:00Z", FaviconDomain: "clickhouse.com"},
+			{Rank: 2, Title: "Docs", URL: "https://clickhouse.com/docs", Source: "clickhouse.com", FaviconDomain: "clickhouse.com"},
+		},
+	}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Errorf("searchHandler() payload = %+v, want %+v", payload, expected)
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "clickhouse", "links": "resource_link"})
+	if result.IsError == nil || !*result.IsError {
+		t.Errorf("searchHandler() with resource_link links = %q, want an error until the protocol supports them", resultText(result))
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "clickhouse", "links": "embedded"})
+	if len(result.Content) != 3 || !strings.Contains(resultText(result), "Search results for 'clickhouse'") {
+		t.Fatalf("searchHandler() with embedded links = %+v, want the summary and 2 resources", result.Content)
+	}
+	embedded, ok := result.Content[2].(mcp.EmbeddedResource)
+	if !ok || embedded.Type != "resource" {
+		t.Fatalf("searchHandler() content = %+v, want an embedded resource", result.Content[2])
+	}
+	contents := embedded.Resource.(mcp.TextResourceContents)
+	if contents.Uri != "local-mcp://search-result?url=https%3A%2F%2Fclickhouse.com%2Fdocs" {
+		t.Errorf("searchHandler() embedded resource URI = %q, want a summary URI naming the second result", contents.Uri)
+	}
+	if !strings.HasPrefix(contents.Text, "# Docs\n\nSearch result summary for https://clickhouse.com/docs (title and snippet from the search provider, not the page content)") {
+		t.Errorf("searchHandler() embedded resource text = %q, want it marked as a summary", contents.Text)
+	}
+
+	result = handler(context.Background(), map[string]interface{}{"query": "clickhouse", "format": "xml"})
+	if result.IsError == nil || !*result.IsError {
+		t.Errorf("searchHandler() with an unknown format = %q, want an error", resultText(result))
+	}
+}
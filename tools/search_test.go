@@ -122,13 +122,13 @@ func TestSearchHandlerValidation(t *testing.T) {
 	ctx := context.Background()
 
 	// Test missing query parameter
-	result := searchHandler(ctx, map[string]interface{}{})
+	result := searchHandler(nil)(ctx, map[string]interface{}{})
 	if result.IsError == nil || !*result.IsError {
 		t.Error("Expected error for missing query parameter")
 	}
 
 	// Test empty query
-	result = searchHandler(ctx, map[string]interface{}{
+	result = searchHandler(nil)(ctx, map[string]interface{}{
 		"query": "",
 	})
 	if result.IsError == nil || !*result.IsError {
@@ -136,7 +136,7 @@ func TestSearchHandlerValidation(t *testing.T) {
 	}
 
 	// Test invalid query type
-	result = searchHandler(ctx, map[string]interface{}{
+	result = searchHandler(nil)(ctx, map[string]interface{}{
 		"query": 123,
 	})
 	if result.IsError == nil || !*result.IsError {
@@ -144,7 +144,7 @@ func TestSearchHandlerValidation(t *testing.T) {
 	}
 
 	// Test whitespace-only query
-	result = searchHandler(ctx, map[string]interface{}{
+	result = searchHandler(nil)(ctx, map[string]interface{}{
 		"query": "   ",
 	})
 	if result.IsError == nil || !*result.IsError {
@@ -153,7 +153,7 @@ func TestSearchHandlerValidation(t *testing.T) {
 }
 
 func TestNewSearchTool(t *testing.T) {
-	tool := NewSearchTool()
+	tool := NewSearchTool(nil)
 
 	if tool == nil {
 		t.Fatal("NewSearchTool() returned nil")
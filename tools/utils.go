@@ -1,6 +1,9 @@
 package tools
 
 import (
+	"context"
+	"errors"
+
 	"github.com/strowk/foxy-contexts/pkg/mcp"
 )
 
@@ -30,6 +33,35 @@ func successResult(content string) *mcp.CallToolResult {
 	}
 }
 
+// querySuccessResult creates a success result for a query, with its query ID
+// and log_comment in _meta.
+func querySuccessResult(content string, result *queryResult) *mcp.CallToolResult {
+	res := successResult(content)
+	res.Meta = queryMeta(result.QueryID, result.LogComment)
+	return res
+}
+
+// queryErrorResult creates an error result for a failed query. If the query
+// reached the server, its query ID is added to the message and to _meta.
+func queryErrorResult(message string, err error) *mcp.CallToolResult {
+	var qerr *queryError
+	if !errors.As(err, &qerr) {
+		return errorResult(message)
+	}
+	res := errorResult(message + "\nQuery ID: " + qerr.QueryID)
+	res.Meta = queryMeta(qerr.QueryID, qerr.LogComment)
+	return res
+}
+
+func queryMeta(queryID, logComment string) mcp.CallToolResultMeta {
+	return mcp.CallToolResultMeta{"query_id": queryID, "log_comment": logComment}
+}
+
+// queryIDsMeta is queryMeta for tools that run several queries.
+func queryIDsMeta(ctx context.Context, queryIDs []string) mcp.CallToolResultMeta {
+	return mcp.CallToolResultMeta{"query_ids": queryIDs, "log_comment": queryLogComment(ctx)}
+}
+
 // ptr returns a pointer to the given value.
 func ptr[T any](v T) *T {
 	return &v